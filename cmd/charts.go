@@ -1,12 +1,13 @@
 package cmd
 
 import (
-	"encoding/csv"
 	"os"
-	"strconv"
+	"path/filepath"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
 )
@@ -21,120 +22,63 @@ var chartsCmd = &cobra.Command{
 }
 
 var (
-	csvFile   string
+	csvFiles  []string
 	chartFile string
+	chartType string
+	chartSpec client.ChartSpec
 )
 
 func generate(cmd *cobra.Command, args []string) error {
-	if csvFile == "" {
+	if len(csvFiles) == 0 {
 		return errors.New("CSV file should be specified")
 	}
-	f, err := os.Open(csvFile)
-	if err != nil {
-		return err
-	}
-	// filename,rw,numjobs,runtime,direct,blocksize,iodepth,read-iops-mean,read-bw-mean(KiB/s),latency-read-min(us),latency-read-max(us),latency-read-mean(us),read-stddev(us),write-iops-mean,write-bw-mean(KiB/s),latency-write-min(us),latency-write-max(us),latency-write-mean(us),latency-write-stddev(us),ioengine,verify
-	// /dev/nvme0n1,randread,1,120s,1,4K,1,13369.941423,53479.774059,54,6039,74.393800365,11.089774646,0,0,0,0,0,0,libaio,
-	r := csv.NewReader(f)
-	records, err := r.ReadAll()
-	if err != nil {
+	if err := client.ValidateChartType(chartType); err != nil {
 		return err
 	}
-	var jobs []*client.FioJob
-	var numJobsMap = make(map[int32]struct{})
-	for i, record := range records {
-		if i == 0 {
-			// skip first line
-			continue
-		}
-		if len(record) != 21 {
-			return errors.Errorf("Invalid csv format")
+	var results []*client.FioResult
+	for _, csvFile := range csvFiles {
+		fileResults, err := parseCSVFile(csvFile)
+		if err != nil {
+			return err
 		}
-		filename := record[0]
-		rw := record[1]
-		numjobs := record[2]
-		j, _ := strconv.ParseInt(numjobs, 10, 32)
-		numJobsMap[int32(j)] = struct{}{}
-		runtime := record[3]
-		direct := record[4]
-		bs := record[5]
-		iodepth := record[6]
-		readIOPS, _ := strconv.ParseFloat(record[7], 64)
-		readBw, _ := strconv.ParseFloat(record[8], 64)
-		readLatMin, _ := strconv.ParseFloat(record[9], 64)
-		readLatMin *= 1000
-		readLatMax, _ := strconv.ParseFloat(record[10], 64)
-		readLatMax *= 1000
-		readLatMean, _ := strconv.ParseFloat(record[11], 64)
-		readLatMean *= 1000
-		readLatStddev, _ := strconv.ParseFloat(record[12], 64)
-		readLatStddev *= 1000
-		writeIOPS, _ := strconv.ParseFloat(record[13], 64)
-		writeBw, _ := strconv.ParseFloat(record[14], 64)
-		writeLatMin, _ := strconv.ParseFloat(record[15], 64)
-		writeLatMin *= 1000
-		writeLatMax, _ := strconv.ParseFloat(record[16], 64)
-		writeLatMax *= 1000
-		writeLatMean, _ := strconv.ParseFloat(record[17], 64)
-		writeLatMean *= 1000
-		writeLatStddev, _ := strconv.ParseFloat(record[18], 64)
-		writeLatStddev *= 1000
-		ioengine := record[19]
-		verify := record[20]
-		job := &client.FioJob{
-			JobName: filename,
-			JobOptions: &client.JobOptions{
-				FileName:  filename,
-				NumJobs:   numjobs,
-				Runtime:   runtime,
-				IOEngine:  ioengine,
-				Direct:    direct,
-				Verify:    verify,
-				BlockSize: bs,
-				IODepth:   iodepth,
-				RW:        rw,
-			},
-			ReadResult: &client.ReadResult{
-				IOPSMean: readIOPS,
-				BWMean:   readBw,
-				LatencyNs: client.LatencyNs{
-					Min:    readLatMin,
-					Max:    readLatMax,
-					Mean:   readLatMean,
-					Stddev: readLatStddev,
-				},
-			},
-			WriteResult: &client.WriteResult{
-				IOPSMean: writeIOPS,
-				BWMean:   writeBw,
-				LatencyNs: client.LatencyNs{
-					Min:    writeLatMin,
-					Max:    writeLatMax,
-					Mean:   writeLatMean,
-					Stddev: writeLatStddev,
-				},
-			},
-		}
-		jobs = append(jobs, job)
-	}
-	var results = []*client.FioResult{
-		{
-			Jobs: jobs,
-		},
+		results = append(results, fileResults...)
 	}
-	var numJobs []int32
-	for j := range numJobsMap {
-		numJobs = append(numJobs, j)
+	return client.RenderCharts(results, chartFile, chartType, &chartSpec)
+}
+
+// parseCSVFile parses the results of the CSV file, which are labeled by the
+// file name, eg. kernel-6.1 of kernel-6.1.csv, so that the files can be
+// charted together by the label series.
+func parseCSVFile(csvFile string) ([]*client.FioResult, error) {
+	f, err := os.Open(csvFile)
+	if err != nil {
+		return nil, err
 	}
-	err = client.RenderCharts(results, numJobs, chartFile)
+	defer f.Close()
+	results, err := client.ParseCSVResults(f)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	label := strings.TrimSuffix(filepath.Base(csvFile), filepath.Ext(csvFile))
+	for _, result := range results {
+		result.Label = label
 	}
+	return results, nil
+}
 
-	return nil
+// addChartFlags adds the flags of the chart type and the chart spec, the
+// non-empty fields of the chart spec override the chart of the config file.
+func addChartFlags(flags *pflag.FlagSet, chartType *string, spec *client.ChartSpec) {
+	flags.StringVar(chartType, "chart-type", client.Chart2D, "type of the charts, eg. 2d for the lines, 3d for the surfaces over numjobs and iodepth, or both")
+	flags.StringVar(&spec.Preset, "chart-preset", "", "preset of the lines, eg. numjobs-scaling (default), qd-scaling, bs-scaling or oio-scaling, which is overridden by the other chart flags")
+	flags.StringVar(&spec.XAxis, "chart-x-axis", "", "x-axis of the lines, eg. numjobs, iodepth, bs or outstanding (numjobs x iodepth)")
+	flags.StringVar(&spec.Series, "chart-series", "", "series of the lines, eg. filename, model or label")
+	flags.StringSliceVar(&spec.Facets, "chart-facets", nil, "dimensions of the lines, one chart for each combination, eg. rw,bs,iodepth")
+	flags.StringSliceVar(&spec.Metrics, "chart-metrics", nil, "metrics of the lines, the direction followed by iops, bw or lat, eg. read_iops,read_lat")
 }
 
 func init() {
-	chartsCmd.Flags().StringVar(&csvFile, "csv-file", "", "CSV file you want to generate chart")
+	chartsCmd.Flags().StringSliceVar(&csvFiles, "csv-file", nil, "CSV files you want to generate chart, the results of each file are labeled by its file name")
 	chartsCmd.Flags().StringVar(&chartFile, "chart-file", "", "chart file you want to generate")
+	addChartFlags(chartsCmd.Flags(), &chartType, &chartSpec)
 }
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+	"github.com/microyahoo/fio-benchmark/pkg/store"
+)
+
+type compareOptions struct {
+	storeDir      string
+	thresholds    client.Thresholds
+	failOnMissing bool
+	renderFormat  string
+	outputFile    string
+}
+
+func newCompareCommand() *cobra.Command {
+	o := &compareOptions{}
+	cmd := &cobra.Command{
+		Use:   "compare <base> <target>",
+		Short: "Compare the target results with the base results and exit with code 3 on regressions",
+		Long: `Compare the target results with the base results, each of which is a csv or json file rendered by
+fio-benchmark, the output of fio --output-format json, or the id of a run saved in the result store.
+The results are matched on filename, rw, bs, iodepth and numjobs.`,
+		Args: cobra.ExactArgs(2),
+		// a regression isn't a usage error
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.Run(args[0], args[1])
+		},
+	}
+	cmd.Flags().SortFlags = false
+	cmd.Flags().Float64Var(&o.thresholds.IOPS, "iops-threshold", 5, "IOPS dropped by more than the percent is a regression")
+	cmd.Flags().Float64Var(&o.thresholds.BW, "bw-threshold", 5, "bandwidth dropped by more than the percent is a regression")
+	cmd.Flags().Float64Var(&o.thresholds.Latency, "latency-threshold", 10, "mean or percentile latency increased by more than the percent is a regression")
+	cmd.Flags().BoolVar(&o.failOnMissing, "fail-on-missing", false, "the job options of the base results missing in the target results fail the comparison like a regression")
+	cmd.Flags().StringVar(&o.renderFormat, "render-format", "", "format of the comparison, eg. table, html, markdown, csv, json")
+	cmd.Flags().StringVar(&o.outputFile, "output-file", "", "redirect the comparison to output file")
+	cmd.Flags().StringVar(&o.storeDir, "store-dir", store.DefaultDir(), "directory of the result store where the runs are looked up")
+
+	return cmd
+}
+
+func (o *compareOptions) Run(base, target string) error {
+	baseResults, err := o.load(base)
+	if err != nil {
+		return err
+	}
+	targetResults, err := o.load(target)
+	if err != nil {
+		return err
+	}
+	comparisons := client.CompareResults(baseResults, targetResults, o.thresholds)
+	var w io.Writer = os.Stdout
+	if o.outputFile != "" {
+		f, err := os.Create(o.outputFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	client.RenderComparisons(comparisons, w, o.renderFormat)
+	var missing int
+	for _, c := range comparisons {
+		if c.Status == client.CompareMissing {
+			missing++
+		}
+	}
+	if missing > 0 && !o.failOnMissing {
+		klog.Warningf("%d job options of %s are missing in %s", missing, base, target)
+	}
+	if err = client.ComparisonError(comparisons, o.failOnMissing); err != nil {
+		return errors.Wrapf(err, "%s compared with %s", target, base)
+	}
+	return nil
+}
+
+// load loads the results from the file, or from the result store if there is
+// no such file.
+func (o *compareOptions) load(source string) ([]*client.FioResult, error) {
+	if _, err := os.Stat(source); err == nil {
+		return client.LoadResults(source)
+	}
+	s, err := store.Open(o.storeDir)
+	if err != nil {
+		return nil, err
+	}
+	record, err := s.Get(source)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s is neither a file nor a stored run", source)
+	}
+	return record.Results, nil
+}
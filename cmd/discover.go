@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+	"k8s.io/klog/v2"
+
+	"github.com/microyahoo/fio-benchmark/pkg/server"
+	"github.com/microyahoo/fio-benchmark/pkg/util/exec"
+)
+
+type discoverOptions struct {
+	cfgFile        string
+	outputFormat   string
+	generateConfig string
+}
+
+func newDiscoverCommand() *cobra.Command {
+	o := &discoverOptions{}
+	cmd := &cobra.Command{
+		Use:   "discover",
+		Short: "Print the local devices and whether they are selected by use_all_disks",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.Run()
+		},
+	}
+	cmd.Flags().SortFlags = false
+	cmd.Flags().StringVar(&o.cfgFile, "config-file", "", "fio benchmark config file whose device_selector is applied")
+	cmd.Flags().StringVar(&o.outputFormat, "output-format", "table", "output format of the devices, eg. table, json, yaml")
+	cmd.Flags().StringVar(&o.generateConfig, "generate-config", "", "write a config file with the selected devices as the filenames")
+
+	return cmd
+}
+
+func (o *discoverOptions) Run() error {
+	var selector *server.DeviceSelector
+	if o.cfgFile != "" {
+		settings, err := server.ParseSettings(o.cfgFile)
+		if err != nil {
+			return err
+		}
+		selector = settings.DeviceSelector
+	}
+	devices, err := server.Discover(&exec.CommandExecutor{}, selector)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(o.outputFormat) {
+	case "json":
+		data, err := json.MarshalIndent(devices, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case "yaml":
+		data, err := yaml.Marshal(devices)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+	case "table", "":
+		printDevices(devices)
+	default:
+		return errors.Errorf("unsupported output format %s", o.outputFormat)
+	}
+	if o.generateConfig == "" {
+		return nil
+	}
+	f, err := os.Create(o.generateConfig)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = server.GenerateConfig(f, devices); err != nil {
+		return err
+	}
+	klog.Infof("Config is written to %s", o.generateConfig)
+	return nil
+}
+
+func printDevices(devices []*server.DiscoveredDevice) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"device", "type", "size", "rota", "bus", "vendor", "model", "serial", "wwn", "fs", "mountpoint", "selected", "reason"})
+	for _, d := range devices {
+		t.AppendRow(table.Row{d.Device, d.Type, d.HumanSize(), d.Rotational, d.Bus, d.Vendor, d.Model, d.Serial, d.WWN,
+			d.Filesystem, d.MountPoint, d.Selected, d.Reason})
+	}
+	t.Render()
+}
@@ -2,9 +2,9 @@ package main
 
 import (
 	"math/rand"
+	"os"
 	"time"
 
-	"github.com/spf13/cobra"
 	"k8s.io/component-base/logs"
 
 	"github.com/microyahoo/fio-benchmark/cmd"
@@ -17,5 +17,9 @@ func main() {
 	defer logs.FlushLogs()
 
 	rootCmd := cmd.NewFioCommand()
-	cobra.CheckErr(rootCmd.Execute())
+	if err := rootCmd.Execute(); err != nil {
+		// the error is already printed by cobra
+		logs.FlushLogs()
+		os.Exit(cmd.ExitCode(err))
+	}
 }
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+	"github.com/microyahoo/fio-benchmark/pkg/server"
+	"github.com/microyahoo/fio-benchmark/pkg/store"
+)
+
+type historyOptions struct {
+	storeDir     string
+	device       string
+	model        string
+	rw           string
+	bs           string
+	since        string
+	until        string
+	renderFormat string
+	metadata     bool
+	outputFile   string
+	chartFile    string
+	chartType    string
+	chartSpec    client.ChartSpec
+}
+
+func newHistoryCommand() *cobra.Command {
+	o := &historyOptions{}
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "List and show the runs saved in the result store",
+	}
+	cmd.PersistentFlags().StringVar(&o.storeDir, "store-dir", store.DefaultDir(), "directory of the result store")
+	cmd.PersistentFlags().StringVar(&o.device, "device", "", "only the results of the filename or its base name, eg. /dev/nvme0n1 or nvme0n1")
+	cmd.PersistentFlags().StringVar(&o.model, "model", "", "only the results of the devices whose model contains it, case-insensitive")
+	cmd.PersistentFlags().StringVar(&o.rw, "rw", "", "only the results of the rw, eg. randread")
+	cmd.PersistentFlags().StringVar(&o.bs, "bs", "", "only the results of the block size, eg. 4K")
+	cmd.PersistentFlags().StringVar(&o.since, "since", "", "only the runs created since the date or time, eg. 2026-01-02 or 2026-01-02T15:04:05Z")
+	cmd.PersistentFlags().StringVar(&o.until, "until", "", "only the runs created until the date or time, eg. 2026-01-02 or 2026-01-02T15:04:05Z")
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List the runs matched by the filters",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.list(os.Stdout)
+		},
+	}
+	show := &cobra.Command{
+		Use:   "show <id>",
+		Short: "Render the results and the charts of the run, only the results matched by the filters",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.show(args[0])
+		},
+	}
+	show.Flags().StringVar(&o.renderFormat, "render-format", "", "format of the results, eg. table, html, markdown, csv, json")
+	show.Flags().BoolVar(&o.metadata, "show-metadata", false, "render the device and host columns of the results, which are always kept in json")
+	show.Flags().StringVar(&o.outputFile, "output-file", "", "redirect the results to output file")
+	show.Flags().StringVar(&o.chartFile, "chart-file", "", "echarts file of the results, which isn't rendered if not specified")
+	addChartFlags(show.Flags(), &o.chartType, &o.chartSpec)
+	cmd.AddCommand(list, show)
+
+	return cmd
+}
+
+// filter builds the filter of the records from the flags.
+func (o *historyOptions) filter() (*store.Filter, error) {
+	filter := &store.Filter{Device: o.device, Model: o.model, RW: o.rw, BlockSize: o.bs}
+	var err error
+	if filter.Since, err = parseTime(o.since, false); err != nil {
+		return nil, err
+	}
+	if filter.Until, err = parseTime(o.until, true); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// parseTime parses the date in the local time zone or the RFC3339 time, the
+// date is the end of the day if end is true.
+func parseTime(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, errors.Errorf("invalid time %q, eg. 2026-01-02 or 2026-01-02T15:04:05Z", value)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
+
+func (o *historyOptions) list(w io.Writer) error {
+	filter, err := o.filter()
+	if err != nil {
+		return err
+	}
+	s, err := store.Open(o.storeDir)
+	if err != nil {
+		return err
+	}
+	summaries, err := s.List(filter)
+	if err != nil {
+		return err
+	}
+	t := table.NewWriter()
+	t.SetOutputMirror(w)
+	t.AppendHeader(table.Row{"id", "created", "host", "config", "filenames", "models", "rw", "bs", "results"})
+	for _, r := range summaries {
+		filenames, models, rws, bss := r.Values()
+		results := fmt.Sprint(r.Results)
+		if r.Interrupted {
+			results += " (interrupted)"
+		}
+		t.AppendRow(table.Row{r.ID, r.CreatedAt.Local().Format("2006-01-02 15:04:05"), r.Hostname, r.ConfigFile,
+			strings.Join(filenames, "\n"), strings.Join(models, "\n"), strings.Join(rws, " "), strings.Join(bss, " "), results})
+	}
+	t.Render()
+	return nil
+}
+
+func (o *historyOptions) show(id string) error {
+	filter, err := o.filter()
+	if err != nil {
+		return err
+	}
+	s, err := store.Open(o.storeDir)
+	if err != nil {
+		return err
+	}
+	record, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	record = record.Filtered(filter)
+	var w io.Writer = os.Stdout
+	if o.outputFile != "" {
+		f, err := os.Create(o.outputFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	output := &server.Output{Results: record.Results, Aggregated: record.Aggregated, Percentiles: record.Percentiles, Metadata: o.metadata}
+	if err = output.Render(w, o.renderFormat); err != nil {
+		return err
+	}
+	if o.chartFile == "" {
+		return nil
+	}
+	results := record.ChartResults()
+	if err = client.RenderCharts(results, o.chartFile, o.chartType, &o.chartSpec); err != nil {
+		return err
+	}
+	klog.Infof("Charts of %s are rendered to %s", record.ID, o.chartFile)
+	return nil
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/microyahoo/fio-benchmark/pkg/server"
+	"github.com/microyahoo/fio-benchmark/pkg/util/exec"
+)
+
+type planOptions struct {
+	jobFile      string
+	cfgFile      string
+	outputFormat string
+	itemOverhead time.Duration
+}
+
+func newPlanCommand() *cobra.Command {
+	o := &planOptions{}
+	cmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Print the work items of the benchmark and estimate its wall-clock time",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.Run()
+		},
+	}
+	cmd.Flags().SortFlags = false
+	cmd.Flags().StringVar(&o.jobFile, "job-file", "", "fio job file, each job section of which will be run as a work item")
+	cmd.Flags().StringVar(&o.cfgFile, "config-file", "", "fio benchmark config file, which will be ignored if job file is specified")
+	cmd.Flags().StringVar(&o.outputFormat, "output-format", "table", "output format of the plan, eg. table, json, yaml")
+	cmd.Flags().DurationVar(&o.itemOverhead, "item-overhead", server.DefaultItemOverhead, "estimated overhead of each work item besides its runtime, such as dropping caches")
+
+	return cmd
+}
+
+func (o *planOptions) Run() error {
+	if o.jobFile == "" && o.cfgFile == "" {
+		return errors.New("job file or config file should be specified")
+	}
+	state, _, err := server.NewRunState(o.jobFile, o.cfgFile, &exec.CommandExecutor{})
+	if err != nil {
+		return err
+	}
+	plan := server.NewPlan(state, o.itemOverhead)
+	switch strings.ToLower(o.outputFormat) {
+	case "json":
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case "yaml":
+		data, err := yaml.Marshal(plan)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+	case "table", "":
+		printPlan(plan)
+	default:
+		return errors.Errorf("unsupported output format %s", o.outputFormat)
+	}
+	return nil
+}
+
+func printPlan(plan *server.Plan) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	header := table.Row{"device", "id", "rw", "blocksize", "iodepth", "numjobs", "runtime(s)"}
+	if plan.Stages > 1 {
+		header = append(table.Row{"stage"}, header...)
+	}
+	t.AppendHeader(header)
+	for _, d := range plan.Devices {
+		for _, item := range d.Items {
+			row := table.Row{d.Device, item.ID, item.RW, item.BlockSize, item.IODepth, item.NumJobs, item.Runtime}
+			if plan.Stages > 1 {
+				row = append(table.Row{d.Stage}, row...)
+			}
+			t.AppendRow(row)
+		}
+		t.AppendSeparator()
+	}
+	t.Render()
+
+	d := table.NewWriter()
+	d.SetOutputMirror(os.Stdout)
+	d.AppendHeader(table.Row{"device", "items", "duration"})
+	for _, device := range plan.Devices {
+		d.AppendRow(table.Row{device.Device, len(device.Items), device.Duration})
+	}
+	d.Render()
+
+	s := table.NewWriter()
+	s.SetOutputMirror(os.Stdout)
+	s.AppendRows([]table.Row{
+		{"devices", len(plan.Devices)},
+		{"total items", plan.TotalItems},
+		{"workers", plan.Workers},
+		{"item overhead", plan.ItemOverhead},
+		{"estimated wall time", plan.Estimate},
+	})
+	s.Render()
+}
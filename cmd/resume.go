@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	genericServer "github.com/microyahoo/fio-benchmark/pkg/server"
+	"github.com/microyahoo/fio-benchmark/pkg/store"
+)
+
+func newResumeCommand() *cobra.Command {
+	o := newFioBenchmarkOptions()
+	cmd := &cobra.Command{
+		Use:   "resume <run-dir>",
+		Short: "Resume the interrupted benchmark run saved in the run directory",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.runDir = args[0]
+			o.resume = true
+			if !cmd.Flags().Changed("dryrun") {
+				dryrun, err := savedDryrun(o.runDir)
+				if err != nil {
+					return err
+				}
+				if dryrun != nil {
+					o.dryrun = *dryrun
+				}
+			}
+			return o.Run(genericServer.SetupSignalHandler())
+		},
+	}
+	cmd.Flags().StringVar(&o.outputFile, "output-file", "", "redirect fio benchmark result to output file")
+	cmd.Flags().StringVar(&o.renderFormat, "render-format", "", "redirect fio benchmark result to output file with rendered format, eg. table, html, markdown, csv, json")
+	cmd.Flags().BoolVar(&o.metadata, "show-metadata", false, "render the device and host columns of the results, which are always kept in json")
+	cmd.Flags().StringVar(&o.chartFile, "chart-file", "", "echarts file for fio benchmark result")
+	addChartFlags(cmd.Flags(), &o.chartType, &o.chartSpec)
+	cmd.Flags().BoolVar(&o.dryrun, "dryrun", true, "dry-run, which is the dryrun of the interrupted run by default and must match it")
+	cmd.Flags().StringVar(&o.junitFile, "junit-file", "", "JUnit XML report of the checks of the expectations")
+	cmd.Flags().StringVar(&o.metricsListen, "metrics-listen", "", "address the Prometheus metrics are served on /metrics during the run, eg. :9273")
+	cmd.Flags().StringVar(&o.metricsFile, "metrics-file", "", "Prometheus textfile collector file the metrics are written into at the end of the run, eg. fio_benchmark.prom")
+	cmd.Flags().StringVar(&o.storeDir, "store-dir", store.DefaultDir(), "directory of the result store where the finished runs are saved, which is disabled if empty")
+
+	return cmd
+}
+
+// savedDryrun returns the dryrun of the run saved in the run directory, which is
+// nil if it wasn't recorded.
+func savedDryrun(runDir string) (*bool, error) {
+	checkpoint, err := genericServer.OpenCheckpoint(runDir)
+	if err != nil {
+		return nil, err
+	}
+	state, err := checkpoint.LoadState()
+	if err != nil {
+		return nil, err
+	}
+	return state.Dryrun, nil
+}
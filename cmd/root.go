@@ -2,23 +2,45 @@ package cmd
 
 import (
 	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"k8s.io/klog/v2"
 
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
 	"github.com/microyahoo/fio-benchmark/pkg/server"
 	genericServer "github.com/microyahoo/fio-benchmark/pkg/server"
+	"github.com/microyahoo/fio-benchmark/pkg/store"
+	"github.com/microyahoo/fio-benchmark/pkg/util/exec"
 )
 
 // fioBenchmarkOptions defines the options of fio benchmark
 type fioBenchmarkOptions struct {
-	jobFile      string // TODO
+	jobFile      string
 	cfgFile      string
 	outputFile   string
 	chartFile    string
+	chartType    string
+	chartSpec    client.ChartSpec
+	label        string
 	dryrun       bool
 	renderFormat string
+	runDir       string
+	resume       bool
+	percentiles  []float64
+	logAvgMsec   uint64
+	storeDir     string
+	junitFile    string
+	metadata     bool
+
+	metricsListen string
+	metricsFile   string
 }
 
 func newFioBenchmarkOptions() *fioBenchmarkOptions {
@@ -32,7 +54,7 @@ func NewFioCommand() *cobra.Command {
 	cmds := &cobra.Command{
 		Use: "fio-benchmark",
 		Run: func(cmd *cobra.Command, args []string) {
-			cobra.CheckErr(o.Run(genericServer.SetupSignalHandler()))
+			checkErr(o.Run(genericServer.SetupSignalHandler()))
 		},
 	}
 	cmds.Flags().SortFlags = false
@@ -44,29 +66,72 @@ func NewFioCommand() *cobra.Command {
 	// pflag.CommandLine.AddGoFlag(flag.CommandLine.Lookup("logtostderr"))
 	pflag.CommandLine.Set("logtostderr", "true")
 
-	// cmds.Flags().StringVar(&o.jobFile, "job-file", "", "fio benchmark job file") // TODO(zhengliang)
+	cmds.Flags().StringVar(&o.jobFile, "job-file", "", "fio job file, each job section of which will be run as a work item")
 	cmds.Flags().StringVar(&o.outputFile, "output-file", "", "redirect fio benchmark result to output file")
-	cmds.Flags().StringVar(&o.renderFormat, "render-format", "", "redirect fio benchmark result to output file with rendered format, eg. table, html, markdown, csv")
+	cmds.Flags().StringVar(&o.renderFormat, "render-format", "", "redirect fio benchmark result to output file with rendered format, eg. table, html, markdown, csv, json")
+	cmds.Flags().BoolVar(&o.metadata, "show-metadata", false, "render the device and host columns of the results, which are always kept in json")
 	cmds.Flags().StringVar(&o.cfgFile, "config-file", "", "fio benchmark config file, which will be ignored if job file is specified")
+	cmds.Flags().Float64SliceVar(&o.percentiles, "percentiles", nil, "completion latency percentiles to report, eg. 50,99,99.9,99.99, which overrides the percentiles of config file, 50,90,99,99.9,99.99 by default")
+	cmds.Flags().Uint64Var(&o.logAvgMsec, "log-avg-msec", 0, "log the bandwidth, IOPS and latency averaged over every period in milliseconds and chart them over time, eg. 1000, which overrides log_avg_msec of the config file")
 	cmds.Flags().StringVar(&o.chartFile, "chart-file", "", "echarts file for fio benchmark result")
+	addChartFlags(cmds.Flags(), &o.chartType, &o.chartSpec)
+	cmds.Flags().StringVar(&o.label, "label", "", "label attached to the results of the run, eg. kernel-6.1, which overrides the label of the config file")
 	cmds.Flags().BoolVar(&o.dryrun, "dryrun", true, "dry-run")
+	cmds.Flags().StringVar(&o.runDir, "run-dir", "", "directory to save the state and the finished results of the run, which can be resumed by the resume command")
+	cmds.Flags().StringVar(&o.storeDir, "store-dir", store.DefaultDir(), "directory of the result store where the finished runs are saved, which is disabled if empty")
+	cmds.Flags().StringVar(&o.junitFile, "junit-file", "", "JUnit XML report of the checks of the expectations")
+	cmds.Flags().StringVar(&o.metricsListen, "metrics-listen", "", "address the Prometheus metrics are served on /metrics during the run, eg. :9273")
+	cmds.Flags().StringVar(&o.metricsFile, "metrics-file", "", "Prometheus textfile collector file the metrics are written into at the end of the run, eg. fio_benchmark.prom")
+	cmds.Flags().DurationVar(&exec.InterruptGracePeriod, "interrupt-grace-period", exec.InterruptGracePeriod, "period to wait for the running fio to exit after it was interrupted, it will be killed after that")
 
-	cmds.AddCommand(versionCmd, chartsCmd)
+	cmds.AddCommand(versionCmd, chartsCmd, newResumeCommand(), newPlanCommand(), newDiscoverCommand(), newServeCommand(), newHistoryCommand(), newCompareCommand())
 
 	return cmds
 }
 
 func (o *fioBenchmarkOptions) Run(stopCh <-chan struct{}) error {
 	klog.Info("Starting fio benchmark")
-	klog.V(4).Infof("fio benchmark options(job-file: %s, config-file: %s)",
-		o.jobFile, o.cfgFile)
+	klog.V(4).Infof("fio benchmark options(job-file: %s, config-file: %s, run-dir: %s, resume: %t)",
+		o.jobFile, o.cfgFile, o.runDir, o.resume)
 
+	if err := client.ValidateChartType(o.chartType); err != nil {
+		return err
+	}
+	var resultStore *store.Store
+	if o.storeDir != "" {
+		var err error
+		if resultStore, err = store.Open(o.storeDir); err != nil {
+			klog.Warningf("Results won't be saved: %v", err)
+		}
+	}
+	var exporter *genericServer.Exporter
+	if o.metricsListen != "" || o.metricsFile != "" {
+		exporter = genericServer.NewExporter()
+	}
+	if o.metricsListen != "" {
+		stop, err := serveMetrics(o.metricsListen, exporter)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
 	server, err := server.NewFioServer(
 		server.WithJobFile(o.jobFile),
 		server.WithCfgFile(o.cfgFile),
 		server.WithChartFile(o.chartFile),
+		server.WithChartType(o.chartType),
+		server.WithChartSpec(&o.chartSpec),
+		server.WithLabel(o.label),
 		server.WithOutputFile(o.outputFile),
 		server.WithRenderFormat(o.renderFormat),
+		server.WithShowMetadata(o.metadata),
+		server.WithRunDir(o.runDir),
+		server.WithResume(o.resume),
+		server.WithPercentiles(o.percentiles),
+		server.WithLogAvgMsec(o.logAvgMsec),
+		server.WithStore(resultStore),
+		server.WithJUnitFile(o.junitFile),
+		server.WithExporter(exporter),
 		server.WithDryrun(o.dryrun))
 	if err != nil {
 		return err
@@ -74,8 +139,58 @@ func (o *fioBenchmarkOptions) Run(stopCh <-chan struct{}) error {
 	genericServer.RegisterInterruptHandler(server.Close)
 
 	err = server.Run(stopCh)
+	if o.metricsFile != "" {
+		if e := exporter.WriteFile(o.metricsFile); e != nil {
+			klog.Warningf("Failed to write the metrics into %s: %v", o.metricsFile, e)
+		}
+	}
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// serveMetrics serves the metrics of the exporter on /metrics in background,
+// the returned function stops serving.
+func serveMetrics(listen string, exporter *genericServer.Exporter) (func(), error) {
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to serve the metrics")
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exporter)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		klog.Infof("Serving the metrics on %s/metrics", listener.Addr())
+		if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+			klog.Warningf("Failed to serve the metrics: %v", err)
+		}
+	}()
+	return func() { srv.Close() }, nil
+}
+
+// ExitCode returns the exit code of the error returned by the command, which is
+// 2 if any expectation failed and 3 if the comparison regressed, so that they can
+// be told from the other errors.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var expectationErr *genericServer.ExpectationError
+	if errors.As(err, &expectationErr) {
+		return 2
+	}
+	var regressionErr *client.RegressionError
+	if errors.As(err, &regressionErr) {
+		return 3
+	}
+	return 1
+}
+
+// checkErr prints the error and exits with its exit code like cobra.CheckErr.
+func checkErr(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(ExitCode(err))
+	}
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+
+	"github.com/microyahoo/fio-benchmark/pkg/server"
+	"github.com/microyahoo/fio-benchmark/pkg/store"
+)
+
+type serveOptions struct {
+	listen   string
+	dataDir  string
+	dryrun   bool
+	storeDir string
+	token    string
+}
+
+func newServeCommand() *cobra.Command {
+	o := &serveOptions{}
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Run the benchmark agent which queues and runs the settings submitted by the REST API",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.Run(server.SetupSignalHandler())
+		},
+	}
+	cmd.Flags().SortFlags = false
+	cmd.Flags().StringVar(&o.listen, "listen", "127.0.0.1:8080", "address the REST API listens on")
+	cmd.Flags().StringVar(&o.token, "token", "", "bearer token required by the REST API, which must be specified if the listen address isn't loopback, $FIO_BENCHMARK_TOKEN by default")
+	cmd.Flags().StringVar(&o.dataDir, "data-dir", "fio-benchmark-runs", "directory to save the settings, the results and the charts of the runs")
+	cmd.Flags().BoolVar(&o.dryrun, "dryrun", true, "dry-run all the runs, otherwise the runs are only dry-run if requested by ?dryrun=true")
+	cmd.Flags().StringVar(&o.storeDir, "store-dir", store.DefaultDir(), "directory of the result store where the finished runs are also saved, which is disabled if empty")
+
+	return cmd
+}
+
+func (o *serveOptions) Run(stopCh <-chan struct{}) error {
+	if o.token == "" {
+		o.token = os.Getenv("FIO_BENCHMARK_TOKEN") // so that it isn't shown in the process list
+	}
+	// the submitted settings can overwrite the devices of the host
+	if o.token == "" && !server.IsLoopback(o.listen) {
+		return errors.Errorf("--token is required since %s isn't a loopback address", o.listen)
+	}
+	agent, err := server.NewAgent(o.dataDir, o.dryrun)
+	if err != nil {
+		return err
+	}
+	if o.storeDir != "" {
+		if agent.Store, err = store.Open(o.storeDir); err != nil {
+			klog.Warningf("Results won't be saved: %v", err)
+		}
+	}
+	server.RegisterInterruptHandler(agent.Close)
+	agent.Start()
+
+	srv := &http.Server{
+		Addr:              o.listen,
+		Handler:           server.NewAPIHandler(agent, o.token),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		klog.Infof("Serving the REST API on %s, dryrun: %t", o.listen, o.dryrun)
+		errCh <- srv.ListenAndServe()
+	}()
+	select {
+	case err = <-errCh:
+		agent.Close()
+		return err
+	case <-stopCh:
+	}
+	// the running run is canceled first so that the followers of its results return
+	agent.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
@@ -0,0 +1,296 @@
+package client
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/components"
+	"github.com/go-echarts/go-echarts/v2/opts"
+	"github.com/pkg/errors"
+)
+
+// DefaultChartPreset is the preset of the chart spec whose preset is empty,
+// which is the lines over numjobs of each rw, bs and iodepth.
+const DefaultChartPreset = "numjobs-scaling"
+
+// ChartPresets are the chart specs of the common scaling studies.
+var ChartPresets = map[string]*ChartSpec{
+	"numjobs-scaling": {XAxis: "numjobs", Series: "filename", Facets: []string{"rw", "bs", "iodepth"}},
+	"qd-scaling":      {XAxis: "iodepth", Series: "filename", Facets: []string{"rw", "bs", "numjobs"}},
+	"bs-scaling":      {XAxis: "bs", Series: "filename", Facets: []string{"rw", "iodepth", "numjobs"}},
+	"oio-scaling":     {XAxis: "outstanding", Series: "filename", Facets: []string{"rw", "bs"}},
+}
+
+var (
+	// chartXAxes are the dimensions of the x-axis and their axis names
+	chartXAxes = map[string]string{
+		"numjobs":     "num_jobs",
+		"iodepth":     "iodepth",
+		"bs":          "bs",
+		"outstanding": "outstanding_io", // numjobs x iodepth
+	}
+	chartSeries = []string{"filename", "model", "label"}
+	chartFacets = []string{"rw", "bs", "iodepth", "numjobs", "outstanding", "filename", "model", "label"}
+
+	defaultChartMetrics = []string{"read_iops", "write_iops", "read_bw", "write_bw", "read_lat", "write_lat"}
+)
+
+// ChartSpec specifies the line charts of the results, eg. iodepth on the x-axis
+// for the queue depth scaling study. The empty fields are taken from the preset.
+//
+//	chart:
+//	  preset: qd-scaling
+//	  series: model
+//	  metrics: [read_iops, read_lat]
+type ChartSpec struct {
+	Preset  string   `yaml:"preset" json:"preset,omitempty"`   // eg. qd-scaling, numjobs-scaling by default
+	XAxis   string   `yaml:"x_axis" json:"x_axis,omitempty"`   // numjobs, iodepth, bs or outstanding (numjobs x iodepth)
+	Series  string   `yaml:"series" json:"series,omitempty"`   // filename, model or label of the run
+	Facets  []string `yaml:"facets" json:"facets,omitempty"`   // one chart for each combination, eg. rw, bs, iodepth
+	Metrics []string `yaml:"metrics" json:"metrics,omitempty"` // direction followed by iops, bw or lat, eg. read_iops
+}
+
+// Override returns a copy of the spec whose fields are overridden by the
+// non-empty fields of o, eg. the flags over the config file.
+func (s *ChartSpec) Override(o *ChartSpec) *ChartSpec {
+	spec := &ChartSpec{}
+	if s != nil {
+		*spec = *s
+	}
+	if o == nil {
+		return spec
+	}
+	if o.Preset != "" {
+		spec.Preset = o.Preset
+	}
+	if o.XAxis != "" {
+		spec.XAxis = o.XAxis
+	}
+	if o.Series != "" {
+		spec.Series = o.Series
+	}
+	if len(o.Facets) > 0 {
+		spec.Facets = o.Facets
+	}
+	if len(o.Metrics) > 0 {
+		spec.Metrics = o.Metrics
+	}
+	return spec
+}
+
+// Resolve returns the spec whose empty fields are filled by the preset, an
+// error is returned if any field is invalid.
+func (s *ChartSpec) Resolve() (*ChartSpec, error) {
+	name := DefaultChartPreset
+	if s != nil && s.Preset != "" {
+		name = s.Preset
+	}
+	preset, ok := ChartPresets[name]
+	if !ok {
+		return nil, errors.Errorf("unknown chart preset %q, which should be one of %s", name, strings.Join(sortedKeys(ChartPresets, lessString), ", "))
+	}
+	spec := preset.Override(s)
+	spec.Preset = name
+	if len(spec.Metrics) == 0 {
+		spec.Metrics = defaultChartMetrics
+	}
+	if _, ok = chartXAxes[spec.XAxis]; !ok {
+		return nil, errors.Errorf("invalid chart x-axis %q, which should be one of %s", spec.XAxis, strings.Join(sortedKeys(chartXAxes, lessString), ", "))
+	}
+	if !contains(chartSeries, spec.Series) {
+		return nil, errors.Errorf("invalid chart series %q, which should be one of %s", spec.Series, strings.Join(chartSeries, ", "))
+	}
+	seen := make(map[string]bool)
+	for _, facet := range spec.Facets {
+		if !contains(chartFacets, facet) {
+			return nil, errors.Errorf("invalid chart facet %q, which should be one of %s", facet, strings.Join(chartFacets, ", "))
+		}
+		if facet == spec.XAxis || facet == spec.Series || seen[facet] {
+			return nil, errors.Errorf("chart facet %s is duplicated with the x-axis, the series or the other facets", facet)
+		}
+		seen[facet] = true
+	}
+	for _, metric := range spec.Metrics {
+		if _, err := newChartMetric(metric); err != nil {
+			return nil, err
+		}
+	}
+	return spec, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// chartMetric is a metric of the line charts, eg. read_iops.
+type chartMetric struct {
+	direction string
+	title     string // prefix of the chart title, eg. readiops
+	yaxis     string
+	value     func(r *IOResult) float64
+}
+
+func newChartMetric(name string) (*chartMetric, error) {
+	direction, kind, _ := strings.Cut(name, "_")
+	if direction != "read" && direction != "write" && direction != "trim" {
+		return nil, errors.Errorf("invalid chart metric %q, eg. read_iops, write_bw, read_lat", name)
+	}
+	m := &chartMetric{direction: direction, title: direction + kind}
+	switch kind {
+	case "iops":
+		m.yaxis = "iops"
+		m.value = func(r *IOResult) float64 { return r.IOPSMean }
+	case "bw":
+		m.yaxis = "bandwidth(KiB/s)"
+		m.value = func(r *IOResult) float64 { return r.BWMean }
+	case "lat":
+		m.yaxis = "latency(ms)"
+		m.value = func(r *IOResult) float64 { return r.LatencyNs.Mean / 1000 / 1000 }
+	default:
+		return nil, errors.Errorf("invalid chart metric %q, eg. read_iops, write_bw, read_lat", name)
+	}
+	return m, nil
+}
+
+// dimensionValue returns the value of the job in the dimension of the chart spec.
+func dimensionValue(dimension string, result *FioResult, job *FioJob) string {
+	o := job.JobOptions
+	switch dimension {
+	case "rw":
+		return o.RW
+	case "bs":
+		return o.BlockSize
+	case "iodepth":
+		return o.IODepth
+	case "numjobs":
+		return o.NumJobs
+	case "outstanding":
+		return strconv.Itoa(atoi(o.NumJobs) * atoi(o.IODepth))
+	case "model":
+		if result.Device != nil && result.Device.Model != "" {
+			return result.Device.Model
+		}
+		return "unknown"
+	case "label":
+		if result.Label != "" {
+			return result.Label
+		}
+		return "unlabeled"
+	}
+	return seriesName(result, job)
+}
+
+// dimensionLess sorts the values of the dimension, eg. 4K < 64K < 1M of bs.
+func dimensionLess(dimension string) func(a, b string) bool {
+	switch dimension {
+	case "bs":
+		return lessBlockSize
+	case "iodepth", "numjobs", "outstanding":
+		return lessNumeric
+	}
+	return lessString
+}
+
+// lineFacet is the jobs of a combination of the facets, keyed by the series
+// and the x-axis.
+type lineFacet struct {
+	values []string
+	xs     map[string]bool
+	jobs   map[string]map[string][]*FioJob // series -> x -> jobs
+}
+
+// addLineCharts adds the line charts of the spec, one chart for each metric of
+// each combination of the facets. The jobs of the same point are averaged, eg.
+// the devices of the same model if the series is model, and the missing points
+// are left as gaps.
+func addLineCharts(page *components.Page, results []*FioResult, spec *ChartSpec) {
+	facets := make(map[string]*lineFacet)
+	for _, result := range results {
+		for _, job := range result.SummaryJobs() {
+			if job.JobOptions == nil {
+				continue
+			}
+			var values []string
+			for _, facet := range spec.Facets {
+				values = append(values, dimensionValue(facet, result, job))
+			}
+			key := strings.Join(values, "|")
+			f, ok := facets[key]
+			if !ok {
+				f = &lineFacet{values: values, xs: make(map[string]bool), jobs: make(map[string]map[string][]*FioJob)}
+				facets[key] = f
+			}
+			x := dimensionValue(spec.XAxis, result, job)
+			series := dimensionValue(spec.Series, result, job)
+			if _, ok = f.jobs[series]; !ok {
+				f.jobs[series] = make(map[string][]*FioJob)
+			}
+			f.xs[x] = true
+			f.jobs[series][x] = append(f.jobs[series][x], job)
+		}
+	}
+	sorted := make([]*lineFacet, 0, len(facets))
+	for _, f := range facets {
+		sorted = append(sorted, f)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		for k, facet := range spec.Facets {
+			a, b := sorted[i].values[k], sorted[j].values[k]
+			if a != b {
+				return dimensionLess(facet)(a, b)
+			}
+		}
+		return false
+	})
+
+	var metrics []*chartMetric
+	for _, name := range spec.Metrics {
+		m, err := newChartMetric(name)
+		if err != nil {
+			continue // validated by Resolve
+		}
+		metrics = append(metrics, m)
+	}
+	for _, f := range sorted {
+		xs := sortedKeys(f.xs, dimensionLess(spec.XAxis))
+		for _, m := range metrics {
+			title := strings.Join(append([]string{m.title}, f.values...), "-")
+			line := charts.NewLine()
+			line.SetGlobalOptions(
+				charts.WithTitleOpts(opts.Title{Title: title}),
+				charts.WithTooltipOpts(opts.Tooltip{Show: true, TriggerOn: "mousemove|click"}),
+				charts.WithLegendOpts(opts.Legend{Show: true, Width: "50%", Left: "right"}),
+				charts.WithInitializationOpts(opts.Initialization{Theme: "shine"}),
+				charts.WithXAxisOpts(opts.XAxis{Name: chartXAxes[spec.XAxis]}),
+				charts.WithYAxisOpts(opts.YAxis{Name: m.yaxis}),
+			)
+			line.SetXAxis(xs)
+			for _, series := range sortedKeys(f.jobs, lessString) {
+				data := make([]opts.LineData, 0, len(xs))
+				for _, x := range xs {
+					jobs := f.jobs[series][x]
+					if len(jobs) == 0 {
+						data = append(data, opts.LineData{Value: "-"}) // missing in echarts
+						continue
+					}
+					var sum float64
+					for _, job := range jobs {
+						if r := job.directionResult(m.direction); r != nil {
+							sum += m.value(r)
+						}
+					}
+					data = append(data, opts.LineData{Value: sum / float64(len(jobs))})
+				}
+				line.AddSeries(series, data)
+			}
+			page.AddCharts(line)
+		}
+	}
+}
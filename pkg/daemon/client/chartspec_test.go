@@ -0,0 +1,96 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestChartSpecSuite(t *testing.T) {
+	suite.Run(t, new(chartSpecTestSuite))
+}
+
+type chartSpecTestSuite struct {
+	suite.Suite
+}
+
+func (s *chartSpecTestSuite) TestResolve() {
+	var spec *ChartSpec
+	resolved, err := spec.Resolve()
+	s.Require().NoError(err)
+	s.Equal(&ChartSpec{Preset: "numjobs-scaling", XAxis: "numjobs", Series: "filename", Facets: []string{"rw", "bs", "iodepth"},
+		Metrics: defaultChartMetrics}, resolved)
+
+	// the flags override the config file, which overrides the preset
+	spec = (&ChartSpec{Preset: "qd-scaling", Series: "model"}).Override(&ChartSpec{Metrics: []string{"read_iops"}})
+	resolved, err = spec.Resolve()
+	s.Require().NoError(err)
+	s.Equal(&ChartSpec{Preset: "qd-scaling", XAxis: "iodepth", Series: "model", Facets: []string{"rw", "bs", "numjobs"},
+		Metrics: []string{"read_iops"}}, resolved)
+	spec = &ChartSpec{Preset: "qd-scaling", Series: "model"}
+	s.Equal(spec, spec.Override(nil).Override(&ChartSpec{Facets: []string{}}))
+
+	for _, c := range []struct {
+		spec *ChartSpec
+		err  string
+	}{
+		{&ChartSpec{Preset: "iops"}, `unknown chart preset "iops", which should be one of bs-scaling, numjobs-scaling, oio-scaling, qd-scaling`},
+		{&ChartSpec{XAxis: "rw"}, `invalid chart x-axis "rw", which should be one of bs, iodepth, numjobs, outstanding`},
+		{&ChartSpec{Series: "bs"}, `invalid chart series "bs", which should be one of filename, model, label`},
+		{&ChartSpec{Facets: []string{"runtime"}}, `invalid chart facet "runtime", which should be one of rw, bs, iodepth, numjobs, outstanding, filename, model, label`},
+		{&ChartSpec{Facets: []string{"rw", "numjobs"}}, `chart facet numjobs is duplicated with the x-axis, the series or the other facets`},
+		{&ChartSpec{Facets: []string{"rw", "rw"}}, `chart facet rw is duplicated with the x-axis, the series or the other facets`},
+		{&ChartSpec{Metrics: []string{"read_p99"}}, `invalid chart metric "read_p99", eg. read_iops, write_bw, read_lat`},
+	} {
+		_, err = c.spec.Resolve()
+		s.EqualError(err, c.err)
+	}
+}
+
+func (s *chartSpecTestSuite) TestRenderCharts() {
+	newResult := func(filename, model, iodepth string, iops float64) *FioResult {
+		return &FioResult{
+			Jobs: []*FioJob{{
+				JobName:     "randread",
+				JobOptions:  &JobOptions{FileName: filename, RW: "randread", BlockSize: "4K", IODepth: iodepth, NumJobs: "1"},
+				ReadResult:  &ReadResult{IOPSMean: iops},
+				WriteResult: &WriteResult{},
+				TrimResult:  &TrimResult{},
+			}},
+			Device: &Device{Model: model},
+		}
+	}
+	results := []*FioResult{
+		newResult("/dev/vdb", "A", "128", 400), newResult("/dev/vdb", "A", "8", 100), newResult("/dev/vdb", "A", "32", 200),
+		newResult("/dev/vdc", "A", "128", 600), newResult("/dev/vdc", "A", "8", 300),
+		newResult("/dev/vdd", "B", "8", 50),
+	}
+	render := func(spec *ChartSpec) string {
+		chartFile := filepath.Join(s.T().TempDir(), "chart.html")
+		s.Require().NoError(RenderCharts(results, chartFile, Chart2D, spec))
+		data, err := os.ReadFile(chartFile)
+		s.Require().NoError(err)
+		return strings.ReplaceAll(string(data), `,"XAxisIndex":0,"YAxisIndex":0`, "")
+	}
+
+	html := render(&ChartSpec{Preset: "qd-scaling", Metrics: []string{"read_iops"}})
+	s.Equal(1, strings.Count(html, `"text":"readiops-randread-4K-1"`))
+	s.NotContains(html, "writeiops")
+	s.Contains(html, `"name":"iodepth","data":["8","32","128"]`)
+	s.Contains(html, `"data":[{"value":300},{"value":"-"},{"value":600}]`, "/dev/vdc")
+
+	// the devices of the same model are averaged
+	html = render(&ChartSpec{Preset: "qd-scaling", Series: "model", Metrics: []string{"read_iops"}})
+	s.Contains(html, `"data":[{"value":200},{"value":200},{"value":500}]`, "A")
+	s.Contains(html, `"data":[{"value":50},{"value":"-"},{"value":"-"}]`, "B")
+
+	html = render(&ChartSpec{XAxis: "outstanding", Facets: []string{"model"}, Metrics: []string{"read_iops"}})
+	s.Contains(html, `"text":"readiops-A"`)
+	s.Contains(html, `"text":"readiops-B"`)
+	s.Contains(html, `"name":"outstanding_io","data":["8","32","128"]`)
+
+	s.EqualError(RenderCharts(results, "", Chart2D, &ChartSpec{XAxis: "rw"}), `invalid chart x-axis "rw", which should be one of bs, iodepth, numjobs, outstanding`)
+}
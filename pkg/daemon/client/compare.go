@@ -0,0 +1,369 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// CompareRegression is the status of the metric which got worse beyond the threshold.
+	CompareRegression = "regression"
+	// CompareImprovement is the status of the metric which got better beyond the threshold.
+	CompareImprovement = "improvement"
+	// CompareMissing is the status of the job options which are only in the base results.
+	CompareMissing = "missing"
+	// CompareNew is the status of the job options which are only in the target results.
+	CompareNew = "new"
+)
+
+// Thresholds are the changes in percent beyond which the metric is a regression
+// or an improvement, eg. IOPS 5 means the IOPS dropped by more than 5% is a
+// regression and increased by more than 5% is an improvement.
+type Thresholds struct {
+	IOPS    float64 `json:"iops"`
+	BW      float64 `json:"bw"`
+	Latency float64 `json:"latency"` // mean and percentiles of the latency
+}
+
+// MetricDelta is the change of a metric from the base to the target results.
+type MetricDelta struct {
+	Metric string  `json:"metric"` // eg. read-iops, read-bw(KiB/s), latency-read-p99(us)
+	Base   float64 `json:"base"`
+	Target float64 `json:"target"`
+	Delta  float64 `json:"delta"`
+	Change float64 `json:"change"` // percent of the base
+	Status string  `json:"status,omitempty"`
+}
+
+// Comparison is the comparison of the results with the same job options, the
+// metrics are nil if the job options are only in one of the results.
+type Comparison struct {
+	FileName  string         `json:"filename"`
+	RW        string         `json:"rw"`
+	BlockSize string         `json:"bs"`
+	IODepth   string         `json:"iodepth"`
+	NumJobs   string         `json:"numjobs"`
+	Client    string         `json:"client,omitempty"`
+	Status    string         `json:"status,omitempty"` // missing or new
+	Metrics   []*MetricDelta `json:"metrics,omitempty"`
+}
+
+// Regressions returns the number of the regressed metrics.
+func (c *Comparison) Regressions() int {
+	var n int
+	for _, m := range c.Metrics {
+		if m.Status == CompareRegression {
+			n++
+		}
+	}
+	return n
+}
+
+// RegressionError is returned if any metric of the comparisons regressed, or
+// any job options of the base results are missing if they are required.
+type RegressionError struct {
+	Regressions int
+	Missing     int
+}
+
+func (e *RegressionError) Error() string {
+	var msgs []string
+	if e.Regressions > 0 {
+		msgs = append(msgs, fmt.Sprintf("%d metrics regressed", e.Regressions))
+	}
+	if e.Missing > 0 {
+		msgs = append(msgs, fmt.Sprintf("%d job options of the base results are missing", e.Missing))
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// ComparisonError returns the error if any metric regressed, or any job options
+// of the base results are missing and failOnMissing is true.
+func ComparisonError(comparisons []*Comparison, failOnMissing bool) error {
+	err := &RegressionError{}
+	for _, c := range comparisons {
+		err.Regressions += c.Regressions()
+		if failOnMissing && c.Status == CompareMissing {
+			err.Missing++
+		}
+	}
+	if err.Regressions == 0 && err.Missing == 0 {
+		return nil
+	}
+	return err
+}
+
+// compareKey is the job options the results are matched on.
+func compareKey(job *FioJob) string {
+	o := job.JobOptions
+	return strings.Join([]string{o.FileName, o.RW, strings.ToUpper(o.BlockSize), o.IODepth, o.NumJobs, job.Hostname}, "|")
+}
+
+// CompareResults matches the base and the target results on filename, rw, bs,
+// iodepth, numjobs and the fio server of the distributed results, the jobs
+// with the same job options are averaged, eg. the repeated trials. The IOPS,
+// bandwidth, mean latency and the completion latency percentiles reported by
+// both of them are compared for each direction which has IOPS, the metrics
+// whose base is 0 are skipped.
+func CompareResults(base, target []*FioResult, thresholds Thresholds) []*Comparison {
+	baseJobs, targetJobs := groupJobs(base), groupJobs(target)
+	var comparisons []*Comparison
+	for key, jobs := range baseJobs {
+		c := newComparison(jobs[0])
+		if others, ok := targetJobs[key]; ok {
+			c.Metrics = compareJobs(jobs, others, thresholds)
+		} else {
+			c.Status = CompareMissing
+		}
+		comparisons = append(comparisons, c)
+	}
+	for key, jobs := range targetJobs {
+		if _, ok := baseJobs[key]; !ok {
+			c := newComparison(jobs[0])
+			c.Status = CompareNew
+			comparisons = append(comparisons, c)
+		}
+	}
+	sort.Slice(comparisons, func(i, j int) bool {
+		a, b := comparisons[i], comparisons[j]
+		if a.FileName != b.FileName {
+			return a.FileName < b.FileName
+		}
+		if x, y := atoi(a.NumJobs), atoi(b.NumJobs); x != y {
+			return x < y
+		}
+		if x, y := atoi(a.IODepth), atoi(b.IODepth); x != y {
+			return x < y
+		}
+		if a.RW != b.RW {
+			return a.RW < b.RW
+		}
+		if a.BlockSize != b.BlockSize {
+			return a.BlockSize < b.BlockSize
+		}
+		return a.Client < b.Client
+	})
+	return comparisons
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func groupJobs(results []*FioResult) map[string][]*FioJob {
+	groups := make(map[string][]*FioJob)
+	for _, result := range results {
+		for _, job := range result.Jobs {
+			if job.JobOptions == nil {
+				continue
+			}
+			key := compareKey(job)
+			groups[key] = append(groups[key], job)
+		}
+	}
+	return groups
+}
+
+func newComparison(job *FioJob) *Comparison {
+	o := job.JobOptions
+	return &Comparison{FileName: o.FileName, RW: o.RW, BlockSize: o.BlockSize, IODepth: o.IODepth, NumJobs: o.NumJobs, Client: job.Hostname}
+}
+
+// compareJobs compares the mean metrics of the jobs for each direction.
+func compareJobs(base, target []*FioJob, thresholds Thresholds) []*MetricDelta {
+	directions := []struct {
+		name   string
+		result func(job *FioJob) *IOResult
+	}{
+		{"read", func(job *FioJob) *IOResult { return job.ReadResult }},
+		{"write", func(job *FioJob) *IOResult { return job.WriteResult }},
+		{"trim", func(job *FioJob) *IOResult { return job.TrimResult }},
+	}
+	var metrics []*MetricDelta
+	for _, d := range directions {
+		mean := func(jobs []*FioJob, value func(r *IOResult) float64) float64 {
+			var sum float64
+			for _, job := range jobs {
+				if r := d.result(job); r != nil {
+					sum += value(r)
+				}
+			}
+			return sum / float64(len(jobs))
+		}
+		add := func(metric string, value func(r *IOResult) float64, threshold float64, higherIsBetter bool) {
+			m := newMetricDelta(metric, mean(base, value), mean(target, value), threshold, higherIsBetter)
+			if m != nil {
+				metrics = append(metrics, m)
+			}
+		}
+		iops := func(r *IOResult) float64 { return r.IOPSMean }
+		if mean(base, iops) == 0 && mean(target, iops) == 0 {
+			continue
+		}
+		add(d.name+"-iops", iops, thresholds.IOPS, true)
+		add(d.name+"-bw(KiB/s)", func(r *IOResult) float64 { return r.BWMean }, thresholds.BW, true)
+		add(fmt.Sprintf("latency-%s-mean(us)", d.name), func(r *IOResult) float64 { return r.LatencyNs.Mean / 1000 }, thresholds.Latency, false)
+		for _, p := range commonPercentiles(base, target, d.result) {
+			p := p
+			add(PercentileHeader(d.name, p), func(r *IOResult) float64 { return r.Percentile(p) / 1000 }, thresholds.Latency, false)
+		}
+	}
+	return metrics
+}
+
+// commonPercentiles returns the sorted percentiles reported by all the jobs.
+func commonPercentiles(base, target []*FioJob, result func(job *FioJob) *IOResult) []float64 {
+	counts := make(map[string]int)
+	jobs := append(append([]*FioJob{}, base...), target...)
+	for _, job := range jobs {
+		r := result(job)
+		if r == nil {
+			return nil
+		}
+		for key := range r.ClatNs.Percentile {
+			counts[key]++
+		}
+	}
+	var percentiles []float64
+	for key, n := range counts {
+		if n != len(jobs) {
+			continue
+		}
+		if p, err := strconv.ParseFloat(key, 64); err == nil {
+			percentiles = append(percentiles, p)
+		}
+	}
+	sort.Float64s(percentiles)
+	return percentiles
+}
+
+// newMetricDelta returns the change of the metric, which is nil if the base is 0.
+func newMetricDelta(metric string, base, target, threshold float64, higherIsBetter bool) *MetricDelta {
+	if base == 0 {
+		return nil
+	}
+	m := &MetricDelta{Metric: metric, Base: base, Target: target, Delta: target - base}
+	m.Change = m.Delta / base * 100
+	better := m.Change
+	if !higherIsBetter {
+		better = -better
+	}
+	switch {
+	case better < -threshold:
+		m.Status = CompareRegression
+	case better > threshold:
+		m.Status = CompareImprovement
+	}
+	return m
+}
+
+// RenderComparisons renders the comparisons in the format of table, markdown,
+// csv, html or json, one row for each metric. The regressions are marked with
+// "!" in the table format.
+func RenderComparisons(comparisons []*Comparison, w io.Writer, format string) {
+	if strings.ToLower(format) == "json" {
+		data, err := json.MarshalIndent(comparisons, "", "  ")
+		if err != nil {
+			klog.Errorf("Failed to marshal the comparisons: %v", err)
+			return
+		}
+		fmt.Fprintln(w, string(data))
+		return
+	}
+	var distributed bool
+	for _, c := range comparisons {
+		distributed = distributed || c.Client != ""
+	}
+	t := table.NewWriter()
+	t.SetOutputMirror(w)
+	header := table.Row{"filename", "rw", "numjobs", "blocksize", "iodepth", "metric", "base", "target", "delta", "change(%)", "status"}
+	if distributed {
+		header = append(table.Row{ClientHeader}, header...)
+	}
+	t.AppendHeader(header)
+	plain := strings.ToLower(format) == "csv"
+	for _, c := range comparisons {
+		rows := []table.Row{}
+		if len(c.Metrics) == 0 {
+			rows = append(rows, table.Row{c.FileName, c.RW, c.NumJobs, c.BlockSize, c.IODepth, "", "", "", "", "", c.Status})
+		}
+		for _, m := range c.Metrics {
+			status := m.Status
+			if status == CompareRegression && !plain {
+				status = "! " + status
+			}
+			rows = append(rows, table.Row{c.FileName, c.RW, c.NumJobs, c.BlockSize, c.IODepth, m.Metric,
+				m.Base, m.Target, m.Delta, strconv.FormatFloat(m.Change, 'f', 2, 64), status})
+		}
+		for _, row := range rows {
+			if distributed {
+				row = append(table.Row{c.Client}, row...)
+			}
+			t.AppendRow(row)
+		}
+		t.AppendSeparator()
+	}
+	switch strings.ToLower(format) {
+	case "md", "markdown":
+		t.RenderMarkdown()
+	case "csv":
+		t.RenderCSV()
+	case "html":
+		t.RenderHTML()
+	default:
+		t.Render()
+	}
+}
+
+// LoadResults loads the results from the file rendered in csv or json format,
+// or the output of fio --output-format json.
+func LoadResults(path string) ([]*FioResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return ParseCSVResults(bytes.NewReader(data))
+	}
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("[")) {
+		var results []*FioResult
+		if err = json.Unmarshal(data, &results); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse results of %s", path)
+		}
+		return results, nil
+	}
+	var output struct {
+		Results []*FioResult `json:"results"`
+	}
+	if err = json.Unmarshal(data, &output); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse results of %s", path)
+	}
+	if output.Results != nil {
+		return output.Results, nil
+	}
+	var result FioResult
+	if err = json.Unmarshal(data, &result); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse results of %s", path)
+	}
+	if len(result.ClientStats) > 0 {
+		if err = result.collectClientStats(); err != nil {
+			return nil, err
+		}
+	}
+	if len(result.Jobs) == 0 {
+		return nil, errors.Errorf("no results in %s", path)
+	}
+	return []*FioResult{&result}, nil
+}
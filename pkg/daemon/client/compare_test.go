@@ -0,0 +1,114 @@
+package client
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestCompareSuite(t *testing.T) {
+	suite.Run(t, new(compareTestSuite))
+}
+
+type compareTestSuite struct {
+	suite.Suite
+}
+
+func withP99(result *FioResult, us float64) *FioResult {
+	result.Jobs[0].ReadResult.ClatNs.Percentile = map[string]float64{PercentileKey(99): us * 1000}
+	return result
+}
+
+func (s *compareTestSuite) TestCompareResults() {
+	base := []*FioResult{
+		withP99(newTrial("/dev/vdb", "randread", 1000, 0), 500),
+		withP99(newTrial("/dev/vdb", "randread", 1200, 0), 700), // averaged with the above
+		newTrial("/dev/vdc", "randrw", 500, 500),
+		newTrial("/dev/vdd", "randread", 100, 0),
+	}
+	target := []*FioResult{
+		withP99(newTrial("/dev/vdb", "randread", 1050, 0), 800),
+		newTrial("/dev/vdc", "randrw", 600, 400),
+		newTrial("/dev/vde", "randread", 100, 0),
+	}
+	target[1].Jobs[0].JobOptions.BlockSize = "4k"
+	comparisons := CompareResults(base, target, Thresholds{IOPS: 5, BW: 5, Latency: 10})
+	s.Len(comparisons, 4)
+
+	vdb := comparisons[0]
+	s.Equal("/dev/vdb", vdb.FileName)
+	metrics := make(map[string]*MetricDelta)
+	for _, m := range vdb.Metrics {
+		metrics[m.Metric] = m
+	}
+	s.Len(metrics, 4, "the write direction is skipped since it has no IOPS")
+	s.InDelta(1100, metrics["read-iops"].Base, 1e-9)
+	s.InDelta(-50, metrics["read-iops"].Delta, 1e-9)
+	s.InDelta(-4.545, metrics["read-iops"].Change, 1e-3)
+	s.Empty(metrics["read-iops"].Status)
+	s.Empty(metrics["latency-read-mean(us)"].Status)
+	p99 := metrics[PercentileHeader("read", 99)]
+	s.InDelta(600, p99.Base, 1e-9)
+	s.InDelta(33.333, p99.Change, 1e-3)
+	s.Equal(CompareRegression, p99.Status)
+	s.Equal(1, vdb.Regressions())
+
+	vdc := comparisons[1]
+	s.Equal("/dev/vdc", vdc.FileName, "bs is matched case-insensitively")
+	statuses := make(map[string]string)
+	for _, m := range vdc.Metrics {
+		statuses[m.Metric] = m.Status
+	}
+	s.Equal(CompareImprovement, statuses["read-iops"])
+	s.Equal(CompareRegression, statuses["write-iops"])
+	s.Equal(CompareRegression, statuses["write-bw(KiB/s)"])
+	s.Equal(CompareMissing, comparisons[2].Status)
+	s.Equal("/dev/vdd", comparisons[2].FileName)
+	s.Equal(CompareNew, comparisons[3].Status)
+
+	var buf bytes.Buffer
+	RenderComparisons(comparisons, &buf, "csv")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	s.Equal("filename,rw,numjobs,blocksize,iodepth,metric,base,target,delta,change(%),status", lines[0])
+	s.Contains(buf.String(), "/dev/vdb,randread,1,4K,8,latency-read-p99(us),600,800,200,33.33,regression")
+	s.Contains(buf.String(), "/dev/vde,randread,1,4K,8,,,,,,new")
+	buf.Reset()
+	RenderComparisons(comparisons, &buf, "table")
+	s.Contains(buf.String(), "! regression")
+
+	var regressionErr *RegressionError
+	s.ErrorAs(ComparisonError(comparisons, false), &regressionErr)
+	s.Equal(&RegressionError{Regressions: 3}, regressionErr)
+	s.EqualError(ComparisonError(comparisons, true), "3 metrics regressed, 1 job options of the base results are missing")
+	s.EqualError(ComparisonError(comparisons[2:], true), "1 job options of the base results are missing")
+	s.NoError(ComparisonError(comparisons[2:], false))
+}
+
+func (s *compareTestSuite) TestLoadResults() {
+	dir := s.T().TempDir()
+	results := []*FioResult{newTrial("/dev/vdb", "randread", 1000, 0)}
+	var buf bytes.Buffer
+	RenderResults(results, &buf, "csv", nil, false)
+	files := map[string]string{
+		"results.csv":  buf.String(),
+		"fio.json":     `{"fio version": "fio-3.27", "jobs": [{"jobname": "a", "job options": {"filename": "/dev/vdb"}}]}`,
+		"output.json":  `{"results": [{"jobs": [{"jobname": "a", "job options": {"filename": "/dev/vdb"}}]}]}`,
+		"results.json": `[{"jobs": [{"jobname": "a", "job options": {"filename": "/dev/vdb"}}]}]`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		s.NoError(os.WriteFile(path, []byte(content), 0644))
+		loaded, err := LoadResults(path)
+		s.NoError(err, name)
+		s.Len(loaded, 1, name)
+		s.Equal("/dev/vdb", loaded[0].Jobs[0].JobOptions.FileName, name)
+	}
+	path := filepath.Join(dir, "empty.json")
+	s.NoError(os.WriteFile(path, []byte(`{}`), 0644))
+	_, err := LoadResults(path)
+	s.Error(err)
+}
@@ -0,0 +1,148 @@
+package client
+
+import (
+	"encoding/csv"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	percentileHeader = regexp.MustCompile(`^latency-(read|write|trim)-p([0-9.]+)\(us\)$`)
+)
+
+// csvFields maps the CSV headers to the setters of the job, latencies are
+// rendered in microseconds and converted back to nanoseconds.
+var csvFields = map[string]func(job *FioJob, value string){
+	"filename":  func(job *FioJob, value string) { job.JobOptions.FileName = value },
+	"rw":        func(job *FioJob, value string) { job.JobOptions.RW = value },
+	"numjobs":   func(job *FioJob, value string) { job.JobOptions.NumJobs = value },
+	"runtime":   func(job *FioJob, value string) { job.JobOptions.Runtime = value },
+	"direct":    func(job *FioJob, value string) { job.JobOptions.Direct = value },
+	"blocksize": func(job *FioJob, value string) { job.JobOptions.BlockSize = value },
+	"iodepth":   func(job *FioJob, value string) { job.JobOptions.IODepth = value },
+	"ioengine":  func(job *FioJob, value string) { job.JobOptions.IOEngine = value },
+	"verify":    func(job *FioJob, value string) { job.JobOptions.Verify = value },
+
+	"read-iops-mean":        func(job *FioJob, value string) { job.ReadResult.IOPSMean = parseFloat(value) },
+	"read-bw-mean(KiB/s)":   func(job *FioJob, value string) { job.ReadResult.BWMean = parseFloat(value) },
+	"latency-read-min(us)":  func(job *FioJob, value string) { job.ReadResult.LatencyNs.Min = parseFloat(value) * 1000 },
+	"latency-read-max(us)":  func(job *FioJob, value string) { job.ReadResult.LatencyNs.Max = parseFloat(value) * 1000 },
+	"latency-read-mean(us)": func(job *FioJob, value string) { job.ReadResult.LatencyNs.Mean = parseFloat(value) * 1000 },
+	"read-stddev(us)":       func(job *FioJob, value string) { job.ReadResult.LatencyNs.Stddev = parseFloat(value) * 1000 },
+
+	"write-iops-mean":          func(job *FioJob, value string) { job.WriteResult.IOPSMean = parseFloat(value) },
+	"write-bw-mean(KiB/s)":     func(job *FioJob, value string) { job.WriteResult.BWMean = parseFloat(value) },
+	"latency-write-min(us)":    func(job *FioJob, value string) { job.WriteResult.LatencyNs.Min = parseFloat(value) * 1000 },
+	"latency-write-max(us)":    func(job *FioJob, value string) { job.WriteResult.LatencyNs.Max = parseFloat(value) * 1000 },
+	"latency-write-mean(us)":   func(job *FioJob, value string) { job.WriteResult.LatencyNs.Mean = parseFloat(value) * 1000 },
+	"latency-write-stddev(us)": func(job *FioJob, value string) { job.WriteResult.LatencyNs.Stddev = parseFloat(value) * 1000 },
+}
+
+func parseFloat(value string) float64 {
+	f, _ := strconv.ParseFloat(value, 64)
+	return f
+}
+
+// ParseCSVResults parses the results rendered in CSV format, the unknown columns are ignored.
+//
+//	filename,rw,numjobs,runtime,direct,blocksize,iodepth,read-iops-mean,read-bw-mean(KiB/s),latency-read-min(us),latency-read-max(us),latency-read-mean(us),read-stddev(us),write-iops-mean,write-bw-mean(KiB/s),latency-write-min(us),latency-write-max(us),latency-write-mean(us),latency-write-stddev(us),ioengine,verify
+//	/dev/nvme0n1,randread,1,120s,1,4K,1,13369.941423,53479.774059,54,6039,74.393800365,11.089774646,0,0,0,0,0,0,libaio,
+func ParseCSVResults(r io.Reader) ([]*FioResult, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("empty csv file")
+	}
+	setters := make([]func(job *FioJob, value string), len(records[0]))
+	metadata := make(map[int]*MetadataColumn)
+	for i, header := range records[0] {
+		for _, columns := range [][]*MetadataColumn{DeviceColumns, HostColumns} {
+			for _, c := range columns {
+				if c.Header == header {
+					metadata[i] = c
+				}
+			}
+		}
+	}
+	var known int
+	knee, tuning := -1, -1
+	for i, header := range records[0] {
+		if setter, ok := csvFields[header]; ok {
+			setters[i] = setter
+			known++
+			continue
+		}
+		if header == KneeHeader {
+			knee = i
+			continue
+		}
+		if header == TuningHeader {
+			tuning = i
+			continue
+		}
+		if header == ClientHeader {
+			setters[i] = func(job *FioJob, value string) { job.Hostname = value }
+			continue
+		}
+		if m := percentileHeader.FindStringSubmatch(header); m != nil {
+			setters[i] = percentileSetter(m[1], m[2])
+		}
+	}
+	if known != len(csvFields) {
+		return nil, errors.Errorf("Invalid csv format")
+	}
+	var results []*FioResult
+	for _, record := range records[1:] {
+		job := &FioJob{
+			JobOptions:  &JobOptions{},
+			ReadResult:  &ReadResult{},
+			WriteResult: &WriteResult{},
+			TrimResult:  &TrimResult{},
+		}
+		for i, value := range record {
+			if setters[i] != nil {
+				setters[i](job, value)
+			}
+		}
+		job.JobName = job.JobOptions.FileName
+		result := &FioResult{Jobs: []*FioJob{job}}
+		if knee >= 0 && knee < len(record) {
+			result.Knee, _ = strconv.ParseBool(record[knee])
+		}
+		if tuning >= 0 && tuning < len(record) && record[tuning] != "" {
+			result.Tuning = strings.Split(record[tuning], ",")
+		}
+		for i, c := range metadata {
+			if i < len(record) && record[i] != "" {
+				c.Set(result, record[i])
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func percentileSetter(direction, percentile string) func(job *FioJob, value string) {
+	key := PercentileKey(parseFloat(percentile))
+	return func(job *FioJob, value string) {
+		var result *IOResult
+		switch direction {
+		case "read":
+			result = job.ReadResult
+		case "write":
+			result = job.WriteResult
+		default:
+			result = job.TrimResult
+		}
+		if result.ClatNs.Percentile == nil {
+			result.ClatNs.Percentile = make(map[string]float64)
+		}
+		result.ClatNs.Percentile[key] = parseFloat(value) * 1000
+	}
+}
@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/microyahoo/fio-benchmark/pkg/util/exec"
+)
+
+const (
+	// ClientHeader is the header of the column of the fio server of the distributed results.
+	ClientHeader = "client"
+	// AllClients is the hostname of the cluster-wide job of the distributed results.
+	AllClients = "all"
+
+	// allClientsJobName is the job name of the stats summed over all the clients by fio
+	allClientsJobName = "All clients"
+)
+
+// FioClientTest runs the fio job on the fio servers of the hosts at once by fio
+// --client, the hosts are in the format of host or host,port, eg. 10.0.0.1,8765.
+// The arguments in the format of FioTestArgs are written into a job file which
+// is sent to the servers. The jobs of the result are the cluster-wide job
+// followed by the job of each host, the cluster-wide job is only reported if
+// there are more than one hosts.
+//
+//	fio --output-format json --client=10.0.0.1 job.fio --client=10.0.0.2 job.fio
+func FioClientTest(ctx context.Context, executor exec.Executor, hosts []string, args []string, dryrun bool) (*FioResult, error) {
+	if len(hosts) == 0 {
+		return nil, errors.New("no host is specified")
+	}
+	content := clientJobFile(args)
+	f, err := os.CreateTemp("", "fio-benchmark-*.fio")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(content)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to write job file %s", f.Name())
+	}
+	clientArgs := []string{"--output-format", "json"}
+	for _, host := range hosts {
+		clientArgs = append(clientArgs, "--client="+host, f.Name())
+	}
+	if dryrun {
+		klog.Infof("Job file %s:\n%s", f.Name(), content)
+	}
+	result, err := runFio(ctx, executor, clientArgs, dryrun)
+	if err != nil || result == nil {
+		return result, err
+	}
+	if err = result.collectClientStats(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// clientJobFile converts the fio arguments to a job file, the output format is
+// left to the fio client.
+func clientJobFile(args []string) string {
+	name := "fio-benchmark"
+	var options []string
+	for i := 0; i < len(args); i++ {
+		key := strings.TrimPrefix(args[i], "--")
+		var value string
+		hasValue := false
+		if k, v, ok := strings.Cut(key, "="); ok {
+			key, value, hasValue = k, v, true
+		} else if i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
+			value, hasValue = args[i+1], true
+			i++
+		}
+		switch key {
+		case "name":
+			name = value
+			continue
+		case "output-format":
+			continue
+		}
+		if hasValue {
+			options = append(options, key+"="+value)
+		} else {
+			options = append(options, key)
+		}
+	}
+	return fmt.Sprintf("[%s]\n%s\n", name, strings.Join(options, "\n"))
+}
+
+// collectClientStats moves the client stats into the jobs, the cluster-wide job
+// is the first one, whose hostname is AllClients and the job options are the
+// same as the hosts.
+func (r *FioResult) collectClientStats() error {
+	if len(r.ClientStats) == 0 {
+		return errors.New("no client stats in the result of fio --client")
+	}
+	var all *FioJob
+	var jobs []*FioJob
+	for _, job := range r.ClientStats {
+		if job.JobName == allClientsJobName {
+			all = job
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	if all != nil {
+		all.Hostname, all.Port = AllClients, 0
+		if all.JobOptions == nil && len(jobs) > 0 && jobs[0].JobOptions != nil {
+			options := *jobs[0].JobOptions
+			all.JobOptions = &options
+		}
+		jobs = append([]*FioJob{all}, jobs...)
+	}
+	r.Jobs = jobs
+	r.ClientStats = nil
+	return nil
+}
+
+// SummaryJobs returns the cluster-wide jobs of the distributed result, which are
+// all the jobs if the result isn't distributed or there is only one host.
+func (r *FioResult) SummaryJobs() []*FioJob {
+	for _, job := range r.Jobs {
+		if job.Hostname == AllClients {
+			return []*FioJob{job}
+		}
+	}
+	return r.Jobs
+}
+
+// Distributed returns true if any job of the results is run by fio --client.
+func Distributed(results []*FioResult) bool {
+	for _, result := range results {
+		for _, job := range result.Jobs {
+			if job.Hostname != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,198 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/microyahoo/fio-benchmark/pkg/util/exec"
+	exectest "github.com/microyahoo/fio-benchmark/pkg/util/exec/test"
+)
+
+func TestDistributedSuite(t *testing.T) {
+	suite.Run(t, new(distributedTestSuite))
+}
+
+type distributedTestSuite struct {
+	suite.Suite
+}
+
+func clientStat(jobname, hostname string, iops float64, options string) string {
+	return fmt.Sprintf(`{"jobname": %q, "hostname": %q, "port": 8765, %s
+		"read": {"iops_mean": %v, "clat_ns": {"percentile": {"99.000000": 1000}}}, "write": {}, "trim": {}}`,
+		jobname, hostname, options, iops)
+}
+
+func (s *distributedTestSuite) TestClientJobFile() {
+	args := FioTestArgs("/dev/vdb", 2, "4K", 8, "randread", 60, "", false, true, "--percentile_list", "99:99.9", "--latency_target=2ms")
+	content := clientJobFile(args)
+	lines := strings.Split(strings.TrimSpace(content), "\n")
+	s.True(strings.HasPrefix(lines[0], "[randread-"))
+	s.Equal([]string{
+		"filename=/dev/vdb",
+		"numjobs=2",
+		"time_based",
+		"ioengine=libaio",
+		"bs=4K",
+		"rw=randread",
+		"direct=1",
+		"group_reporting",
+		"iodepth=8",
+		"runtime=60s",
+		"verify=0",
+		"percentile_list=99:99.9",
+		"latency_target=2ms",
+	}, lines[1:])
+}
+
+func (s *distributedTestSuite) TestFioClientTest() {
+	var (
+		args    []string
+		jobFile string
+	)
+	options := `"job options": {"filename": "/dev/vdb", "rw": "randread", "bs": "4K", "iodepth": "8", "numjobs": "1"},`
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithContext: func(ctx context.Context, command string, arg ...string) (string, error) {
+			args = arg
+			data, err := os.ReadFile(arg[3])
+			s.NoError(err)
+			jobFile = string(data)
+			return fmt.Sprintf(`{"fio version": "fio-3.27", "client_stats": [%s, %s, %s]}`,
+				clientStat("randread", "node1", 1000, options),
+				clientStat("randread", "node2", 2000, options),
+				clientStat(allClientsJobName, "node2", 3000, "")), nil
+		},
+	}
+	fioArgs := FioTestArgs("/dev/vdb", 1, "4K", 8, "randread", 10, "libaio", false, true)
+	result, err := FioClientTest(context.TODO(), executor, []string{"node1", "node2,8766"}, fioArgs, false)
+	s.NoError(err)
+	s.Equal("--output-format", args[0])
+	s.Equal("--client=node1", args[2])
+	s.Equal("--client=node2,8766", args[4])
+	s.Equal(args[3], args[5])
+	s.Contains(jobFile, "\nfilename=/dev/vdb\n")
+	s.NoFileExists(args[3])
+
+	s.Nil(result.ClientStats)
+	s.Len(result.Jobs, 3)
+	s.Equal(AllClients, result.Jobs[0].Hostname)
+	s.Equal("/dev/vdb", result.Jobs[0].JobOptions.FileName)
+	s.Equal("node1", result.Jobs[1].Hostname)
+	s.Equal("node2", result.Jobs[2].Hostname)
+	s.Equal([]*FioJob{result.Jobs[0]}, result.SummaryJobs())
+	s.True(Distributed([]*FioResult{result}))
+
+	var buf bytes.Buffer
+	RenderResults([]*FioResult{result}, &buf, "csv", nil, false)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	s.Len(lines, 4)
+	s.True(strings.HasPrefix(lines[0], "client,filename,rw,"))
+	s.True(strings.HasPrefix(lines[1], "all,/dev/vdb,randread,1,"))
+	s.True(strings.HasPrefix(lines[2], "node1,/dev/vdb,randread,1,"))
+
+	parsed, err := ParseCSVResults(&buf)
+	s.NoError(err)
+	s.Len(parsed, 3)
+	s.Equal(AllClients, parsed[0].Jobs[0].Hostname)
+
+	results := []*FioResult{result, result}
+	aggregated := AggregateResults(results, 10)
+	s.Len(aggregated, 3)
+	s.Equal(AllClients, aggregated[0].Client)
+	s.Equal(AllClients, aggregated[0].MeanResult().Jobs[0].Hostname)
+	s.InDelta(3000, aggregated[0].Directions[0].IOPS.Mean, 1e-9)
+
+	_, err = FioClientTest(context.TODO(), executor, nil, fioArgs, false)
+	s.Error(err)
+	executor.MockExecuteCommandWithContext = func(ctx context.Context, command string, arg ...string) (string, error) {
+		return `{"fio version": "fio-3.27", "jobs": []}`, nil
+	}
+	_, err = FioClientTest(context.TODO(), executor, []string{"node1"}, fioArgs, false)
+	s.Error(err)
+}
+
+// freePort returns a free tcp port of the loopback address.
+func (s *distributedTestSuite) TestSummaryCharts() {
+	job := func(hostname string, iops float64) *FioJob {
+		return &FioJob{
+			JobName:     "randread",
+			Hostname:    hostname,
+			JobOptions:  &JobOptions{FileName: "/dev/vdb", RW: "randread", BlockSize: "4K", IODepth: "8", NumJobs: "1"},
+			ReadResult:  &ReadResult{IOPSMean: iops, ClatNs: LatencyNs{Percentile: map[string]float64{"99.000000": 1000}}},
+			WriteResult: &WriteResult{},
+			TrimResult:  &TrimResult{},
+			LatencyUs:   map[string]float64{"100": 100},
+		}
+	}
+	results := []*FioResult{{Jobs: []*FioJob{job(AllClients, 300), job("node1", 100), job("node2", 200)}}}
+
+	points := latencyPoints(results)
+	s.Require().Len(points, 1)
+	s.Equal([]string{"/dev/vdb@" + AllClients}, points[0].series)
+
+	// the per-host jobs aren't mixed into the charts of the cluster-wide job
+	for _, chartType := range []string{Chart2D, Chart3D} {
+		chartFile := filepath.Join(s.T().TempDir(), "chart.html")
+		s.NoError(RenderCharts(results, chartFile, chartType, nil))
+		data, err := os.ReadFile(chartFile)
+		s.NoError(err)
+		s.Contains(string(data), "@"+AllClients, chartType)
+		s.NotContains(string(data), "node1", chartType)
+		s.NotContains(string(data), "node2", chartType)
+	}
+}
+
+func freePort(s *suite.Suite) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Require().NoError(err)
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// TestLoopback runs the job on the fio servers listening on the loopback
+// address, which is skipped if fio isn't installed.
+func (s *distributedTestSuite) TestLoopback() {
+	if _, err := osexec.LookPath(FioTool); err != nil {
+		s.T().Skip("fio is not installed")
+	}
+	var hosts []string
+	for i := 0; i < 2; i++ {
+		host := fmt.Sprintf("127.0.0.1,%d", freePort(&s.Suite))
+		server := osexec.Command(FioTool, "--server="+host)
+		s.Require().NoError(server.Start())
+		defer func() {
+			_ = server.Process.Kill()
+			_ = server.Wait()
+		}()
+		hosts = append(hosts, host)
+	}
+	for _, host := range hosts {
+		addr := strings.Replace(host, ",", ":", 1)
+		s.Require().Eventually(func() bool {
+			conn, err := net.Dial("tcp", addr)
+			if err == nil {
+				conn.Close()
+			}
+			return err == nil
+		}, 10*time.Second, 100*time.Millisecond)
+	}
+	filename := filepath.Join(s.T().TempDir(), "fio.db")
+	args := FioTestArgs(filename, 1, "4K", 1, "randread", 1, "psync", false, false, "--size", "4M")
+	result, err := FioClientTest(context.TODO(), &exec.CommandExecutor{}, hosts, args, false)
+	s.Require().NoError(err)
+	s.Len(result.Jobs, 3)
+	s.Equal(AllClients, result.Jobs[0].Hostname)
+	for _, job := range result.Jobs {
+		s.Equal(filename, job.JobOptions.FileName)
+		s.Greater(job.ReadResult.IOPSMean, 0.0)
+	}
+}
@@ -1,22 +1,33 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/go-echarts/go-echarts/v2/charts"
 	"github.com/go-echarts/go-echarts/v2/components"
 	"github.com/go-echarts/go-echarts/v2/opts"
+	"github.com/go-echarts/go-echarts/v2/types"
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
 	"k8s.io/klog/v2"
 
 	"github.com/microyahoo/fio-benchmark/pkg/util/exec"
+	"github.com/microyahoo/fio-benchmark/pkg/util/sys"
 )
 
 // fio --name=write_throughput --filename=/dev/vdb --numjobs=8 --time_based --runtime=100s --ioengine=libaio --direct=1 --verify=0 --bs=4K --iodepth=1 --rw=randwrite --group_reporting=1
-func FioTest(executor exec.Executor, filename string, numJobs int32, bs string, iodepth int32, rw string, runtime uint64, ioengine string, verify, direct, dryrun bool) (*FioResult, error) {
+func FioTest(ctx context.Context, executor exec.Executor, filename string, numJobs int32, bs string, iodepth int32, rw string, runtime uint64, ioengine string, verify, direct, dryrun bool, extraArgs ...string) (*FioResult, error) {
+	args := FioTestArgs(filename, numJobs, bs, iodepth, rw, runtime, ioengine, verify, direct, extraArgs...)
+	return runFio(ctx, executor, args, dryrun)
+}
+
+// FioTestArgs returns the fio arguments of FioTest.
+func FioTestArgs(filename string, numJobs int32, bs string, iodepth int32, rw string, runtime uint64, ioengine string, verify, direct bool, extraArgs ...string) []string {
 	name := fmt.Sprintf("%s-%s", rw, uuid.NewString())
 	if ioengine == "" {
 		ioengine = "libaio"
@@ -41,11 +52,36 @@ func FioTest(executor exec.Executor, filename string, numJobs int32, bs string,
 	if !verify {
 		args = append(args, "--verify", "0")
 	}
+	return append(args, extraArgs...)
+}
+
+// FioJobTest runs a job parsed from fio job file.
+func FioJobTest(ctx context.Context, executor exec.Executor, job *JobSection, dryrun bool, extraArgs ...string) (*FioResult, error) {
+	return runFio(ctx, executor, FioJobArgs(job, extraArgs...), dryrun)
+}
+
+// FioJobArgs returns the fio arguments of FioJobTest.
+func FioJobArgs(job *JobSection, extraArgs ...string) []string {
+	args := []string{"--name", job.Name}
+	for _, option := range job.Options {
+		key, _ := splitOption(option)
+		switch key {
+		case "name", "stonewall", "wait_for_previous", "group_reporting", "output-format":
+			// these are controlled by fio-benchmark
+			continue
+		}
+		args = append(args, "--"+option)
+	}
+	args = append(args, "--group_reporting", "--output-format", "json")
+	return append(args, extraArgs...)
+}
+
+func runFio(ctx context.Context, executor exec.Executor, args []string, dryrun bool) (*FioResult, error) {
 	if dryrun {
 		klog.Infof("Running command: %s %s", FioTool, strings.Join(args, " "))
 		return nil, nil
 	}
-	output, err := executor.ExecuteCommandWithOutput(FioTool, args...)
+	output, err := executor.ExecuteCommandWithContext(ctx, FioTool, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -342,14 +378,83 @@ func DropCaches(executor exec.Executor) error {
 //	  ]
 //	}
 type FioResult struct {
-	Jobs []*FioJob `json:"jobs"`
+	FioVersion  string      `json:"fio version"`
+	Timestamp   int64       `json:"timestamp"`
+	TimestampMs int64       `json:"timestamp_ms"`
+	Time        string      `json:"time"`
+	Jobs        []*FioJob   `json:"jobs"`
+	DiskUtil    []*DiskUtil `json:"disk_util,omitempty"`
+
+	// Knee is set by fio-benchmark if the throughput stops improving after
+	// this result while the latency keeps climbing
+	Knee bool `json:"knee,omitempty"`
+
+	// Precondition is set by fio-benchmark if the device was preconditioned
+	// before the result was measured
+	Precondition *Precondition `json:"precondition,omitempty"`
+
+	// Device and Host are the snapshot of the device and the host which are set
+	// by fio-benchmark when the result was measured
+	Device *Device       `json:"device,omitempty"`
+	Host   *sys.HostInfo `json:"host,omitempty"`
+
+	// Tuning are the block queue attributes which were written by fio-benchmark
+	// before the result was measured, eg. scheduler=none
+	Tuning []string `json:"tuning,omitempty"`
+
+	// Label is the label of the run which is set by fio-benchmark, eg. the
+	// kernel or the firmware under test, so that the runs can be charted together
+	Label string `json:"label,omitempty"`
+
+	// TimeSeries are the per-interval samples of each direction which are set
+	// by fio-benchmark if log_avg_msec is specified
+	TimeSeries []*TimeSeries `json:"time_series,omitempty"`
+
+	// ClientStats are the jobs of the fio servers reported by fio --client,
+	// which are moved into Jobs by FioClientTest
+	ClientStats []*FioJob `json:"client_stats,omitempty"`
 }
 
 type FioJob struct {
 	JobName     string       `json:"jobname"`
+	GroupID     int32        `json:"groupid"`
+	Error       int32        `json:"error"`
+	Eta         int64        `json:"eta"`
+	Elapsed     int64        `json:"elapsed"`
 	JobOptions  *JobOptions  `json:"job options"`
 	ReadResult  *ReadResult  `json:"read"`
 	WriteResult *WriteResult `json:"write"`
+	TrimResult  *TrimResult  `json:"trim"`
+	SyncResult  *SyncResult  `json:"sync"`
+	JobRuntime  uint64       `json:"job_runtime"` // ms
+	UsrCPU      float64      `json:"usr_cpu"`     // percentage
+	SysCPU      float64      `json:"sys_cpu"`     // percentage
+	Ctx         uint64       `json:"ctx"`         // context switches
+	Majf        uint64       `json:"majf"`        // major page faults
+	Minf        uint64       `json:"minf"`        // minor page faults
+
+	// distribution of the io depths, keyed by depth, eg. "1", "2", ">=64"
+	IODepthLevel    map[string]float64 `json:"iodepth_level"`
+	IODepthSubmit   map[string]float64 `json:"iodepth_submit"`
+	IODepthComplete map[string]float64 `json:"iodepth_complete"`
+
+	// distribution of the completion latencies, keyed by the bucket upper bound, eg. "2", "750", ">=2000"
+	LatencyNs map[string]float64 `json:"latency_ns"`
+	LatencyUs map[string]float64 `json:"latency_us"`
+	LatencyMs map[string]float64 `json:"latency_ms"`
+
+	LatencyDepth      int32   `json:"latency_depth"`
+	LatencyTarget     uint64  `json:"latency_target"`
+	LatencyPercentile float64 `json:"latency_percentile"`
+	LatencyWindow     uint64  `json:"latency_window"`
+
+	// SteadyState is only reported if the steadystate option is specified
+	SteadyState *SteadyState `json:"steadystate,omitempty"`
+
+	// Hostname and Port are the fio server of the job which are only reported
+	// by fio --client, the hostname of the cluster-wide job is AllClients
+	Hostname string `json:"hostname,omitempty"`
+	Port     int32  `json:"port,omitempty"`
 }
 
 type JobOptions struct {
@@ -365,13 +470,61 @@ type JobOptions struct {
 	RW        string `json:"rw"`
 }
 
-type ReadResult struct {
-	IOPSMean  float64   `json:"iops_mean"`
-	BWMean    float64   `json:"bw_mean"`
+// IOResult is the statistics of read, write or trim of a job.
+type IOResult struct {
+	IOBytes     uint64    `json:"io_bytes"`
+	IOKBytes    uint64    `json:"io_kbytes"`
+	BWBytes     uint64    `json:"bw_bytes"` // B/s
+	BW          uint64    `json:"bw"`       // KiB/s
+	IOPS        float64   `json:"iops"`
+	Runtime     uint64    `json:"runtime"` // ms
+	TotalIOs    uint64    `json:"total_ios"`
+	ShortIOs    uint64    `json:"short_ios"`
+	DropIOs     uint64    `json:"drop_ios"`
+	SlatNs      LatencyNs `json:"slat_ns"` // submission latency
+	ClatNs      LatencyNs `json:"clat_ns"` // completion latency
+	LatencyNs   LatencyNs `json:"lat_ns"`  // total latency
+	BWMin       float64   `json:"bw_min"`  // KiB/s
+	BWMax       float64   `json:"bw_max"`
+	BWAgg       float64   `json:"bw_agg"` // percentage of the group aggregate bandwidth
+	BWMean      float64   `json:"bw_mean"`
+	BWDev       float64   `json:"bw_dev"`
+	BWSamples   uint64    `json:"bw_samples"`
+	IOPSMin     float64   `json:"iops_min"`
+	IOPSMax     float64   `json:"iops_max"`
+	IOPSMean    float64   `json:"iops_mean"`
+	IOPSStddev  float64   `json:"iops_stddev"`
+	IOPSSamples uint64    `json:"iops_samples"`
+}
+
+type (
+	ReadResult  = IOResult
+	WriteResult = IOResult
+	TrimResult  = IOResult
+)
+
+// SteadyState is the steady state detection of the job, eg.
+//
+//	"steadystate" : {
+//	  "ss" : "iops_slope",
+//	  "duration" : 300,
+//	  "attained" : 1,
+//	  "criterion" : "10.000000%",
+//	  "max_deviation" : 2125.666667,
+//	  "slope" : 0.047328
+//	}
+type SteadyState struct {
+	SS           string  `json:"ss"`
+	Duration     int64   `json:"duration"` // seconds
+	Attained     int32   `json:"attained"`
+	Criterion    string  `json:"criterion"`
+	MaxDeviation float64 `json:"max_deviation"`
+	Slope        float64 `json:"slope"`
+}
+
+type SyncResult struct {
+	TotalIOs  uint64    `json:"total_ios"`
 	LatencyNs LatencyNs `json:"lat_ns"`
-	// IOKBytes  uint64
-	// BWBytes   uint64
-	// IOPS      uint64
 }
 
 type LatencyNs struct {
@@ -379,123 +532,88 @@ type LatencyNs struct {
 	Max    float64 `json:"max"`
 	Mean   float64 `json:"mean"`
 	Stddev float64 `json:"stddev"`
+	N      uint64  `json:"N"`
+	// Percentile is only reported for completion latency, eg. "99.000000" => 8978432
+	Percentile map[string]float64 `json:"percentile,omitempty"`
 }
 
-type WriteResult struct {
-	IOPSMean  float64   `json:"iops_mean"`
-	BWMean    float64   `json:"bw_mean"`
-	LatencyNs LatencyNs `json:"lat_ns"`
+// DiskUtil is the utilization of the disk, the aggregated fields are only
+// reported for the devices which have slaves, such as md or dm devices.
+type DiskUtil struct {
+	Name            string      `json:"name"`
+	ReadIOs         uint64      `json:"read_ios"`
+	WriteIOs        uint64      `json:"write_ios"`
+	ReadMerges      uint64      `json:"read_merges"`
+	WriteMerges     uint64      `json:"write_merges"`
+	ReadTicks       uint64      `json:"read_ticks"`
+	WriteTicks      uint64      `json:"write_ticks"`
+	InQueue         uint64      `json:"in_queue"`
+	Util            float64     `json:"util"` // percentage
+	AggrReadIOs     uint64      `json:"aggr_read_ios,omitempty"`
+	AggrWriteIOs    uint64      `json:"aggr_write_ios,omitempty"`
+	AggrReadMerges  uint64      `json:"aggr_read_merges,omitempty"`
+	AggrWriteMerges uint64      `json:"aggr_write_merge,omitempty"`
+	AggrReadTicks   uint64      `json:"aggr_read_ticks,omitempty"`
+	AggrWriteTicks  uint64      `json:"aggr_write_ticks,omitempty"`
+	AggrInQueue     uint64      `json:"aggr_in_queue,omitempty"`
+	AggrUtil        float64     `json:"aggr_util,omitempty"`
+	Slaves          []*DiskUtil `json:"slaves,omitempty"`
 }
 
-func RenderCharts(results []*FioResult, numJobs []int32, chartFile string) error {
-	var jobMap = make(map[string]map[string]map[string]map[string][]*FioJob) // map[rw][iodepth][bs][numjobs] => []Job
-	for _, result := range results {
-		for _, job := range result.Jobs {
-			if _, ok1 := jobMap[job.JobOptions.RW]; !ok1 {
-				jobMap[job.JobOptions.RW] = make(map[string]map[string]map[string][]*FioJob)
-				jobMap[job.JobOptions.RW][job.JobOptions.IODepth] = make(map[string]map[string][]*FioJob)
-				jobMap[job.JobOptions.RW][job.JobOptions.IODepth][job.JobOptions.BlockSize] = make(map[string][]*FioJob)
-			} else {
-				if _, ok2 := jobMap[job.JobOptions.RW][job.JobOptions.IODepth]; !ok2 {
-					jobMap[job.JobOptions.RW][job.JobOptions.IODepth] = make(map[string]map[string][]*FioJob)
-					jobMap[job.JobOptions.RW][job.JobOptions.IODepth][job.JobOptions.BlockSize] = make(map[string][]*FioJob)
-				} else {
-					if _, ok3 := jobMap[job.JobOptions.RW][job.JobOptions.IODepth][job.JobOptions.BlockSize]; !ok3 {
-						jobMap[job.JobOptions.RW][job.JobOptions.IODepth][job.JobOptions.BlockSize] = make(map[string][]*FioJob)
-					}
-				}
-			}
-			jobMap[job.JobOptions.RW][job.JobOptions.IODepth][job.JobOptions.BlockSize][job.JobOptions.NumJobs] = append(
-				jobMap[job.JobOptions.RW][job.JobOptions.IODepth][job.JobOptions.BlockSize][job.JobOptions.NumJobs], job)
-		}
+// seriesName returns the name of the chart series of the job, which is the
+// filename followed by the fio server and the tuning profile of the result if any.
+func seriesName(result *FioResult, job *FioJob) string {
+	name := job.JobOptions.FileName
+	if job.Hostname != "" {
+		name = fmt.Sprintf("%s@%s", name, job.Hostname)
+	}
+	if len(result.Tuning) > 0 {
+		name = fmt.Sprintf("%s(%s)", name, strings.Join(result.Tuning, ","))
 	}
+	return name
+}
 
-	sort.Slice(numJobs, func(i, j int) bool { return numJobs[i] < numJobs[j] })
-
-	createLine := func(title string, yaxis string) *charts.Line {
-		line := charts.NewLine()
-		line.SetGlobalOptions(
-			charts.WithTitleOpts(opts.Title{
-				Title: title,
-			}),
-			charts.WithTooltipOpts(opts.Tooltip{Show: true, TriggerOn: "mousemove|click"}),
-			charts.WithLegendOpts(opts.Legend{Show: true, Width: "50%", Left: "right"}),
-			charts.WithInitializationOpts(opts.Initialization{
-				Theme: "shine",
-			}),
-			charts.WithXAxisOpts(opts.XAxis{
-				Name: "num_jobs",
-			}),
-			charts.WithYAxisOpts(opts.YAxis{
-				Name: yaxis,
-			}),
-		)
-		line.SetXAxis(numJobs)
-		return line
+const (
+	// Chart2D renders the lines of the chart spec, eg. the IOPS, bandwidth and
+	// latency of each rw, bs and iodepth over numjobs.
+	Chart2D = "2d"
+	// Chart3D renders the IOPS, bandwidth and latency of each rw, bs and device
+	// as surfaces over numjobs and iodepth.
+	Chart3D = "3d"
+	// ChartBoth renders both the 2d and the 3d charts.
+	ChartBoth = "both"
+)
+
+// ValidateChartType validates the chart type, the empty one is 2d.
+func ValidateChartType(chartType string) error {
+	switch chartType {
+	case "", Chart2D, Chart3D, ChartBoth:
+		return nil
 	}
+	return errors.Errorf("invalid chart type %q, which should be %s, %s or %s", chartType, Chart2D, Chart3D, ChartBoth)
+}
 
-	type metrics struct {
-		readIOPS  float64
-		readBw    float64
-		readLat   float64
-		writeIOPS float64
-		writeBw   float64
-		writeLat  float64
+// RenderCharts renders the charts of the chart type into the chart file, the
+// 2d charts are rendered if the chart type is empty and the lines are laid out
+// by the chart spec, which is the default preset if nil. The latency
+// distribution and the time series charts are appended to the charts of any type.
+func RenderCharts(results []*FioResult, chartFile, chartType string, spec *ChartSpec) error {
+	if err := ValidateChartType(chartType); err != nil {
+		return err
 	}
-	generateLines := func(lines []*charts.Line, metricsMap map[string][]*metrics) {
-		for filename, metrics := range metricsMap {
-			var (
-				readIOPSLineData  []opts.LineData
-				writeIOPSLineData []opts.LineData
-				readBwLineData    []opts.LineData
-				writeBwLineData   []opts.LineData
-				readLatLineData   []opts.LineData
-				writeLatLineData  []opts.LineData
-			)
-			for _, metric := range metrics {
-				readIOPSLineData = append(readIOPSLineData, opts.LineData{Value: metric.readIOPS})
-				writeIOPSLineData = append(writeIOPSLineData, opts.LineData{Value: metric.writeIOPS})
-				readBwLineData = append(readBwLineData, opts.LineData{Value: metric.readBw})
-				writeBwLineData = append(writeBwLineData, opts.LineData{Value: metric.writeBw})
-				readLatLineData = append(readLatLineData, opts.LineData{Value: metric.readLat})
-				writeLatLineData = append(writeLatLineData, opts.LineData{Value: metric.writeLat})
-			}
-			lineData := [][]opts.LineData{readIOPSLineData, writeIOPSLineData, readBwLineData, writeBwLineData, readLatLineData, writeLatLineData}
-			for i, line := range lines {
-				line.AddSeries(filename, lineData[i])
-			}
-		}
+	spec, err := spec.Resolve()
+	if err != nil {
+		return err
 	}
 	page := components.NewPage()
-	for rw, rwMap := range jobMap {
-		for iodepth, iodepthMap := range rwMap {
-			for bs, bsMap := range iodepthMap {
-				readIOPSLine := createLine(fmt.Sprintf("readiops-%s-%s-%s", rw, bs, iodepth), "iops")
-				writeIOPSLine := createLine(fmt.Sprintf("writeiops-%s-%s-%s", rw, bs, iodepth), "iops")
-				readBwLine := createLine(fmt.Sprintf("readbw-%s-%s-%s", rw, bs, iodepth), "bandwidth(KiB/s)")
-				writeBwLine := createLine(fmt.Sprintf("writebw-%s-%s-%s", rw, bs, iodepth), "bandwidth(KiB/s)")
-				readLatLine := createLine(fmt.Sprintf("readlat-%s-%s-%s", rw, bs, iodepth), "latency(ms)")
-				writeLatLine := createLine(fmt.Sprintf("writelat-%s-%s-%s", rw, bs, iodepth), "latency(ms)")
-
-				var filenameMap = make(map[string][]*metrics) // filename -> numJobs -> metrics
-				for _, numJob := range numJobs {
-					jobs := bsMap[fmt.Sprintf("%d", numJob)]
-					for _, job := range jobs {
-						filenameMap[job.JobOptions.FileName] = append(filenameMap[job.JobOptions.FileName], &metrics{
-							readIOPS:  job.ReadResult.IOPSMean,
-							readBw:    job.ReadResult.BWMean,
-							readLat:   job.ReadResult.LatencyNs.Mean / 1000 / 1000, // ms
-							writeIOPS: job.WriteResult.IOPSMean,
-							writeBw:   job.WriteResult.BWMean,
-							writeLat:  job.WriteResult.LatencyNs.Mean / 1000 / 1000, // ms
-						})
-					}
-				}
-				generateLines([]*charts.Line{readIOPSLine, writeIOPSLine, readBwLine, writeBwLine, readLatLine, writeLatLine}, filenameMap)
-				page.AddCharts(readIOPSLine, writeIOPSLine, readBwLine, writeBwLine, readLatLine, writeLatLine)
-			}
-		}
+	if chartType != Chart3D {
+		addLineCharts(page, results, spec)
 	}
+	if chartType == Chart3D || chartType == ChartBoth {
+		add3DCharts(page, results)
+	}
+	addLatencyCharts(page, results)
+	addTimeSeriesCharts(page, results)
 	if chartFile == "" {
 		chartFile = fmt.Sprintf("chart-%s.html", uuid.NewString())
 	} else if !strings.HasSuffix(chartFile, "html") {
@@ -505,155 +623,208 @@ func RenderCharts(results []*FioResult, numJobs []int32, chartFile string) error
 	if err != nil {
 		return err
 	}
-	err = page.Render(f)
-	if err != nil {
-		return err
-	}
-	return nil
+	defer f.Close()
+	return page.Render(f)
 }
 
+// Render3DCharts renders the 3d charts into the chart file.
 func Render3DCharts(results []*FioResult, chartFile string) error {
-	var jobsMap = make(map[string]map[string]map[string]map[string]map[string]*FioJob) // map[rw][bs][iodepth][numjobs][filename]=> Job
-	for _, result := range results {
-		for _, job := range result.Jobs {
-			if _, ok1 := jobsMap[job.JobOptions.RW]; !ok1 {
-				jobsMap[job.JobOptions.RW] = make(map[string]map[string]map[string]map[string]*FioJob)
-				jobsMap[job.JobOptions.RW][job.JobOptions.BlockSize] = make(map[string]map[string]map[string]*FioJob)
-				jobsMap[job.JobOptions.RW][job.JobOptions.BlockSize][job.JobOptions.IODepth] = make(map[string]map[string]*FioJob)
-				jobsMap[job.JobOptions.RW][job.JobOptions.BlockSize][job.JobOptions.IODepth][job.JobOptions.NumJobs] = make(map[string]*FioJob)
-			} else {
-				if _, ok2 := jobsMap[job.JobOptions.RW][job.JobOptions.BlockSize]; !ok2 {
-					jobsMap[job.JobOptions.RW][job.JobOptions.BlockSize] = make(map[string]map[string]map[string]*FioJob)
-					jobsMap[job.JobOptions.RW][job.JobOptions.BlockSize][job.JobOptions.IODepth] = make(map[string]map[string]*FioJob)
-					jobsMap[job.JobOptions.RW][job.JobOptions.BlockSize][job.JobOptions.IODepth][job.JobOptions.NumJobs] = make(map[string]*FioJob)
-				} else {
-					if _, ok3 := jobsMap[job.JobOptions.RW][job.JobOptions.BlockSize][job.JobOptions.IODepth]; !ok3 {
-						jobsMap[job.JobOptions.RW][job.JobOptions.BlockSize][job.JobOptions.IODepth] = make(map[string]map[string]*FioJob)
-						jobsMap[job.JobOptions.RW][job.JobOptions.BlockSize][job.JobOptions.IODepth][job.JobOptions.NumJobs] = make(map[string]*FioJob)
-					} else {
-						if _, ok4 := jobsMap[job.JobOptions.RW][job.JobOptions.BlockSize][job.JobOptions.IODepth][job.JobOptions.NumJobs]; !ok4 {
-							jobsMap[job.JobOptions.RW][job.JobOptions.BlockSize][job.JobOptions.IODepth][job.JobOptions.NumJobs] = make(map[string]*FioJob)
-						}
-					}
-				}
-			}
-			jobsMap[job.JobOptions.RW][job.JobOptions.BlockSize][job.JobOptions.IODepth][job.JobOptions.NumJobs][job.JobOptions.FileName] = job
-		}
+	return RenderCharts(results, chartFile, Chart3D, nil)
+}
+
+// sortedKeys returns the keys of the map sorted by less.
+func sortedKeys[V any](m map[string]V, less func(a, b string) bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
 	}
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+	return keys
+}
+
+func lessString(a, b string) bool { return a < b }
 
-	createLine := func(title string, zaxis string) *charts.Line3D {
-		line := charts.NewLine3D()
-		line.SetGlobalOptions(
-			charts.WithTitleOpts(opts.Title{
-				Title: title,
-			}),
-			charts.WithTooltipOpts(opts.Tooltip{Show: true, TriggerOn: "mousemove|click"}),
-			charts.WithLegendOpts(opts.Legend{Show: true, Width: "50%", Left: "right"}),
-			charts.WithInitializationOpts(opts.Initialization{
-				Theme: "shine",
-			}),
-			charts.WithVisualMapOpts(opts.VisualMap{
-				Calculable: true,
-			}),
-			charts.WithXAxisOpts(opts.XAxis{
-				Name: "num_jobs",
-			}),
-			charts.WithYAxisOpts(opts.YAxis{
-				Name: "iodepth",
-			}),
-			// charts.WithZAxisOpts(opts.ZAxis{
-			// 	Name: "iodepth",
-			// }),
-		)
-		// line.SetXAxis(numJobs)
-		return line
+// lessNumeric sorts the numeric strings by their values, eg. iodepth.
+func lessNumeric(a, b string) bool {
+	x, errX := strconv.ParseFloat(a, 64)
+	y, errY := strconv.ParseFloat(b, 64)
+	if errX != nil || errY != nil {
+		return a < b
 	}
+	return x < y
+}
 
-	type metrics struct {
-		readIOPS  float64
-		readBw    float64
-		readLat   float64
-		writeIOPS float64
-		writeBw   float64
-		writeLat  float64
+// lessBlockSize sorts the block sizes by their bytes, eg. 4K < 64K < 1M.
+func lessBlockSize(a, b string) bool {
+	x, y := blockSizeBytes(a), blockSizeBytes(b)
+	if x == y {
+		return a < b
 	}
-	generateLines := func(lines []*charts.Line3D, metricsMap map[string]map[string]map[string]*metrics) { // filename -> iodepth -> numJobs -> metrics
-		for filename, iodepthMap := range metricsMap {
-			var (
-				readIOPSLineData  []opts.Chart3DData
-				writeIOPSLineData []opts.Chart3DData
-				readBwLineData    []opts.Chart3DData
-				writeBwLineData   []opts.Chart3DData
-				readLatLineData   []opts.Chart3DData
-				writeLatLineData  []opts.Chart3DData
-				lineData          [][]opts.Chart3DData
-			)
-			for iodepth, numJobsMap := range iodepthMap {
-				for numJobs, metrics := range numJobsMap {
-					readIOPSLineData = append(readIOPSLineData, opts.Chart3DData{Value: []interface{}{numJobs, iodepth, metrics.readIOPS}})
-					writeIOPSLineData = append(writeIOPSLineData, opts.Chart3DData{Value: []interface{}{numJobs, iodepth, metrics.writeIOPS}})
-					readBwLineData = append(readBwLineData, opts.Chart3DData{Value: []interface{}{numJobs, iodepth, metrics.readBw}})
-					writeBwLineData = append(writeBwLineData, opts.Chart3DData{Value: []interface{}{numJobs, iodepth, metrics.writeBw}})
-					readLatLineData = append(readLatLineData, opts.Chart3DData{Value: []interface{}{numJobs, iodepth, metrics.readLat}})
-					writeLatLineData = append(writeLatLineData, opts.Chart3DData{Value: []interface{}{numJobs, iodepth, metrics.writeLat}})
+	return x < y
+}
 
-				}
+// blockSizeBytes returns the bytes of the block size, eg. 4K, 4k, 4KiB and 4096
+// are 4096, it's 0 if the block size can't be parsed.
+func blockSizeBytes(bs string) float64 {
+	s := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(bs), "IB"), "B")
+	scale := 1.0
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'K':
+			scale = 1 << 10
+		case 'M':
+			scale = 1 << 20
+		case 'G':
+			scale = 1 << 30
+		}
+		if scale > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return n * scale
+}
+
+// surfaceGroup is the jobs of a device with the same rw and bs, keyed by
+// numjobs and iodepth.
+type surfaceGroup struct {
+	rw, bs, series string
+	jobs           map[string]map[string]*FioJob // numjobs -> iodepth -> job
+}
+
+// add3DCharts adds the IOPS, bandwidth and latency surfaces over numjobs and
+// iodepth of each rw, bs and device, one surface for each direction which has IOPS.
+func add3DCharts(page *components.Page, results []*FioResult) {
+	groups := make(map[string]*surfaceGroup)
+	for _, result := range results {
+		for _, job := range result.SummaryJobs() {
+			o := job.JobOptions
+			if o == nil {
+				continue
+			}
+			series := seriesName(result, job)
+			key := strings.Join([]string{o.RW, o.BlockSize, series}, "|")
+			g, ok := groups[key]
+			if !ok {
+				g = &surfaceGroup{rw: o.RW, bs: o.BlockSize, series: series, jobs: make(map[string]map[string]*FioJob)}
+				groups[key] = g
+			}
+			if _, ok = g.jobs[o.NumJobs]; !ok {
+				g.jobs[o.NumJobs] = make(map[string]*FioJob)
 			}
-			lineData = [][]opts.Chart3DData{readIOPSLineData, writeIOPSLineData, readBwLineData, writeBwLineData, readLatLineData, writeLatLineData}
-			for i, line := range lines {
-				line.AddSeries(filename, lineData[i])
+			if _, ok = g.jobs[o.NumJobs][o.IODepth]; !ok {
+				g.jobs[o.NumJobs][o.IODepth] = job
 			}
 		}
 	}
-	page := components.NewPage()
-	for rw, bsMap := range jobsMap {
-		for bs, iodepthMap := range bsMap {
-			readIOPSLine := createLine(fmt.Sprintf("readIOPS-%s-%s", rw, bs), "iops")
-			writeIOPSLine := createLine(fmt.Sprintf("writeIOPS-%s-%s", rw, bs), "iops")
-			readBwLine := createLine(fmt.Sprintf("readBW-%s-%s", rw, bs), "bandwidth(KiB/s)")
-			writeBwLine := createLine(fmt.Sprintf("writeBW-%s-%s", rw, bs), "bandwidth(KiB/s)")
-			readLatLine := createLine(fmt.Sprintf("readLat-%s-%s", rw, bs), "latency(ms)")
-			writeLatLine := createLine(fmt.Sprintf("writeLat-%s-%s", rw, bs), "latency(ms)")
-
-			var filenameMap = make(map[string]map[string]map[string]*metrics) // filename -> iodepth -> numJobs -> metrics
-			for iodepth, numJobsMap := range iodepthMap {
-				for numJobs, jobMap := range numJobsMap {
-					for filename, job := range jobMap {
-						if _, ok := filenameMap[filename]; !ok {
-							filenameMap[filename] = make(map[string]map[string]*metrics)
-							filenameMap[filename][iodepth] = make(map[string]*metrics)
-						} else {
-							if _, ok2 := filenameMap[filename][iodepth]; !ok2 {
-								filenameMap[filename][iodepth] = make(map[string]*metrics)
-							}
-						}
-						filenameMap[filename][iodepth][numJobs] = &metrics{
-							readIOPS:  job.ReadResult.IOPSMean,
-							readBw:    job.ReadResult.BWMean,
-							readLat:   job.ReadResult.LatencyNs.Mean / 1000 / 1000, // ms
-							writeIOPS: job.WriteResult.IOPSMean,
-							writeBw:   job.WriteResult.BWMean,
-							writeLat:  job.WriteResult.LatencyNs.Mean / 1000 / 1000, // ms
-						}
+	sorted := make([]*surfaceGroup, 0, len(groups))
+	for _, g := range groups {
+		sorted = append(sorted, g)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.rw != b.rw {
+			return a.rw < b.rw
+		}
+		if a.bs != b.bs {
+			return lessBlockSize(a.bs, b.bs)
+		}
+		return a.series < b.series
+	})
+	metrics := []struct {
+		name, zaxis string
+		value       func(r *IOResult) float64
+	}{
+		{"iops", "iops", func(r *IOResult) float64 { return r.IOPSMean }},
+		{"bw", "bandwidth(KiB/s)", func(r *IOResult) float64 { return r.BWMean }},
+		{"lat", "latency(ms)", func(r *IOResult) float64 { return r.LatencyNs.Mean / 1000 / 1000 }},
+	}
+	for _, g := range sorted {
+		numJobs := sortedKeys(g.jobs, lessNumeric)
+		var iodepths []string
+		seen := make(map[string]bool)
+		for _, byIODepth := range g.jobs {
+			for iodepth := range byIODepth {
+				if !seen[iodepth] {
+					seen[iodepth] = true
+					iodepths = append(iodepths, iodepth)
+				}
+			}
+		}
+		sort.SliceStable(iodepths, func(i, j int) bool { return lessNumeric(iodepths[i], iodepths[j]) })
+		for _, m := range metrics {
+			surface := charts.NewSurface3D()
+			var max float64
+			for _, direction := range logDirections {
+				data, ok := surfaceData(g, numJobs, iodepths, func(job *FioJob) float64 {
+					r := job.directionResult(direction)
+					if r == nil || r.IOPSMean == 0 {
+						return 0
+					}
+					v := m.value(r)
+					if v > max {
+						max = v
 					}
+					return v
+				})
+				if ok {
+					// the surface series of the vendored go-echarts is typed as scatter3D
+					surface.AddSeries(direction, data, func(s *charts.SingleSeries) { s.Type = types.ChartSurface3D })
 				}
 			}
-			generateLines([]*charts.Line3D{readIOPSLine, writeIOPSLine, readBwLine, writeBwLine, readLatLine, writeLatLine}, filenameMap)
-			page.AddCharts(readIOPSLine, writeIOPSLine, readBwLine, writeBwLine, readLatLine, writeLatLine)
+			if len(surface.MultiSeries) == 0 {
+				continue
+			}
+			surface.SetGlobalOptions(
+				charts.WithTitleOpts(opts.Title{Title: fmt.Sprintf("%s-%s-%s-%s", m.name, g.rw, g.bs, g.series)}),
+				charts.WithTooltipOpts(opts.Tooltip{Show: true}),
+				charts.WithLegendOpts(opts.Legend{Show: true, Width: "50%", Left: "right"}),
+				charts.WithInitializationOpts(opts.Initialization{Theme: "shine"}),
+				charts.WithVisualMapOpts(opts.VisualMap{Show: true, Calculable: true, Dimension: "2", Max: float32(max)}),
+				charts.WithXAxis3DOpts(opts.XAxis3D{Name: "num_jobs", Type: "category", Data: numJobs}),
+				charts.WithYAxis3DOpts(opts.YAxis3D{Name: "iodepth", Type: "category", Data: iodepths}),
+				charts.WithZAxis3DOpts(opts.ZAxis3D{Name: m.zaxis, Type: "value"}),
+			)
+			page.AddCharts(surface)
 		}
 	}
-	if chartFile == "" {
-		chartFile = fmt.Sprintf("3dchart-%s.html", uuid.NewString())
-	} else if !strings.HasSuffix(chartFile, "html") {
-		chartFile = fmt.Sprintf("%s.html", chartFile)
-	}
-	f, err := os.Create(chartFile)
-	if err != nil {
-		return err
+}
+
+// surfaceData returns the grid of the values over the indexes of numjobs and
+// iodepth, which is ordered by iodepth and then numjobs, the missing points are
+// "-". It's false if all the values are 0, eg. the write of randread.
+func surfaceData(g *surfaceGroup, numJobs, iodepths []string, value func(job *FioJob) float64) ([]opts.Chart3DData, bool) {
+	var (
+		data    []opts.Chart3DData
+		nonZero bool
+	)
+	for y, iodepth := range iodepths {
+		for x, n := range numJobs {
+			job, ok := g.jobs[n][iodepth]
+			if !ok {
+				data = append(data, opts.Chart3DData{Value: []interface{}{x, y, "-"}})
+				continue
+			}
+			v := value(job)
+			nonZero = nonZero || v != 0
+			data = append(data, opts.Chart3DData{Value: []interface{}{x, y, v}})
+		}
 	}
-	err = page.Render(f)
-	if err != nil {
-		return err
+	return data, nonZero
+}
+
+// directionResult returns the result of the direction, eg. read.
+func (job *FioJob) directionResult(direction string) *IOResult {
+	switch direction {
+	case "read":
+		return job.ReadResult
+	case "write":
+		return job.WriteResult
+	case "trim":
+		return job.TrimResult
 	}
 	return nil
 }
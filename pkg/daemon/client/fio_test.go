@@ -1,6 +1,11 @@
 package client
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
@@ -300,13 +305,18 @@ func (s *fioTestSuite) TestFioJobs() {
 			return output, nil
 		},
 	}
-	actual, err := FioTest(executor, "/dev/vdb", 8, "4K", 1, "randrw", 120, "libaio", true, true, false)
+	actual, err := FioTest(context.Background(), executor, "/dev/vdb", 8, "4K", 1, "randrw", 120, "libaio", true, true, false)
 	s.NoError(err)
 	s.Len(actual.Jobs, 1)
 	expect := &FioResult{
+		FioVersion:  "fio-3.27",
+		Timestamp:   1685782697,
+		TimestampMs: 1685782697598,
+		Time:        "Sat Jun  3 16:58:17 2023",
 		Jobs: []*FioJob{
 			{
 				JobName: "write_throughput",
+				Elapsed: 101,
 				JobOptions: &JobOptions{
 					Name:      "write_throughput",
 					FileName:  "/dev/vdb",
@@ -330,17 +340,154 @@ func (s *fioTestSuite) TestFioJobs() {
 					},
 				},
 				WriteResult: &WriteResult{
-					IOPSMean: 2289.386935,
-					BWMean:   9157.989950,
+					IOBytes:  937209856,
+					IOKBytes: 915244,
+					BWBytes:  9371817,
+					BW:       9152,
+					IOPS:     2288.041359,
+					Runtime:  100003,
+					TotalIOs: 228811,
+					SlatNs: LatencyNs{
+						Min:    5869,
+						Max:    5414297,
+						Mean:   19195.214041,
+						Stddev: 15994.569417,
+						N:      228811,
+					},
+					ClatNs: LatencyNs{
+						Min:    608761,
+						Max:    68187524,
+						Mean:   3468368.231226,
+						Stddev: 1721234.091105,
+						N:      228811,
+						Percentile: map[string]float64{
+							"1.000000":  1187840,
+							"5.000000":  1515520,
+							"10.000000": 1728512,
+							"20.000000": 2113536,
+							"30.000000": 2506752,
+							"40.000000": 2801664,
+							"50.000000": 3129344,
+							"60.000000": 3489792,
+							"70.000000": 3948544,
+							"80.000000": 4554752,
+							"90.000000": 5537792,
+							"95.000000": 6520832,
+							"99.000000": 8978432,
+							"99.500000": 10420224,
+							"99.900000": 15138816,
+							"99.950000": 17956864,
+							"99.990000": 27918336,
+						},
+					},
 					LatencyNs: LatencyNs{
 						Min:    624788,
 						Max:    68213304,
 						Mean:   3488600.241282,
 						Stddev: 1721929.434940,
+						N:      228811,
 					},
+					BWMin:       6100,
+					BWMax:       12824,
+					BWAgg:       100,
+					BWMean:      9157.989950,
+					BWDev:       109.078221,
+					BWSamples:   1592,
+					IOPSMin:     1522,
+					IOPSMax:     3206,
+					IOPSMean:    2289.386935,
+					IOPSStddev:  27.290962,
+					IOPSSamples: 1592,
+				},
+				TrimResult: &TrimResult{},
+				SyncResult: &SyncResult{},
+				JobRuntime: 800006,
+				UsrCPU:     0.395997,
+				SysCPU:     0.693620,
+				Ctx:        228874,
+				Minf:       108,
+				IODepthLevel: map[string]float64{
+					"1": 100, "2": 0, "4": 0, "8": 0, "16": 0, "32": 0, ">=64": 0,
+				},
+				IODepthSubmit: map[string]float64{
+					"0": 0, "4": 100, "8": 0, "16": 0, "32": 0, "64": 0, ">=64": 0,
+				},
+				IODepthComplete: map[string]float64{
+					"0": 0, "4": 100, "8": 0, "16": 0, "32": 0, "64": 0, ">=64": 0,
 				},
+				LatencyNs: map[string]float64{
+					"2": 0, "4": 0, "10": 0, "20": 0, "50": 0, "100": 0, "250": 0, "500": 0, "750": 0, "1000": 0,
+				},
+				LatencyUs: map[string]float64{
+					"2": 0, "4": 0, "10": 0, "20": 0, "50": 0, "100": 0, "250": 0, "500": 0, "750": 0.018793, "1000": 0.406886,
+				},
+				LatencyMs: map[string]float64{
+					"2": 15.173222, "4": 55.223307, "10": 28.582105, "20": 0.561162, "50": 0.032778, "100": 0.010000,
+					"250": 0, "500": 0, "750": 0, "1000": 0, "2000": 0, ">=2000": 0,
+				},
+				LatencyDepth:      1,
+				LatencyPercentile: 100,
+			},
+		},
+		DiskUtil: []*DiskUtil{
+			{
+				Name:       "vdb",
+				ReadIOs:    51,
+				WriteIOs:   228550,
+				ReadTicks:  111,
+				WriteTicks: 789202,
+				InQueue:    789313,
+				Util:       100,
 			},
 		},
 	}
 	s.Assert().EqualValues(expect, actual)
 }
+
+func (s *fioTestSuite) TestRenderCharts() {
+	var results []*FioResult
+	for _, numJobs := range []string{"16", "2", "4"} {
+		for _, iodepth := range []string{"128", "8", "32"} {
+			if numJobs == "16" && iodepth == "128" {
+				continue // missing point of the surface
+			}
+			results = append(results, &FioResult{Jobs: []*FioJob{{
+				JobName:     "randread",
+				JobOptions:  &JobOptions{FileName: "/dev/vdb", RW: "randread", BlockSize: "4K", IODepth: iodepth, NumJobs: numJobs},
+				ReadResult:  &ReadResult{IOPSMean: 1000, BWMean: 4000, LatencyNs: LatencyNs{Mean: 2e6}},
+				WriteResult: &WriteResult{},
+				TrimResult:  &TrimResult{},
+			}}})
+		}
+	}
+	render := func(chartType string) string {
+		chartFile := filepath.Join(s.T().TempDir(), "chart.html")
+		s.Require().NoError(RenderCharts(results, chartFile, chartType, nil))
+		data, err := os.ReadFile(chartFile)
+		s.Require().NoError(err)
+		return string(data)
+	}
+
+	html := render(Chart3D)
+	s.NotContains(html, "readiops-randread")
+	for _, title := range []string{"iops-randread-4K-/dev/vdb", "bw-randread-4K-/dev/vdb", "lat-randread-4K-/dev/vdb"} {
+		s.Equal(1, strings.Count(html, fmt.Sprintf(`"text":"%s"`, title)), title)
+	}
+	s.Equal(3, strings.Count(html, `"type":"surface"`))
+	s.NotContains(html, `"name":"write"`)
+	s.Contains(html, `"name":"num_jobs","type":"category","data":["2","4","16"]`)
+	s.Contains(html, `"name":"iodepth","type":"category","data":["8","32","128"]`)
+	s.Contains(html, `"name":"latency(ms)"`)
+	s.Contains(html, `"name":"bandwidth(KiB/s)"`)
+	s.Contains(html, `{"value":[2,2,"-"]}`)
+	s.Contains(html, `{"value":[0,0,2]}`)
+
+	html = render(ChartBoth)
+	s.Contains(html, "readiops-randread-4K-8")
+	s.Contains(html, `"type":"surface"`)
+	html = render("")
+	s.Contains(html, "readiops-randread-4K-8")
+	s.NotContains(html, `"type":"surface"`)
+
+	s.EqualError(RenderCharts(results, "", "4d", nil), `invalid chart type "4d", which should be 2d, 3d or both`)
+}
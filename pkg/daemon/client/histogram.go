@@ -0,0 +1,234 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/components"
+	"github.com/go-echarts/go-echarts/v2/opts"
+)
+
+// LatencyBucket is a bucket of the completion latency distribution reported by
+// fio, eg. 750us is the percent of the IOs completed in (500us, 750us].
+type LatencyBucket struct {
+	Label   string  // eg. 750us, >=2000ms
+	Bound   float64 // upper bound in nanoseconds, which sorts the buckets
+	Percent float64
+}
+
+// LatencyBuckets returns the latency distribution of the job in ascending order
+// of the buckets, which is merged from latency_ns, latency_us and latency_ms.
+func LatencyBuckets(job *FioJob) []*LatencyBucket {
+	var buckets []*LatencyBucket
+	units := []struct {
+		name   string
+		scale  float64
+		values map[string]float64
+	}{
+		{"ns", 1, job.LatencyNs},
+		{"us", 1e3, job.LatencyUs},
+		{"ms", 1e6, job.LatencyMs},
+	}
+	for _, unit := range units {
+		for key, percent := range unit.values {
+			bound, err := strconv.ParseFloat(strings.TrimPrefix(key, ">="), 64)
+			if err != nil {
+				continue
+			}
+			bound *= unit.scale
+			if strings.HasPrefix(key, ">=") {
+				bound++ // after the bucket of the same bound
+			}
+			buckets = append(buckets, &LatencyBucket{Label: key + unit.name, Bound: bound, Percent: percent})
+		}
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Bound < buckets[j].Bound })
+	return buckets
+}
+
+// latencyPoint is the jobs of the same rw, bs, iodepth and numjobs.
+type latencyPoint struct {
+	rw, bs, iodepth, numJobs string
+	series                   []string // distinct series names in order
+	jobs                     map[string]*FioJob
+}
+
+// latencyPoints groups the jobs by rw, bs, iodepth and numjobs, the first job of
+// each series is kept.
+func latencyPoints(results []*FioResult) []*latencyPoint {
+	points := make(map[string]*latencyPoint)
+	for _, result := range results {
+		for _, job := range result.SummaryJobs() {
+			o := job.JobOptions
+			if o == nil {
+				continue
+			}
+			key := strings.Join([]string{o.RW, o.BlockSize, o.IODepth, o.NumJobs}, "|")
+			p, ok := points[key]
+			if !ok {
+				p = &latencyPoint{rw: o.RW, bs: o.BlockSize, iodepth: o.IODepth, numJobs: o.NumJobs, jobs: make(map[string]*FioJob)}
+				points[key] = p
+			}
+			name := seriesName(result, job)
+			if _, ok = p.jobs[name]; !ok {
+				p.series = append(p.series, name)
+				p.jobs[name] = job
+			}
+		}
+	}
+	sorted := make([]*latencyPoint, 0, len(points))
+	for _, p := range points {
+		sort.Strings(p.series)
+		sorted = append(sorted, p)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.rw != b.rw {
+			return a.rw < b.rw
+		}
+		if a.bs != b.bs {
+			return a.bs < b.bs
+		}
+		if x, y := atoi(a.iodepth), atoi(b.iodepth); x != y {
+			return x < y
+		}
+		return atoi(a.numJobs) < atoi(b.numJobs)
+	})
+	return sorted
+}
+
+// addLatencyCharts adds the latency distribution chart and the percentile
+// ladder chart of each rw, bs, iodepth and numjobs, the devices are overlaid
+// in the same chart so that the outliers stand out.
+func addLatencyCharts(page *components.Page, results []*FioResult) {
+	for _, p := range latencyPoints(results) {
+		name := fmt.Sprintf("%s-%s-%s-%s", p.rw, p.bs, p.iodepth, p.numJobs)
+		if bar := latencyDistributionChart(p, name); bar != nil {
+			page.AddCharts(bar)
+		}
+		if line := percentileLadderChart(p, name); line != nil {
+			page.AddCharts(line)
+		}
+	}
+}
+
+// latencyDistributionChart returns the bar chart of the percent of the IOs in
+// each latency bucket, the buckets without any IO are omitted. It's nil if no
+// job reported the latency distribution, eg. the mean of the repeated trials.
+func latencyDistributionChart(p *latencyPoint, name string) *charts.Bar {
+	bounds := make(map[string]float64)
+	percents := make(map[string]map[string]float64) // series -> label -> percent
+	for _, series := range p.series {
+		percents[series] = make(map[string]float64)
+		for _, b := range LatencyBuckets(p.jobs[series]) {
+			if b.Percent > 0 {
+				bounds[b.Label] = b.Bound
+				percents[series][b.Label] = b.Percent
+			}
+		}
+	}
+	if len(bounds) == 0 {
+		return nil
+	}
+	labels := make([]string, 0, len(bounds))
+	for label := range bounds {
+		labels = append(labels, label)
+	}
+	sort.Slice(labels, func(i, j int) bool { return bounds[labels[i]] < bounds[labels[j]] })
+
+	bar := charts.NewBar()
+	bar.SetGlobalOptions(
+		charts.WithTitleOpts(opts.Title{Title: "latency-distribution-" + name}),
+		charts.WithTooltipOpts(opts.Tooltip{Show: true, Trigger: "axis"}),
+		charts.WithLegendOpts(opts.Legend{Show: true, Width: "50%", Left: "right"}),
+		charts.WithInitializationOpts(opts.Initialization{Theme: "shine"}),
+		charts.WithXAxisOpts(opts.XAxis{Name: "latency"}),
+		charts.WithYAxisOpts(opts.YAxis{Name: "IOs(%)"}),
+	)
+	bar.SetXAxis(labels)
+	for _, series := range p.series {
+		data := make([]opts.BarData, 0, len(labels))
+		for _, label := range labels {
+			data = append(data, opts.BarData{Value: percents[series][label]})
+		}
+		bar.AddSeries(series, data)
+	}
+	return bar
+}
+
+// percentileLadderChart returns the line chart of the completion latency
+// percentiles of each direction which has IOPS, the latency axis is in log
+// scale so that the tail is still readable. It's nil if no percentile is reported.
+func percentileLadderChart(p *latencyPoint, name string) *charts.Line {
+	type ladder struct {
+		name   string
+		values map[float64]float64 // percentile -> us
+	}
+	var ladders []*ladder
+	seen := make(map[float64]bool)
+	for _, series := range p.series {
+		job := p.jobs[series]
+		directions := []struct {
+			name   string
+			result *IOResult
+		}{
+			{"read", job.ReadResult},
+			{"write", job.WriteResult},
+			{"trim", job.TrimResult},
+		}
+		for _, d := range directions {
+			if d.result == nil || d.result.IOPSMean == 0 || len(d.result.ClatNs.Percentile) == 0 {
+				continue
+			}
+			l := &ladder{name: fmt.Sprintf("%s-%s", series, d.name), values: make(map[float64]float64)}
+			for key, value := range d.result.ClatNs.Percentile {
+				percentile, err := strconv.ParseFloat(key, 64)
+				if err != nil {
+					continue
+				}
+				seen[percentile] = true
+				l.values[percentile] = value / 1000
+			}
+			ladders = append(ladders, l)
+		}
+	}
+	if len(ladders) == 0 {
+		return nil
+	}
+	percentiles := make([]float64, 0, len(seen))
+	for percentile := range seen {
+		percentiles = append(percentiles, percentile)
+	}
+	sort.Float64s(percentiles)
+	labels := make([]string, 0, len(percentiles))
+	for _, percentile := range percentiles {
+		labels = append(labels, "p"+strconv.FormatFloat(percentile, 'f', -1, 64))
+	}
+
+	line := charts.NewLine()
+	line.SetGlobalOptions(
+		charts.WithTitleOpts(opts.Title{Title: "latency-percentiles-" + name}),
+		charts.WithTooltipOpts(opts.Tooltip{Show: true, Trigger: "axis"}),
+		charts.WithLegendOpts(opts.Legend{Show: true, Width: "50%", Left: "right"}),
+		charts.WithInitializationOpts(opts.Initialization{Theme: "shine"}),
+		charts.WithXAxisOpts(opts.XAxis{Name: "percentile"}),
+		charts.WithYAxisOpts(opts.YAxis{Name: "latency(us)", Type: "log"}),
+	)
+	line.SetXAxis(labels)
+	for _, l := range ladders {
+		data := make([]opts.LineData, 0, len(percentiles))
+		for _, percentile := range percentiles {
+			value, ok := l.values[percentile]
+			if !ok {
+				data = append(data, opts.LineData{Value: "-"}) // missing in echarts
+				continue
+			}
+			data = append(data, opts.LineData{Value: value})
+		}
+		line.AddSeries(l.name, data)
+	}
+	return line
+}
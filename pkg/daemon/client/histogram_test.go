@@ -0,0 +1,67 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestHistogramSuite(t *testing.T) {
+	suite.Run(t, new(histogramTestSuite))
+}
+
+type histogramTestSuite struct {
+	suite.Suite
+}
+
+func (s *histogramTestSuite) TestLatencyBuckets() {
+	job := &FioJob{
+		LatencyNs: map[string]float64{"1000": 0.5, "750": 0.01},
+		LatencyUs: map[string]float64{"2": 0, "1000": 1, "100": 90},
+		LatencyMs: map[string]float64{">=2000": 0.1, "2000": 0.2, "2": 8},
+	}
+	var labels []string
+	for _, b := range LatencyBuckets(job) {
+		labels = append(labels, b.Label)
+	}
+	s.Equal([]string{"750ns", "1000ns", "2us", "100us", "1000us", "2ms", "2000ms", ">=2000ms"}, labels)
+	s.Empty(LatencyBuckets(&FioJob{}))
+}
+
+func (s *histogramTestSuite) TestRenderCharts() {
+	newResult := func(filename string, p99 float64) *FioResult {
+		return &FioResult{Jobs: []*FioJob{{
+			JobName:    "randread",
+			JobOptions: &JobOptions{FileName: filename, RW: "randread", BlockSize: "4K", IODepth: "32", NumJobs: "4"},
+			ReadResult: &ReadResult{IOPSMean: 1000, ClatNs: LatencyNs{Percentile: map[string]float64{
+				"1.000000": 20000, "50.000000": 80000, "99.000000": p99, "99.990000": p99 * 2}}},
+			WriteResult: &WriteResult{},
+			TrimResult:  &TrimResult{},
+			LatencyUs:   map[string]float64{"50": 2, "100": 97, "250": 1},
+			LatencyMs:   map[string]float64{"2": 0, "10": 0},
+		}}}
+	}
+	// the mean of the repeated trials doesn't have the distribution
+	mean := &FioResult{Jobs: []*FioJob{{
+		JobOptions:  &JobOptions{FileName: "/dev/vdd", RW: "randwrite", BlockSize: "4K", IODepth: "1", NumJobs: "1"},
+		ReadResult:  &ReadResult{},
+		WriteResult: &WriteResult{IOPSMean: 10},
+		TrimResult:  &TrimResult{},
+	}}}
+	chartFile := filepath.Join(s.T().TempDir(), "chart.html")
+	s.NoError(RenderCharts([]*FioResult{newResult("/dev/vdb", 150000), newResult("/dev/vdc", 900000), mean}, chartFile, "", nil))
+	data, err := os.ReadFile(chartFile)
+	s.NoError(err)
+	html := string(data)
+	s.Equal(1, strings.Count(html, `"text":"latency-distribution-randread-4K-32-4"`))
+	s.Equal(1, strings.Count(html, `"text":"latency-percentiles-randread-4K-32-4"`))
+	s.NotContains(html, "latency-distribution-randwrite")
+	s.NotContains(html, "latency-percentiles-randwrite")
+	s.Contains(html, `"data":["50us","100us","250us"]`)
+	s.Contains(html, `"data":["p1","p50","p99","p99.99"]`)
+	s.Contains(html, `"name":"/dev/vdc-read"`)
+	s.Contains(html, `"type":"log"`)
+}
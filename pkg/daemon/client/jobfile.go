@@ -0,0 +1,203 @@
+package client
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	globalSection = "global"
+)
+
+// jobDefaults are filled into every job section which doesn't specify them,
+// so that the results can be grouped in the same way as the generated jobs.
+var jobDefaults = [][2]string{
+	{"rw", "read"},
+	{"bs", "4k"},
+	{"iodepth", "1"},
+	{"numjobs", "1"},
+}
+
+// optionAliases are the fio aliases of the options which are looked up by
+// their names, eg. the rw of the job is checked by the write guard.
+var optionAliases = map[string]string{
+	"readwrite": "rw",
+	"blocksize": "bs",
+}
+
+// JobSection is a job defined in a fio job file, the options of the [global]
+// sections preceding it have been merged into Options.
+type JobSection struct {
+	Name    string   `json:"name" yaml:"name"`
+	Options []string `json:"options" yaml:"options"` // key=value or key
+}
+
+// Option returns the value of the specified option.
+func (j *JobSection) Option(key string) (string, bool) {
+	for _, o := range j.Options {
+		k, v := splitOption(o)
+		if k == key {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// Stonewall returns whether the job waits for the preceding jobs to finish.
+func (j *JobSection) Stonewall() bool {
+	for _, key := range []string{"stonewall", "wait_for_previous"} {
+		if v, ok := j.Option(key); ok && v != "0" {
+			return true
+		}
+	}
+	return false
+}
+
+// JobFile is a parsed fio job file.
+type JobFile struct {
+	Jobs []*JobSection
+}
+
+// Groups splits the jobs by stonewall, the jobs within the same group run
+// concurrently and the groups run one after another.
+func (f *JobFile) Groups() [][]*JobSection {
+	var groups [][]*JobSection
+	for i, job := range f.Jobs {
+		if i == 0 || job.Stonewall() {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], job)
+	}
+	return groups
+}
+
+// ParseJobFile parses the specified fio job file.
+func ParseJobFile(jobFile string) (*JobFile, error) {
+	f, err := os.Open(jobFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseJobFile(f)
+}
+
+func parseJobFile(r io.Reader) (*JobFile, error) {
+	var (
+		global  []string
+		current *JobSection
+		jobFile = &JobFile{}
+		lineNo  int
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, errors.Errorf("line %d: invalid section %q", lineNo, line)
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if name == "" {
+				return nil, errors.Errorf("line %d: empty section name", lineNo)
+			}
+			if name == globalSection {
+				current = nil
+				continue
+			}
+			current = &JobSection{
+				Name:    name,
+				Options: append([]string{}, global...),
+			}
+			jobFile.Jobs = append(jobFile.Jobs, current)
+			continue
+		}
+		if strings.HasPrefix(line, "include ") {
+			return nil, errors.Errorf("line %d: include is not supported", lineNo)
+		}
+		key, value := splitOption(line)
+		if alias, ok := optionAliases[key]; ok {
+			key = alias
+		}
+		option := key
+		if value != "" {
+			option = key + "=" + os.ExpandEnv(value)
+		}
+		if current == nil {
+			global = setOption(global, key, option)
+		} else {
+			current.Options = setOption(current.Options, key, option)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(jobFile.Jobs) == 0 {
+		return nil, errors.New("no job is defined in the job file")
+	}
+	for _, job := range jobFile.Jobs {
+		for _, d := range jobDefaults {
+			if _, ok := job.Option(d[0]); !ok {
+				job.Options = append(job.Options, d[0]+"="+d[1])
+			}
+		}
+	}
+	return jobFile, nil
+}
+
+// setOption overrides the option with the same key, or appends it.
+func setOption(options []string, key, option string) []string {
+	for i, o := range options {
+		if k, _ := splitOption(o); k == key {
+			options[i] = option
+			return options
+		}
+	}
+	return append(options, option)
+}
+
+func splitOption(option string) (string, string) {
+	kv := strings.SplitN(option, "=", 2)
+	key := strings.TrimSpace(kv[0])
+	if len(kv) == 1 {
+		return key, ""
+	}
+	return key, strings.TrimSpace(kv[1])
+}
+
+// ParseFioDuration parses the time value of fio option, the value without
+// unit is in seconds.
+func ParseFioDuration(value string) (time.Duration, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	units := []struct {
+		suffix string
+		unit   time.Duration
+	}{
+		{"us", time.Microsecond},
+		{"ms", time.Millisecond},
+		{"s", time.Second},
+		{"m", time.Minute},
+		{"h", time.Hour},
+		{"d", 24 * time.Hour},
+	}
+	unit := time.Second
+	for _, u := range units {
+		if strings.HasSuffix(value, u.suffix) {
+			value, unit = strings.TrimSuffix(value, u.suffix), u.unit
+			break
+		}
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid time value %q", value)
+	}
+	return time.Duration(n) * unit, nil
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"k8s.io/klog/v2"
+
+	exectest "github.com/microyahoo/fio-benchmark/pkg/util/exec/test"
+)
+
+func TestJobFileSuite(t *testing.T) {
+	suite.Run(t, new(jobFileTestSuite))
+}
+
+type jobFileTestSuite struct {
+	suite.Suite
+}
+
+func (s *jobFileTestSuite) TestParseJobFile() {
+	content := `
+# comment
+[global]
+ioengine=libaio
+iodepth = 32
+direct=1
+runtime=60
+
+[seq-read-4k]
+bs=4k
+rw=read
+stonewall
+
+; concurrent with seq-read-4k
+[rand-read-4k]
+bs=4k
+rw=randread
+iodepth=8
+
+[global]
+numjobs=4
+
+[seq-write-4k]
+rw=write
+stonewall
+`
+	f, err := parseJobFile(strings.NewReader(content))
+	s.NoError(err)
+	s.Len(f.Jobs, 3)
+
+	s.Equal("seq-read-4k", f.Jobs[0].Name)
+	s.Equal([]string{"ioengine=libaio", "iodepth=32", "direct=1", "runtime=60", "bs=4k", "rw=read", "stonewall", "numjobs=1"}, f.Jobs[0].Options)
+	s.Equal([]string{"ioengine=libaio", "iodepth=8", "direct=1", "runtime=60", "bs=4k", "rw=randread", "numjobs=1"}, f.Jobs[1].Options)
+	s.Equal([]string{"ioengine=libaio", "iodepth=32", "direct=1", "runtime=60", "numjobs=4", "rw=write", "stonewall", "bs=4k"}, f.Jobs[2].Options)
+
+	groups := f.Groups()
+	s.Len(groups, 2)
+	s.Len(groups[0], 2)
+	s.Len(groups[1], 1)
+	s.Equal("seq-write-4k", groups[1][0].Name)
+}
+
+func (s *jobFileTestSuite) TestParseOptionAliases() {
+	content := `
+[global]
+readwrite=randwrite
+
+[write]
+blocksize=64k
+
+[read]
+rw=randread
+`
+	f, err := parseJobFile(strings.NewReader(content))
+	s.NoError(err)
+	s.Equal([]string{"rw=randwrite", "bs=64k", "iodepth=1", "numjobs=1"}, f.Jobs[0].Options)
+	s.Equal([]string{"rw=randread", "bs=4k", "iodepth=1", "numjobs=1"}, f.Jobs[1].Options)
+}
+
+func (s *jobFileTestSuite) TestParseInvalidJobFile() {
+	_, err := parseJobFile(strings.NewReader("[global]\nbs=4k\n"))
+	s.Error(err)
+	_, err = parseJobFile(strings.NewReader("[job\nbs=4k\n"))
+	s.Error(err)
+	_, err = parseJobFile(strings.NewReader("include common.fio\n[job]\n"))
+	s.Error(err)
+}
+
+func (s *jobFileTestSuite) TestFioJobTest() {
+	var actual []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(command string, args ...string) (string, error) {
+			klog.Infof("run command %s %v", command, args)
+			actual = args
+			return `{"jobs": []}`, nil
+		},
+	}
+	job := &JobSection{
+		Name:    "seq-read-4k",
+		Options: []string{"ioengine=libaio", "bs=4k", "rw=read", "stonewall", "group_reporting"},
+	}
+	_, err := FioJobTest(context.Background(), executor, job, false)
+	s.NoError(err)
+	s.Equal([]string{"--name", "seq-read-4k", "--ioengine=libaio", "--bs=4k", "--rw=read", "--group_reporting", "--output-format", "json"}, actual)
+}
+
+func (s *jobFileTestSuite) TestParseFioDuration() {
+	for value, expect := range map[string]time.Duration{
+		"60":    60 * time.Second,
+		"100s":  100 * time.Second,
+		"2m":    2 * time.Minute,
+		"500ms": 500 * time.Millisecond,
+		"1h":    time.Hour,
+	} {
+		d, err := ParseFioDuration(value)
+		s.NoError(err)
+		s.Equal(expect, d, value)
+	}
+	_, err := ParseFioDuration("abc")
+	s.Error(err)
+}
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"strconv"
+
+	"github.com/microyahoo/fio-benchmark/pkg/util/sys"
+)
+
+// Device is the snapshot of the device which the result was measured on.
+type Device struct {
+	Vendor     string         `json:"vendor,omitempty"`
+	Model      string         `json:"model,omitempty"`
+	Serial     string         `json:"serial,omitempty"`
+	WWN        string         `json:"wwn,omitempty"`
+	Firmware   string         `json:"firmware,omitempty"`
+	Size       uint64         `json:"size"` // bytes
+	Rotational bool           `json:"rotational"`
+	Bus        string         `json:"bus,omitempty"`
+	Queue      *sys.QueueInfo `json:"queue,omitempty"`
+}
+
+// NewDevice returns the snapshot of the local device.
+func NewDevice(d *sys.LocalDevice, queue *sys.QueueInfo) *Device {
+	return &Device{
+		Vendor:     d.Vendor,
+		Model:      d.Model,
+		Serial:     d.Serial,
+		WWN:        d.WWN,
+		Firmware:   d.Firmware,
+		Size:       d.Size,
+		Rotational: d.Rotational,
+		Bus:        d.Bus,
+		Queue:      queue,
+	}
+}
+
+// MetadataColumn is a column of the device or host metadata of the results.
+type MetadataColumn struct {
+	Header string
+	Value  func(result *FioResult) interface{}
+	Set    func(result *FioResult, value string)
+}
+
+func device(result *FioResult) *Device {
+	if result.Device == nil {
+		result.Device = &Device{}
+	}
+	return result.Device
+}
+
+func queue(result *FioResult) *sys.QueueInfo {
+	d := device(result)
+	if d.Queue == nil {
+		d.Queue = &sys.QueueInfo{}
+	}
+	return d.Queue
+}
+
+func queueValue(value func(q *sys.QueueInfo) interface{}) func(result *FioResult) interface{} {
+	return func(result *FioResult) interface{} {
+		if result.Device.Queue == nil {
+			return ""
+		}
+		return value(result.Device.Queue)
+	}
+}
+
+func host(result *FioResult) *sys.HostInfo {
+	if result.Host == nil {
+		result.Host = &sys.HostInfo{}
+	}
+	return result.Host
+}
+
+func parseInt(value string) int64 {
+	v, _ := strconv.ParseInt(value, 10, 64)
+	return v
+}
+
+// DeviceColumns are the columns of the device metadata, which are rendered only
+// if any result has it.
+var DeviceColumns = []*MetadataColumn{
+	{"model", func(r *FioResult) interface{} { return r.Device.Model },
+		func(r *FioResult, v string) { device(r).Model = v }},
+	{"serial", func(r *FioResult) interface{} { return r.Device.Serial },
+		func(r *FioResult, v string) { device(r).Serial = v }},
+	{"firmware", func(r *FioResult) interface{} { return r.Device.Firmware },
+		func(r *FioResult, v string) { device(r).Firmware = v }},
+	{"size", func(r *FioResult) interface{} { return r.Device.Size },
+		func(r *FioResult, v string) { device(r).Size = uint64(parseInt(v)) }},
+	{"rotational", func(r *FioResult) interface{} { return r.Device.Rotational },
+		func(r *FioResult, v string) { device(r).Rotational, _ = strconv.ParseBool(v) }},
+	{"bus", func(r *FioResult) interface{} { return r.Device.Bus },
+		func(r *FioResult, v string) { device(r).Bus = v }},
+	{"scheduler", queueValue(func(q *sys.QueueInfo) interface{} { return q.Scheduler }),
+		func(r *FioResult, v string) { queue(r).Scheduler = v }},
+	{"nr_requests", queueValue(func(q *sys.QueueInfo) interface{} { return q.NrRequests }),
+		func(r *FioResult, v string) { queue(r).NrRequests = parseInt(v) }},
+	{"read_ahead_kb", queueValue(func(q *sys.QueueInfo) interface{} { return q.ReadAheadKB }),
+		func(r *FioResult, v string) { queue(r).ReadAheadKB = parseInt(v) }},
+	{"max_sectors_kb", queueValue(func(q *sys.QueueInfo) interface{} { return q.MaxSectorsKB }),
+		func(r *FioResult, v string) { queue(r).MaxSectorsKB = parseInt(v) }},
+	{"write_cache", queueValue(func(q *sys.QueueInfo) interface{} { return q.WriteCache }),
+		func(r *FioResult, v string) { queue(r).WriteCache = v }},
+	{"logical_block_size", queueValue(func(q *sys.QueueInfo) interface{} { return q.LogicalBlockSize }),
+		func(r *FioResult, v string) { queue(r).LogicalBlockSize = parseInt(v) }},
+	{"physical_block_size", queueValue(func(q *sys.QueueInfo) interface{} { return q.PhysicalBlockSize }),
+		func(r *FioResult, v string) { queue(r).PhysicalBlockSize = parseInt(v) }},
+}
+
+// HostColumns are the columns of the host facts, which are rendered only if any
+// result has it.
+var HostColumns = []*MetadataColumn{
+	{"hostname", func(r *FioResult) interface{} { return r.Host.Hostname },
+		func(r *FioResult, v string) { host(r).Hostname = v }},
+	{"kernel", func(r *FioResult) interface{} { return r.Host.KernelVersion },
+		func(r *FioResult, v string) { host(r).KernelVersion = v }},
+	{"cpu-model", func(r *FioResult) interface{} { return r.Host.CPUModel },
+		func(r *FioResult, v string) { host(r).CPUModel = v }},
+	{"cpu-cores", func(r *FioResult) interface{} { return r.Host.CPUCores },
+		func(r *FioResult, v string) { host(r).CPUCores = int(parseInt(v)) }},
+	{"memory", func(r *FioResult) interface{} { return r.Host.MemoryBytes },
+		func(r *FioResult, v string) { host(r).MemoryBytes = uint64(parseInt(v)) }},
+}
+
+// metadataValue returns the value of the metadata column, which is empty if the
+// result doesn't have the metadata.
+func metadataValue(c *MetadataColumn, result *FioResult, isDevice bool) interface{} {
+	if isDevice && result.Device == nil || !isDevice && result.Host == nil {
+		return ""
+	}
+	return c.Value(result)
+}
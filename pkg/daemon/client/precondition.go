@@ -0,0 +1,152 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/microyahoo/fio-benchmark/pkg/util/exec"
+)
+
+var (
+	steadyStateCriterion = regexp.MustCompile(`^(iops|iops_slope|bw|bw_slope):[0-9.]+%?$`)
+)
+
+// PreconditionSettings is the preconditioning of a device following SNIA PTS,
+// the device is filled sequentially and then written randomly until the
+// steady state criterion is met.
+type PreconditionSettings struct {
+	FillBlockSize       string `json:"fill_bs" yaml:"fill_bs"`         // 128K by default
+	FillLoops           int32  `json:"fill_loops" yaml:"fill_loops"`   // times of the device capacity to fill, 2 by default
+	BlockSize           string `json:"bs" yaml:"bs"`                   // block size of the random writes, 4K by default
+	IODepth             int32  `json:"iodepth" yaml:"iodepth"`         // 32 by default
+	NumJobs             int32  `json:"numjobs" yaml:"numjobs"`         // 4 by default
+	IOEngine            string `json:"ioengine" yaml:"ioengine"`       // libaio by default
+	SteadyState         string `json:"steadystate" yaml:"steadystate"` // fio steadystate criterion, iops_slope:10% by default
+	SteadyStateDuration uint64 `json:"ss_duration" yaml:"ss_duration"` // seconds of the steady state window, 300 by default
+	SteadyStateRamp     uint64 `json:"ss_ramp" yaml:"ss_ramp"`         // seconds before the steady state is checked
+	MaxRuntime          uint64 `json:"max_runtime" yaml:"max_runtime"` // seconds of the random writes at most, 7200 by default
+}
+
+// Complete fills the defaults of the preconditioning and validates it.
+func (s *PreconditionSettings) Complete() error {
+	if s.FillBlockSize == "" {
+		s.FillBlockSize = "128K"
+	}
+	if s.FillLoops <= 0 {
+		s.FillLoops = 2
+	}
+	if s.BlockSize == "" {
+		s.BlockSize = "4K"
+	}
+	if s.IODepth <= 0 {
+		s.IODepth = 32
+	}
+	if s.NumJobs <= 0 {
+		s.NumJobs = 4
+	}
+	if s.IOEngine == "" {
+		s.IOEngine = "libaio"
+	}
+	if s.SteadyState == "" {
+		s.SteadyState = "iops_slope:10%"
+	}
+	if !steadyStateCriterion.MatchString(s.SteadyState) {
+		return errors.Errorf("invalid steadystate %s, which should be in the format of iops|iops_slope|bw|bw_slope:<value>[%%]", s.SteadyState)
+	}
+	if s.SteadyStateDuration == 0 {
+		s.SteadyStateDuration = 300
+	}
+	if s.MaxRuntime == 0 {
+		s.MaxRuntime = 7200
+	}
+	if s.MaxRuntime < s.SteadyStateDuration+s.SteadyStateRamp {
+		return errors.Errorf("max_runtime %ds should be longer than ss_duration and ss_ramp", s.MaxRuntime)
+	}
+	return nil
+}
+
+// Precondition is the preconditioning of the device before the result was measured.
+type Precondition struct {
+	Settings           *PreconditionSettings `json:"settings"`
+	FillSeconds        float64               `json:"fill_seconds"`
+	SteadyStateSeconds float64               `json:"steadystate_seconds"`
+	Attained           bool                  `json:"attained"` // whether the steady state is attained
+}
+
+// Elapsed returns the time the preconditioning took.
+func (p *Precondition) Elapsed() time.Duration {
+	return time.Duration((p.FillSeconds + p.SteadyStateSeconds) * float64(time.Second))
+}
+
+func (p *Precondition) String() string {
+	s := p.Elapsed().Round(time.Second).String()
+	if !p.Attained {
+		s += " (not steady)"
+	}
+	return s
+}
+
+// RunPrecondition fills the device sequentially and then writes it randomly until
+// the steady state is attained or max_runtime is reached, the precondition is
+// nil in dryrun mode.
+func RunPrecondition(ctx context.Context, executor exec.Executor, filename string, settings *PreconditionSettings, dryrun bool) (*Precondition, error) {
+	p := &Precondition{Settings: settings}
+	fill := []string{
+		"--name", fmt.Sprintf("precondition-fill-%s", uuid.NewString()),
+		"--filename", filename,
+		"--rw", "write",
+		"--bs", settings.FillBlockSize,
+		"--iodepth", "32",
+		"--ioengine", settings.IOEngine,
+		"--direct", "1",
+		"--loops", fmt.Sprintf("%d", settings.FillLoops),
+		"--output-format", "json",
+	}
+	start := time.Now()
+	if _, err := runFio(ctx, executor, fill, dryrun); err != nil {
+		return nil, errors.Wrapf(err, "failed to fill %s", filename)
+	}
+	p.FillSeconds = time.Since(start).Seconds()
+
+	steady := []string{
+		"--name", fmt.Sprintf("precondition-randwrite-%s", uuid.NewString()),
+		"--filename", filename,
+		"--rw", "randwrite",
+		"--bs", settings.BlockSize,
+		"--iodepth", fmt.Sprintf("%d", settings.IODepth),
+		"--numjobs", fmt.Sprintf("%d", settings.NumJobs),
+		"--ioengine", settings.IOEngine,
+		"--direct", "1",
+		"--group_reporting",
+		"--time_based",
+		"--runtime", fmt.Sprintf("%ds", settings.MaxRuntime),
+		"--steadystate", settings.SteadyState,
+		"--ss_dur", fmt.Sprintf("%ds", settings.SteadyStateDuration),
+		"--ss_ramp", fmt.Sprintf("%ds", settings.SteadyStateRamp),
+		"--output-format", "json",
+	}
+	start = time.Now()
+	result, err := runFio(ctx, executor, steady, dryrun)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to write %s randomly until steady state", filename)
+	}
+	p.SteadyStateSeconds = time.Since(start).Seconds()
+	if result == nil {
+		return nil, nil
+	}
+	for _, job := range result.Jobs {
+		if job.SteadyState != nil && job.SteadyState.Attained == 1 {
+			p.Attained = true
+		}
+	}
+	if !p.Attained {
+		klog.Warningf("Steady state %s of %s is not attained within %ds", settings.SteadyState, filename, settings.MaxRuntime)
+	}
+	return p, nil
+}
@@ -0,0 +1,239 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// KneeHeader is the header of the column which marks the knee of the results.
+	KneeHeader = "knee"
+	// PreconditionHeader is the header of the column of the preconditioning time.
+	PreconditionHeader = "precondition"
+	// TuningHeader is the header of the column of the tuned block queue attributes.
+	TuningHeader = "tuning"
+)
+
+// Column is a column of the rendered results.
+type Column struct {
+	Header string
+	Value  func(job *FioJob) interface{}
+}
+
+// PercentileKey returns the key of the percentile in the clat_ns percentile map.
+func PercentileKey(p float64) string {
+	return fmt.Sprintf("%f", p)
+}
+
+// PercentileHeader returns the column header of the completion latency percentile
+// for the direction, eg. latency-read-p99.9(us)
+func PercentileHeader(direction string, p float64) string {
+	return fmt.Sprintf("latency-%s-p%s(us)", direction, strconv.FormatFloat(p, 'f', -1, 64))
+}
+
+// PercentileList returns the percentile list in the format of fio --percentile_list.
+func PercentileList(percentiles []float64) string {
+	var list []string
+	for _, p := range percentiles {
+		list = append(list, strconv.FormatFloat(p, 'f', -1, 64))
+	}
+	return strings.Join(list, ":")
+}
+
+// Percentile returns the completion latency of the percentile in nanoseconds.
+func (r *IOResult) Percentile(p float64) float64 {
+	if r == nil {
+		return 0
+	}
+	return r.ClatNs.Percentile[PercentileKey(p)]
+}
+
+func percentileColumns(direction string, result func(job *FioJob) *IOResult, percentiles []float64) []*Column {
+	var columns []*Column
+	for _, p := range percentiles {
+		p := p
+		columns = append(columns, &Column{
+			Header: PercentileHeader(direction, p),
+			Value: func(job *FioJob) interface{} {
+				return result(job).Percentile(p) / 1000
+			},
+		})
+	}
+	return columns
+}
+
+// DefaultPercentiles are the completion latency percentiles reported if none
+// is configured.
+var DefaultPercentiles = []float64{50, 90, 99, 99.9, 99.99}
+
+// ResultColumns returns the columns of the rendered results, the completion
+// latency columns of the percentiles are included for read, write and trim, the
+// default percentiles are used if they are empty.
+func ResultColumns(percentiles []float64) []*Column {
+	if len(percentiles) == 0 {
+		percentiles = DefaultPercentiles
+	}
+	read := func(job *FioJob) *IOResult { return job.ReadResult }
+	write := func(job *FioJob) *IOResult { return job.WriteResult }
+	trim := func(job *FioJob) *IOResult { return job.TrimResult }
+
+	columns := []*Column{
+		{"filename", func(job *FioJob) interface{} { return job.JobOptions.FileName }},
+		{"rw", func(job *FioJob) interface{} { return job.JobOptions.RW }},
+		{"numjobs", func(job *FioJob) interface{} { return job.JobOptions.NumJobs }},
+		{"runtime", func(job *FioJob) interface{} { return job.JobOptions.Runtime }},
+		{"direct", func(job *FioJob) interface{} { return job.JobOptions.Direct }},
+		{"blocksize", func(job *FioJob) interface{} { return job.JobOptions.BlockSize }},
+		{"iodepth", func(job *FioJob) interface{} { return job.JobOptions.IODepth }},
+		{"read-iops-mean", func(job *FioJob) interface{} { return job.ReadResult.IOPSMean }},
+		{"read-bw-mean(KiB/s)", func(job *FioJob) interface{} { return job.ReadResult.BWMean }},
+		{"latency-read-min(us)", func(job *FioJob) interface{} { return job.ReadResult.LatencyNs.Min / 1000 }},
+		{"latency-read-max(us)", func(job *FioJob) interface{} { return job.ReadResult.LatencyNs.Max / 1000 }},
+		{"latency-read-mean(us)", func(job *FioJob) interface{} { return job.ReadResult.LatencyNs.Mean / 1000 }},
+		{"read-stddev(us)", func(job *FioJob) interface{} { return job.ReadResult.LatencyNs.Stddev / 1000 }},
+	}
+	columns = append(columns, percentileColumns("read", read, percentiles)...)
+	columns = append(columns, []*Column{
+		{"write-iops-mean", func(job *FioJob) interface{} { return job.WriteResult.IOPSMean }},
+		{"write-bw-mean(KiB/s)", func(job *FioJob) interface{} { return job.WriteResult.BWMean }},
+		{"latency-write-min(us)", func(job *FioJob) interface{} { return job.WriteResult.LatencyNs.Min / 1000 }},
+		{"latency-write-max(us)", func(job *FioJob) interface{} { return job.WriteResult.LatencyNs.Max / 1000 }},
+		{"latency-write-mean(us)", func(job *FioJob) interface{} { return job.WriteResult.LatencyNs.Mean / 1000 }},
+		{"latency-write-stddev(us)", func(job *FioJob) interface{} { return job.WriteResult.LatencyNs.Stddev / 1000 }},
+	}...)
+	columns = append(columns, percentileColumns("write", write, percentiles)...)
+	columns = append(columns, percentileColumns("trim", trim, percentiles)...)
+	columns = append(columns, []*Column{
+		{"ioengine", func(job *FioJob) interface{} { return job.JobOptions.IOEngine }},
+		{"verify", func(job *FioJob) interface{} { return job.JobOptions.Verify }},
+	}...)
+	return columns
+}
+
+// RenderResults renders the results in the format of table, markdown, csv, html
+// or json, the client, knee, precondition and tuning columns are only rendered
+// if any result has them, and so are the device and host columns if metadata is
+// true, which are always kept in json.
+func RenderResults(results []*FioResult, w io.Writer, format string, percentiles []float64, metadata bool) {
+	if strings.ToLower(format) == "json" {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			klog.Errorf("Failed to marshal the results: %v", err)
+			return
+		}
+		fmt.Fprintln(w, string(data))
+		return
+	}
+	columns := ResultColumns(percentiles)
+	if Distributed(results) {
+		columns = append([]*Column{{ClientHeader, func(job *FioJob) interface{} { return job.Hostname }}}, columns...)
+	}
+	var knee, precondition, tuning, device, host bool
+	for _, result := range results {
+		knee = knee || result.Knee
+		precondition = precondition || result.Precondition != nil
+		tuning = tuning || len(result.Tuning) > 0
+		device = device || metadata && result.Device != nil
+		host = host || metadata && result.Host != nil
+	}
+	t := table.NewWriter()
+	t.SetOutputMirror(w)
+	var header table.Row
+	for _, c := range columns {
+		header = append(header, c.Header)
+	}
+	if knee {
+		header = append(header, KneeHeader)
+	}
+	if precondition {
+		header = append(header, PreconditionHeader)
+	}
+	if tuning {
+		header = append(header, TuningHeader)
+	}
+	if device {
+		for _, c := range DeviceColumns {
+			header = append(header, c.Header)
+		}
+	}
+	if host {
+		for _, c := range HostColumns {
+			header = append(header, c.Header)
+		}
+	}
+	t.AppendHeader(header)
+	for _, result := range results {
+		for _, job := range result.Jobs {
+			var row table.Row
+			for _, c := range columns {
+				row = append(row, c.Value(job))
+			}
+			if knee {
+				row = append(row, result.Knee)
+			}
+			if precondition {
+				if result.Precondition != nil {
+					row = append(row, result.Precondition.String())
+				} else {
+					row = append(row, "")
+				}
+			}
+			if tuning {
+				row = append(row, strings.Join(result.Tuning, ","))
+			}
+			if device {
+				for _, c := range DeviceColumns {
+					row = append(row, metadataValue(c, result, true))
+				}
+			}
+			if host {
+				for _, c := range HostColumns {
+					row = append(row, metadataValue(c, result, false))
+				}
+			}
+			t.AppendRow(row)
+		}
+		t.AppendSeparator()
+	}
+	t.SortBy([]table.SortBy{
+		{
+			Name: "filename",
+			Mode: table.Asc,
+		},
+		{
+			Name: "numjobs",
+			Mode: table.AscNumeric,
+		},
+		{
+			Name: "iodepth",
+			Mode: table.AscNumeric,
+		},
+		{
+			Name: "rw",
+			Mode: table.Asc,
+		},
+		{
+			Name: "blocksize",
+			Mode: table.Asc,
+		},
+		{
+			Name: ClientHeader,
+			Mode: table.Asc,
+		},
+	})
+	switch strings.ToLower(format) {
+	case "md", "markdown":
+		t.RenderMarkdown()
+	case "csv":
+		t.RenderCSV()
+	case "html":
+		t.RenderHTML()
+	default:
+		t.Render()
+	}
+}
@@ -0,0 +1,152 @@
+package client
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/microyahoo/fio-benchmark/pkg/util/sys"
+)
+
+func TestRenderSuite(t *testing.T) {
+	suite.Run(t, new(renderTestSuite))
+}
+
+type renderTestSuite struct {
+	suite.Suite
+}
+
+func (s *renderTestSuite) TestPercentiles() {
+	s.Equal("99.900000", PercentileKey(99.9))
+	s.Equal("latency-write-p99.99(us)", PercentileHeader("write", 99.99))
+	s.Equal("50:99:99.9", PercentileList([]float64{50, 99, 99.9}))
+	var r *IOResult
+	s.Zero(r.Percentile(99))
+
+	// the default percentiles are rendered if none is configured
+	var headers []string
+	for _, c := range ResultColumns(nil) {
+		if strings.HasPrefix(c.Header, "latency-read-p") {
+			headers = append(headers, c.Header)
+		}
+	}
+	s.Equal([]string{"latency-read-p50(us)", "latency-read-p90(us)", "latency-read-p99(us)",
+		"latency-read-p99.9(us)", "latency-read-p99.99(us)"}, headers)
+}
+
+func (s *renderTestSuite) TestRenderAndParseCSV() {
+	job := &FioJob{
+		JobName: "randrw",
+		JobOptions: &JobOptions{
+			FileName:  "/dev/vdb",
+			RW:        "randrw",
+			NumJobs:   "8",
+			Runtime:   "120s",
+			Direct:    "1",
+			BlockSize: "4K",
+			IODepth:   "32",
+			IOEngine:  "libaio",
+		},
+		ReadResult: &ReadResult{
+			IOPSMean:  100,
+			BWMean:    400,
+			LatencyNs: LatencyNs{Min: 1000, Max: 9000, Mean: 3000, Stddev: 500},
+			ClatNs:    LatencyNs{Percentile: map[string]float64{"99.000000": 8000, "99.900000": 8500}},
+		},
+		WriteResult: &WriteResult{
+			IOPSMean:  50,
+			BWMean:    200,
+			LatencyNs: LatencyNs{Min: 2000, Max: 19000, Mean: 6000, Stddev: 700},
+			ClatNs:    LatencyNs{Percentile: map[string]float64{"99.000000": 18000, "99.900000": 18500}},
+		},
+		TrimResult: &TrimResult{},
+	}
+	var buf bytes.Buffer
+	RenderResults([]*FioResult{{Jobs: []*FioJob{job}}}, &buf, "csv", []float64{99, 99.9}, false)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	s.Len(lines, 2)
+	s.Contains(lines[0], "read-stddev(us),latency-read-p99(us),latency-read-p99.9(us),write-iops-mean")
+	s.Contains(lines[0], "latency-write-p99.9(us),latency-trim-p99(us),latency-trim-p99.9(us),ioengine,verify")
+
+	results, err := ParseCSVResults(&buf)
+	s.NoError(err)
+	s.Len(results, 1)
+	job.JobName = "/dev/vdb"
+	job.TrimResult.ClatNs.Percentile = map[string]float64{"99.000000": 0, "99.900000": 0}
+	s.Equal(job, results[0].Jobs[0])
+}
+
+func (s *renderTestSuite) TestParseExampleCSV() {
+	f, err := os.Open("../../../examples/fio-benchmark.csv")
+	s.NoError(err)
+	defer f.Close()
+	results, err := ParseCSVResults(f)
+	s.NoError(err)
+	s.NotEmpty(results)
+	job := results[0].Jobs[0]
+	s.Equal("/dev/nvme0n1", job.JobOptions.FileName)
+	s.Equal("randread", job.JobOptions.RW)
+	s.Equal(13369.941423, job.ReadResult.IOPSMean)
+	s.Equal(54000.0, job.ReadResult.LatencyNs.Min)
+
+	_, err = ParseCSVResults(strings.NewReader("filename,rw\n/dev/vdb,read\n"))
+	s.Error(err)
+}
+
+func (s *renderTestSuite) TestRenderMetadata() {
+	newJob := func(filename string) *FioJob {
+		return &FioJob{
+			JobOptions:  &JobOptions{FileName: filename, RW: "randread", NumJobs: "1", IODepth: "1", BlockSize: "4K"},
+			ReadResult:  &ReadResult{IOPSMean: 100},
+			WriteResult: &WriteResult{},
+			TrimResult:  &TrimResult{},
+		}
+	}
+	host := &sys.HostInfo{Hostname: "node1", KernelVersion: "5.15.0", CPUModel: "Intel(R) Xeon(R) Gold 6330", CPUCores: 56, MemoryBytes: 270049857536}
+	results := []*FioResult{
+		{
+			Jobs: []*FioJob{newJob("/dev/nvme0n1")},
+			Device: &Device{Model: "SAMSUNG MZQL23T8HCLS-00A07", Serial: "S64HNE0R100001", Firmware: "GDC5602Q", Size: 3840755982336, Bus: "nvme",
+				Queue: &sys.QueueInfo{Scheduler: "none", NrRequests: 1023, ReadAheadKB: 128, MaxSectorsKB: 128, WriteCache: "write through",
+					LogicalBlockSize: 512, PhysicalBlockSize: 512}},
+			Host: host,
+		},
+		{Jobs: []*FioJob{newJob("/data/fio.db")}, Host: host},
+	}
+	// the output isn't changed by the metadata unless it's shown
+	var buf bytes.Buffer
+	RenderResults(results, &buf, "csv", nil, false)
+	s.NotContains(buf.String(), "model")
+	s.NotContains(buf.String(), "hostname")
+	s.True(strings.HasSuffix(strings.Split(buf.String(), "\n")[0], ",ioengine,verify"))
+
+	buf.Reset()
+	RenderResults(results, &buf, "csv", nil, true)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	s.Len(lines, 3)
+	s.True(strings.HasSuffix(lines[0], ",model,serial,firmware,size,rotational,bus,scheduler,nr_requests,read_ahead_kb,"+
+		"max_sectors_kb,write_cache,logical_block_size,physical_block_size,hostname,kernel,cpu-model,cpu-cores,memory"), lines[0])
+	s.True(strings.HasSuffix(lines[1], ",,,,,,,,,,,,,,node1,5.15.0,Intel(R) Xeon(R) Gold 6330,56,270049857536"), lines[1])
+
+	parsed, err := ParseCSVResults(&buf)
+	s.NoError(err)
+	s.Nil(parsed[0].Device)
+	s.Equal(host, parsed[0].Host)
+	s.Equal(results[0].Device, parsed[1].Device)
+
+	buf.Reset()
+	RenderResults(results, &buf, "json", nil, false)
+	var decoded []*FioResult
+	s.NoError(json.Unmarshal(buf.Bytes(), &decoded))
+	s.Equal("GDC5602Q", decoded[0].Device.Firmware)
+	s.Equal("none", decoded[0].Device.Queue.Scheduler)
+	s.Equal(host, decoded[1].Host)
+
+	buf.Reset()
+	RenderResults([]*FioResult{{Jobs: []*FioJob{newJob("/dev/vdb")}}}, &buf, "csv", nil, true)
+	s.NotContains(buf.String(), "model")
+	s.NotContains(buf.String(), "hostname")
+}
@@ -0,0 +1,230 @@
+package client
+
+import (
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+
+	"github.com/microyahoo/fio-benchmark/pkg/util/sys"
+)
+
+// tCritical95 is the two-sided 95% critical values of Student's t-distribution
+// indexed by the degrees of freedom, the normal value 1.96 is used above 30.
+var tCritical95 = []float64{0,
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// Stats is the summary of the values of repeated trials.
+type Stats struct {
+	N      int     `json:"n"`
+	Mean   float64 `json:"mean"`
+	Stddev float64 `json:"stddev"` // sample standard deviation
+	CV     float64 `json:"cv"`     // coefficient of variation in percent
+	CI95   float64 `json:"ci95"`   // half width of the 95% confidence interval of the mean
+}
+
+// NewStats summarizes the values.
+func NewStats(values []float64) Stats {
+	s := Stats{N: len(values)}
+	if s.N == 0 {
+		return s
+	}
+	for _, v := range values {
+		s.Mean += v
+	}
+	s.Mean /= float64(s.N)
+	if s.N == 1 {
+		return s
+	}
+	var sum float64
+	for _, v := range values {
+		sum += (v - s.Mean) * (v - s.Mean)
+	}
+	s.Stddev = math.Sqrt(sum / float64(s.N-1))
+	if s.Mean != 0 {
+		s.CV = s.Stddev / math.Abs(s.Mean) * 100
+	}
+	t := 1.96
+	if df := s.N - 1; df < len(tCritical95) {
+		t = tCritical95[df]
+	}
+	s.CI95 = t * s.Stddev / math.Sqrt(float64(s.N))
+	return s
+}
+
+// DirectionStats is the summary of the IOPS, bandwidth and mean latency of a direction.
+type DirectionStats struct {
+	Direction string `json:"direction"`
+	IOPS      Stats  `json:"iops"`
+	BW        Stats  `json:"bw"`      // KiB/s
+	Latency   Stats  `json:"latency"` // us
+}
+
+// AggregatedResult is the summary of the repeated trials of the same job options.
+type AggregatedResult struct {
+	Options    *JobOptions       `json:"options"`
+	Trials     int               `json:"trials"`
+	Directions []*DirectionStats `json:"directions"`
+	Unstable   bool              `json:"unstable"`
+	Device     *Device           `json:"device,omitempty"`
+	Host       *sys.HostInfo     `json:"host,omitempty"`
+	Tuning     []string          `json:"tuning,omitempty"`
+	Client     string            `json:"client,omitempty"` // fio server of the distributed results
+	Label      string            `json:"label,omitempty"`
+}
+
+func aggregateKey(job *FioJob, tuning []string) string {
+	o := job.JobOptions
+	return strings.Join([]string{o.FileName, o.RW, o.BlockSize, o.NumJobs, o.IODepth, o.Runtime, o.Direct, o.IOEngine, o.Verify,
+		strings.Join(tuning, ","), job.Hostname}, "|")
+}
+
+// AggregateResults groups the results by job options and tuning and summarizes
+// the repeated trials, the result is unstable if the CV of any metric is above
+// maxCV percent.
+func AggregateResults(results []*FioResult, maxCV float64) []*AggregatedResult {
+	var (
+		keys   []string
+		groups = make(map[string][]*FioJob)
+		firsts = make(map[string]*FioResult)
+	)
+	for _, result := range results {
+		for _, job := range result.Jobs {
+			if job.JobOptions == nil {
+				continue
+			}
+			key := aggregateKey(job, result.Tuning)
+			if _, ok := groups[key]; !ok {
+				keys = append(keys, key)
+				firsts[key] = result
+			}
+			groups[key] = append(groups[key], job)
+		}
+	}
+	sort.Strings(keys)
+	var aggregated []*AggregatedResult
+	for _, key := range keys {
+		jobs := groups[key]
+		a := &AggregatedResult{Options: jobs[0].JobOptions, Trials: len(jobs), Device: firsts[key].Device, Host: firsts[key].Host,
+			Tuning: firsts[key].Tuning, Client: jobs[0].Hostname, Label: firsts[key].Label}
+		directions := []struct {
+			name   string
+			result func(job *FioJob) *IOResult
+		}{
+			{"read", func(job *FioJob) *IOResult { return job.ReadResult }},
+			{"write", func(job *FioJob) *IOResult { return job.WriteResult }},
+			{"trim", func(job *FioJob) *IOResult { return job.TrimResult }},
+		}
+		for _, d := range directions {
+			var iops, bw, lat []float64
+			var active bool
+			for _, job := range jobs {
+				r := d.result(job)
+				if r == nil {
+					r = &IOResult{}
+				}
+				active = active || r.TotalIOs > 0 || r.IOPSMean > 0
+				iops = append(iops, r.IOPSMean)
+				bw = append(bw, r.BWMean)
+				lat = append(lat, r.LatencyNs.Mean/1000)
+			}
+			if !active {
+				continue
+			}
+			s := &DirectionStats{Direction: d.name, IOPS: NewStats(iops), BW: NewStats(bw), Latency: NewStats(lat)}
+			a.Unstable = a.Unstable || s.IOPS.CV > maxCV || s.BW.CV > maxCV || s.Latency.CV > maxCV
+			a.Directions = append(a.Directions, s)
+		}
+		aggregated = append(aggregated, a)
+	}
+	return aggregated
+}
+
+// MeanResult returns a result with the mean IOPS, bandwidth and latency of the trials.
+func (a *AggregatedResult) MeanResult() *FioResult {
+	job := &FioJob{
+		JobName:     a.Options.FileName,
+		JobOptions:  a.Options,
+		ReadResult:  &ReadResult{},
+		WriteResult: &WriteResult{},
+		TrimResult:  &TrimResult{},
+		Hostname:    a.Client,
+	}
+	for _, d := range a.Directions {
+		var r *IOResult
+		switch d.Direction {
+		case "read":
+			r = job.ReadResult
+		case "write":
+			r = job.WriteResult
+		default:
+			r = job.TrimResult
+		}
+		r.IOPSMean = d.IOPS.Mean
+		r.BWMean = d.BW.Mean
+		r.LatencyNs.Mean = d.Latency.Mean * 1000
+	}
+	return &FioResult{Jobs: []*FioJob{job}, Device: a.Device, Host: a.Host, Tuning: a.Tuning, Label: a.Label}
+}
+
+// RenderAggregatedResults renders the aggregated results in the format of table,
+// markdown, csv or html, one row for each direction of the job options.
+func RenderAggregatedResults(aggregated []*AggregatedResult, w io.Writer, format string) {
+	var tuning, distributed bool
+	for _, a := range aggregated {
+		tuning = tuning || len(a.Tuning) > 0
+		distributed = distributed || a.Client != ""
+	}
+	t := table.NewWriter()
+	t.SetOutputMirror(w)
+	header := table.Row{"filename", "rw", "numjobs", "blocksize", "iodepth", "direction", "trials",
+		"iops-mean", "iops-stddev", "iops-cv(%)", "iops-ci95",
+		"bw-mean(KiB/s)", "bw-stddev(KiB/s)", "bw-cv(%)", "bw-ci95(KiB/s)",
+		"latency-mean(us)", "latency-stddev(us)", "latency-cv(%)", "latency-ci95(us)", "unstable"}
+	if tuning {
+		header = append(header, TuningHeader)
+	}
+	if distributed {
+		header = append(table.Row{ClientHeader}, header...)
+	}
+	t.AppendHeader(header)
+	for _, a := range aggregated {
+		o := a.Options
+		for _, d := range a.Directions {
+			row := table.Row{o.FileName, o.RW, o.NumJobs, o.BlockSize, o.IODepth, d.Direction, a.Trials,
+				d.IOPS.Mean, d.IOPS.Stddev, d.IOPS.CV, d.IOPS.CI95,
+				d.BW.Mean, d.BW.Stddev, d.BW.CV, d.BW.CI95,
+				d.Latency.Mean, d.Latency.Stddev, d.Latency.CV, d.Latency.CI95, a.Unstable}
+			if tuning {
+				row = append(row, strings.Join(a.Tuning, ","))
+			}
+			if distributed {
+				row = append(table.Row{a.Client}, row...)
+			}
+			t.AppendRow(row)
+		}
+	}
+	t.SortBy([]table.SortBy{
+		{Name: "filename", Mode: table.Asc},
+		{Name: "numjobs", Mode: table.AscNumeric},
+		{Name: "iodepth", Mode: table.AscNumeric},
+		{Name: "rw", Mode: table.Asc},
+		{Name: "blocksize", Mode: table.Asc},
+		{Name: ClientHeader, Mode: table.Asc},
+	})
+	switch strings.ToLower(format) {
+	case "md", "markdown":
+		t.RenderMarkdown()
+	case "csv":
+		t.RenderCSV()
+	case "html":
+		t.RenderHTML()
+	default:
+		t.Render()
+	}
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestStatsSuite(t *testing.T) {
+	suite.Run(t, new(statsTestSuite))
+}
+
+type statsTestSuite struct {
+	suite.Suite
+}
+
+func (s *statsTestSuite) TestNewStats() {
+	s.Equal(Stats{}, NewStats(nil))
+	s.Equal(Stats{N: 1, Mean: 5}, NewStats([]float64{5}))
+
+	stats := NewStats([]float64{10, 12, 14})
+	s.Equal(3, stats.N)
+	s.Equal(12.0, stats.Mean)
+	s.Equal(2.0, stats.Stddev)
+	s.InDelta(16.667, stats.CV, 0.001)
+	s.InDelta(4.303*2/math.Sqrt(3), stats.CI95, 1e-9)
+
+	values := make([]float64, 40)
+	for i := range values {
+		values[i] = float64(i % 2)
+	}
+	stats = NewStats(values)
+	s.InDelta(1.96*stats.Stddev/math.Sqrt(40), stats.CI95, 1e-9)
+}
+
+func newTrial(filename, rw string, readIOPS, writeIOPS float64) *FioResult {
+	return &FioResult{Jobs: []*FioJob{{
+		JobOptions: &JobOptions{FileName: filename, RW: rw, BlockSize: "4K", NumJobs: "1", IODepth: "8"},
+		ReadResult: &ReadResult{
+			IOPSMean:  readIOPS,
+			BWMean:    readIOPS * 4,
+			LatencyNs: LatencyNs{Mean: 100000},
+		},
+		WriteResult: &WriteResult{
+			IOPSMean:  writeIOPS,
+			BWMean:    writeIOPS * 4,
+			LatencyNs: LatencyNs{Mean: 200000},
+		},
+		TrimResult: &TrimResult{},
+	}}}
+}
+
+func (s *statsTestSuite) TestAggregateResults() {
+	results := []*FioResult{
+		newTrial("/dev/vdb", "randread", 1000, 0),
+		newTrial("/dev/vdc", "randrw", 500, 500),
+		newTrial("/dev/vdb", "randread", 1010, 0),
+		newTrial("/dev/vdc", "randrw", 500, 800),
+		newTrial("/dev/vdb", "randread", 990, 0),
+	}
+	aggregated := AggregateResults(results, 10)
+	s.Len(aggregated, 2)
+
+	vdb := aggregated[0]
+	s.Equal("/dev/vdb", vdb.Options.FileName)
+	s.Equal(3, vdb.Trials)
+	s.Len(vdb.Directions, 1)
+	s.Equal("read", vdb.Directions[0].Direction)
+	s.InDelta(1000, vdb.Directions[0].IOPS.Mean, 1e-9)
+	s.InDelta(4000, vdb.Directions[0].BW.Mean, 1e-9)
+	s.InDelta(100, vdb.Directions[0].Latency.Mean, 1e-9)
+	s.False(vdb.Unstable)
+
+	vdc := aggregated[1]
+	s.Equal(2, vdc.Trials)
+	s.Len(vdc.Directions, 2)
+	s.Equal("write", vdc.Directions[1].Direction)
+	s.True(vdc.Unstable)
+
+	mean := vdc.MeanResult()
+	s.Equal(500.0, mean.Jobs[0].ReadResult.IOPSMean)
+	s.Equal(650.0, mean.Jobs[0].WriteResult.IOPSMean)
+	s.Equal(200000.0, mean.Jobs[0].WriteResult.LatencyNs.Mean)
+
+	var buf bytes.Buffer
+	RenderAggregatedResults(aggregated, &buf, "csv")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	s.Len(lines, 4)
+	s.True(strings.HasPrefix(lines[0], "filename,rw,numjobs,blocksize,iodepth,direction,trials,iops-mean,"))
+	s.True(strings.HasSuffix(lines[0], ",unstable"))
+	s.True(strings.HasPrefix(lines[1], "/dev/vdb,randread,1,4K,8,read,3,1000,"))
+	s.True(strings.HasSuffix(lines[3], ",true"))
+}
+
+func (s *statsTestSuite) TestAggregateTunedResults() {
+	tuned := func(readIOPS float64, tuning ...string) *FioResult {
+		result := newTrial("/dev/vdb", "randread", readIOPS, 0)
+		result.Tuning = tuning
+		return result
+	}
+	results := []*FioResult{
+		tuned(1000, "scheduler=none"),
+		tuned(2000, "scheduler=kyber"),
+		tuned(1010, "scheduler=none"),
+		tuned(2020, "scheduler=kyber"),
+	}
+	aggregated := AggregateResults(results, 10)
+	s.Len(aggregated, 2)
+	s.Equal([]string{"scheduler=kyber"}, aggregated[0].Tuning)
+	s.InDelta(2010, aggregated[0].Directions[0].IOPS.Mean, 1e-9)
+	s.Equal([]string{"scheduler=none"}, aggregated[1].Tuning)
+	s.InDelta(1005, aggregated[1].Directions[0].IOPS.Mean, 1e-9)
+	s.Equal([]string{"scheduler=none"}, aggregated[1].MeanResult().Tuning)
+
+	var buf bytes.Buffer
+	RenderAggregatedResults(aggregated, &buf, "csv")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	s.Len(lines, 3)
+	s.True(strings.HasSuffix(lines[0], ",unstable,tuning"))
+	s.True(strings.HasSuffix(lines[1], ",scheduler=kyber"))
+}
@@ -0,0 +1,314 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/components"
+	"github.com/go-echarts/go-echarts/v2/opts"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/pkg/errors"
+)
+
+// StableRatio is the ratio of the mean below which the throughput of a window
+// is counted as unstable, eg. a throttling, a GC stall or a write cliff.
+const StableRatio = 0.9
+
+// logDirections are the data directions of the fio log entries, eg. 0 is read.
+var logDirections = []string{"read", "write", "trim"}
+
+// TimeSeries are the samples of a direction logged by fio every log_avg_msec,
+// the jobs of the result are summed up for IOPS and bandwidth and averaged for
+// latency.
+type TimeSeries struct {
+	Direction string    `json:"direction"`
+	Interval  uint64    `json:"interval"` // ms
+	Time      []uint64  `json:"time"`     // ms since the jobs started
+	IOPS      []float64 `json:"iops"`
+	BW        []float64 `json:"bw"`      // KiB/s
+	Latency   []float64 `json:"latency"` // mean latency in us
+
+	Stability *Stability `json:"stability,omitempty"`
+}
+
+// Stability summarizes the samples of the time series, the below percent is the
+// percentage of the time whose throughput is below StableRatio of the mean.
+type Stability struct {
+	IOPSMin       float64 `json:"iops_min"`
+	IOPSMax       float64 `json:"iops_max"`
+	IOPSBelow     float64 `json:"iops_below"` // percent
+	BWMin         float64 `json:"bw_min"`     // KiB/s
+	BWMax         float64 `json:"bw_max"`
+	BWBelow       float64 `json:"bw_below"`    // percent
+	LatencyMin    float64 `json:"latency_min"` // us
+	LatencyMax    float64 `json:"latency_max"`
+	LatencyStddev float64 `json:"latency_stddev"`
+}
+
+// TimeSeriesArgs returns the fio arguments which log the bandwidth, IOPS and
+// latency averaged over every logAvgMsec into the files prefixed by prefix.
+func TimeSeriesArgs(prefix string, logAvgMsec uint64) []string {
+	return []string{
+		"--write_bw_log", prefix,
+		"--write_iops_log", prefix,
+		"--write_lat_log", prefix,
+		"--log_avg_msec", strconv.FormatUint(logAvgMsec, 10),
+	}
+}
+
+// ParseTimeSeries parses the logs written by fio with TimeSeriesArgs, one log
+// file is written for each job, eg. <prefix>_bw.1.log. The samples are bucketed
+// by logAvgMsec so that the samples of the jobs are merged.
+func ParseTimeSeries(prefix string, logAvgMsec uint64) ([]*TimeSeries, error) {
+	if logAvgMsec == 0 {
+		return nil, errors.New("log_avg_msec should be positive")
+	}
+	type bucket struct {
+		iops, bw, lat float64
+		latSamples    int
+	}
+	buckets := make([]map[uint64]*bucket, len(logDirections))
+	for i := range buckets {
+		buckets[i] = make(map[uint64]*bucket)
+	}
+	for _, kind := range []string{"iops", "bw", "lat"} {
+		files, err := filepath.Glob(fmt.Sprintf("%s_%s.*log", prefix, kind))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			err = parseLog(file, func(msec uint64, value float64, ddir int) {
+				if ddir < 0 || ddir >= len(logDirections) {
+					return
+				}
+				index := (msec + logAvgMsec/2) / logAvgMsec
+				b, ok := buckets[ddir][index]
+				if !ok {
+					b = &bucket{}
+					buckets[ddir][index] = b
+				}
+				switch kind {
+				case "iops":
+					b.iops += value
+				case "bw":
+					b.bw += value
+				default:
+					b.lat += value / 1000
+					b.latSamples++
+				}
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	var series []*TimeSeries
+	for ddir, direction := range logDirections {
+		if len(buckets[ddir]) == 0 {
+			continue
+		}
+		indexes := make([]uint64, 0, len(buckets[ddir]))
+		for index := range buckets[ddir] {
+			indexes = append(indexes, index)
+		}
+		sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+		ts := &TimeSeries{Direction: direction, Interval: logAvgMsec}
+		for _, index := range indexes {
+			b := buckets[ddir][index]
+			var lat float64
+			if b.latSamples > 0 {
+				lat = b.lat / float64(b.latSamples)
+			}
+			ts.Time = append(ts.Time, index*logAvgMsec)
+			ts.IOPS = append(ts.IOPS, b.iops)
+			ts.BW = append(ts.BW, b.bw)
+			ts.Latency = append(ts.Latency, lat)
+		}
+		ts.Stability = NewStability(ts)
+		series = append(series, ts)
+	}
+	return series, nil
+}
+
+// parseLog parses the fio log entries in the format of "time, value, data
+// direction, block size, offset[, priority]".
+func parseLog(file string, add func(msec uint64, value float64, ddir int)) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		fields := strings.Split(text, ",")
+		if len(fields) < 3 {
+			return errors.Errorf("invalid entry at line %d of %s: %s", line, file, text)
+		}
+		msec, err := strconv.ParseUint(strings.TrimSpace(fields[0]), 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "invalid time at line %d of %s", line, file)
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+		if err != nil {
+			return errors.Wrapf(err, "invalid value at line %d of %s", line, file)
+		}
+		ddir, err := strconv.Atoi(strings.TrimSpace(fields[2]))
+		if err != nil {
+			return errors.Wrapf(err, "invalid data direction at line %d of %s", line, file)
+		}
+		add(msec, value, ddir)
+	}
+	return scanner.Err()
+}
+
+// NewStability summarizes the samples of the time series.
+func NewStability(ts *TimeSeries) *Stability {
+	s := &Stability{}
+	s.IOPSMin, s.IOPSMax, s.IOPSBelow = summarize(ts.IOPS)
+	s.BWMin, s.BWMax, s.BWBelow = summarize(ts.BW)
+	s.LatencyMin, s.LatencyMax, _ = summarize(ts.Latency)
+	s.LatencyStddev = NewStats(ts.Latency).Stddev
+	return s
+}
+
+// summarize returns the min and the max of the samples, and the percentage of
+// the samples which are below StableRatio of their mean.
+func summarize(samples []float64) (min, max, below float64) {
+	if len(samples) == 0 {
+		return 0, 0, 0
+	}
+	min, max = math.Inf(1), math.Inf(-1)
+	var sum float64
+	for _, v := range samples {
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+		sum += v
+	}
+	threshold := sum / float64(len(samples)) * StableRatio
+	var n int
+	for _, v := range samples {
+		if v < threshold {
+			n++
+		}
+	}
+	return min, max, float64(n) / float64(len(samples)) * 100
+}
+
+// timeSeriesName returns the name of the result in the time series charts and
+// the stability report, eg. /dev/sdb-randread-4K-32-4.
+func timeSeriesName(result *FioResult) string {
+	job := result.SummaryJobs()[0]
+	o := job.JobOptions
+	if o == nil || o.FileName == "" {
+		return job.JobName
+	}
+	return fmt.Sprintf("%s-%s-%s-%s-%s", seriesName(result, job), o.RW, o.BlockSize, o.IODepth, o.NumJobs)
+}
+
+// addTimeSeriesCharts adds the IOPS, bandwidth and latency charts over time of
+// each result which has the time series.
+func addTimeSeriesCharts(page *components.Page, results []*FioResult) {
+	seen := make(map[string]int)
+	for _, result := range results {
+		if len(result.TimeSeries) == 0 || len(result.Jobs) == 0 {
+			continue
+		}
+		name := timeSeriesName(result)
+		seen[name]++
+		if seen[name] > 1 {
+			name = fmt.Sprintf("%s#%d", name, seen[name])
+		}
+		metrics := []struct {
+			title, yaxis string
+			values       func(ts *TimeSeries) []float64
+		}{
+			{"iops", "iops", func(ts *TimeSeries) []float64 { return ts.IOPS }},
+			{"bw", "bandwidth(KiB/s)", func(ts *TimeSeries) []float64 { return ts.BW }},
+			{"lat", "latency(us)", func(ts *TimeSeries) []float64 { return ts.Latency }},
+		}
+		for _, m := range metrics {
+			line := charts.NewLine()
+			line.SetGlobalOptions(
+				charts.WithTitleOpts(opts.Title{Title: fmt.Sprintf("%s-%s", m.title, name)}),
+				charts.WithTooltipOpts(opts.Tooltip{Show: true, Trigger: "axis"}),
+				charts.WithLegendOpts(opts.Legend{Show: true, Width: "50%", Left: "right"}),
+				charts.WithInitializationOpts(opts.Initialization{Theme: "shine"}),
+				charts.WithXAxisOpts(opts.XAxis{Name: "time(s)", Type: "value"}),
+				charts.WithYAxisOpts(opts.YAxis{Name: m.yaxis}),
+			)
+			for _, ts := range result.TimeSeries {
+				values := m.values(ts)
+				data := make([]opts.LineData, 0, len(values))
+				for i, v := range values {
+					data = append(data, opts.LineData{Value: []interface{}{float64(ts.Time[i]) / 1000, v}})
+				}
+				line.AddSeries(ts.Direction, data, charts.WithLineChartOpts(opts.LineChart{ShowSymbol: false}))
+			}
+			page.AddCharts(line)
+		}
+	}
+}
+
+// HasTimeSeries returns true if any of the results has the time series.
+func HasTimeSeries(results []*FioResult) bool {
+	for _, result := range results {
+		if len(result.TimeSeries) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// RenderStability renders the stability of the time series of the results in
+// the format of table, markdown, csv or html, one row for each direction.
+func RenderStability(results []*FioResult, w io.Writer, format string) {
+	var logged []*FioResult
+	for _, result := range results {
+		if len(result.TimeSeries) > 0 && len(result.Jobs) > 0 {
+			logged = append(logged, result)
+		}
+	}
+	sort.SliceStable(logged, func(i, j int) bool {
+		return timeSeriesName(logged[i]) < timeSeriesName(logged[j])
+	})
+	t := table.NewWriter()
+	t.SetOutputMirror(w)
+	below := fmt.Sprintf("below-%d%%-mean(%%)", int(StableRatio*100))
+	t.AppendHeader(table.Row{"result", "direction", "samples", "interval(ms)",
+		"iops-min", "iops-max", "iops-" + below, "bw-min(KiB/s)", "bw-max(KiB/s)", "bw-" + below,
+		"latency-min(us)", "latency-max(us)", "latency-stddev(us)"})
+	for _, result := range logged {
+		name := timeSeriesName(result)
+		for _, ts := range result.TimeSeries {
+			s := ts.Stability
+			if s == nil {
+				s = NewStability(ts)
+			}
+			t.AppendRow(table.Row{name, ts.Direction, len(ts.Time), ts.Interval,
+				s.IOPSMin, s.IOPSMax, s.IOPSBelow, s.BWMin, s.BWMax, s.BWBelow,
+				s.LatencyMin, s.LatencyMax, s.LatencyStddev})
+		}
+	}
+	switch strings.ToLower(format) {
+	case "md", "markdown":
+		t.RenderMarkdown()
+	case "csv":
+		t.RenderCSV()
+	case "html":
+		t.RenderHTML()
+	default:
+		t.Render()
+	}
+}
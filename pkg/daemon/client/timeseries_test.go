@@ -0,0 +1,84 @@
+package client
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestTimeSeriesSuite(t *testing.T) {
+	suite.Run(t, new(timeSeriesTestSuite))
+}
+
+type timeSeriesTestSuite struct {
+	suite.Suite
+}
+
+func (s *timeSeriesTestSuite) TestParseTimeSeries() {
+	prefix := filepath.Join(s.T().TempDir(), "fio")
+	logs := map[string]string{
+		// the windows of the jobs are slightly shifted
+		"_iops.1.log": "1000, 100, 0, 4096, 0\n2001, 100, 0, 4096, 0\n3000, 20, 0, 4096, 0\n4000, 100, 0, 4096, 0\n",
+		"_iops.2.log": "999, 100, 0, 4096, 0\n2000, 100, 0, 4096, 0\n3002, 20, 0, 4096, 0\n4001, 100, 0, 4096, 0\n",
+		"_bw.1.log":   "1000, 400, 0, 4096, 0\n2000, 400, 0, 4096, 0\n3000, 80, 0, 4096, 0\n4000, 400, 0, 4096, 0\n",
+		"_lat.1.log":  "1000, 1000, 0, 4096, 0\n2000, 1000, 0, 4096, 0\n3000, 9000, 0, 4096, 0\n4000, 1000, 0, 4096, 0\n",
+		"_lat.2.log":  "1000, 3000, 0, 4096, 0\n2000, 3000, 0, 4096, 0\n3000, 11000, 0, 4096, 0\n4000, 3000, 0, 4096, 0\n",
+		// the completion latency isn't parsed
+		"_clat.1.log": "1000, 999999, 0, 4096, 0\n",
+	}
+	for suffix, content := range logs {
+		s.Require().NoError(os.WriteFile(prefix+suffix, []byte(content), 0644))
+	}
+	series, err := ParseTimeSeries(prefix, 1000)
+	s.Require().NoError(err)
+	s.Require().Len(series, 1)
+	ts := series[0]
+	s.Equal("read", ts.Direction)
+	s.Equal([]uint64{1000, 2000, 3000, 4000}, ts.Time)
+	s.Equal([]float64{200, 200, 40, 200}, ts.IOPS)
+	s.Equal([]float64{400, 400, 80, 400}, ts.BW)
+	s.Equal([]float64{2, 2, 10, 2}, ts.Latency)
+	s.Equal(40.0, ts.Stability.IOPSMin)
+	s.Equal(200.0, ts.Stability.IOPSMax)
+	s.Equal(25.0, ts.Stability.IOPSBelow)
+	s.Equal(25.0, ts.Stability.BWBelow)
+	s.Equal(10.0, ts.Stability.LatencyMax)
+
+	s.Require().NoError(os.WriteFile(prefix+"_bw.2.log", []byte("1000, x, 0, 4096, 0\n"), 0644))
+	_, err = ParseTimeSeries(prefix, 1000)
+	s.Error(err)
+	_, err = ParseTimeSeries(prefix, 0)
+	s.Error(err)
+}
+
+func (s *timeSeriesTestSuite) TestRender() {
+	ts := &TimeSeries{Direction: "write", Interval: 500, Time: []uint64{500, 1000}, IOPS: []float64{10, 8}, BW: []float64{40, 32}, Latency: []float64{100, 120}}
+	ts.Stability = NewStability(ts)
+	result := &FioResult{
+		Jobs: []*FioJob{{
+			JobName:     "randwrite",
+			JobOptions:  &JobOptions{FileName: "/dev/vdb", RW: "randwrite", BlockSize: "4K", IODepth: "8", NumJobs: "1"},
+			ReadResult:  &ReadResult{},
+			WriteResult: &WriteResult{IOPSMean: 9},
+			TrimResult:  &TrimResult{},
+		}},
+		TimeSeries: []*TimeSeries{ts},
+	}
+	s.True(HasTimeSeries([]*FioResult{{}, result}))
+	s.False(HasTimeSeries([]*FioResult{{}}))
+
+	var b bytes.Buffer
+	RenderStability([]*FioResult{result}, &b, "csv")
+	s.Contains(b.String(), "result,direction,samples,interval(ms),iops-min,iops-max,iops-below-90%-mean(%)")
+	s.Contains(b.String(), "/dev/vdb-randwrite-4K-8-1,write,2,500,8,10,50,32,40,50,100,120,")
+
+	chartFile := filepath.Join(s.T().TempDir(), "chart.html")
+	s.NoError(RenderCharts([]*FioResult{result, result}, chartFile, "", nil))
+	data, err := os.ReadFile(chartFile)
+	s.NoError(err)
+	s.Contains(string(data), "iops-/dev/vdb-randwrite-4K-8-1")
+	s.Contains(string(data), "lat-/dev/vdb-randwrite-4K-8-1#2")
+}
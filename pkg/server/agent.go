@@ -0,0 +1,501 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+	"github.com/microyahoo/fio-benchmark/pkg/store"
+	"github.com/microyahoo/fio-benchmark/pkg/util/exec"
+)
+
+const (
+	runConfigFile  = "conf.yaml"
+	runInfoFile    = "run.json"
+	runResultsFile = "results.json"
+	runChartFile   = "chart.html"
+)
+
+// RunStatus is the status of the run submitted to the agent.
+type RunStatus string
+
+const (
+	RunQueued   RunStatus = "queued"
+	RunRunning  RunStatus = "running"
+	RunFinished RunStatus = "finished"
+	RunFailed   RunStatus = "failed"
+	RunCanceled RunStatus = "canceled"
+)
+
+// Done returns true if the run won't be changed any more.
+func (s RunStatus) Done() bool {
+	return s == RunFinished || s == RunFailed || s == RunCanceled
+}
+
+// ItemStatus is the status of the work item of the run.
+type ItemStatus string
+
+const (
+	ItemPending  ItemStatus = "pending"
+	ItemRunning  ItemStatus = "running"
+	ItemFinished ItemStatus = "finished"
+	ItemSkipped  ItemStatus = "skipped"
+	ItemFailed   ItemStatus = "failed"
+)
+
+var (
+	// ErrRunNotFound is returned if there is no run with the id.
+	ErrRunNotFound = errors.New("run not found")
+	// ErrRunDone is returned if the run is already finished, failed or canceled.
+	ErrRunDone = errors.New("run is already done")
+)
+
+// ItemProgress is the progress of the work item of the run.
+type ItemProgress struct {
+	ID      string     `json:"id"`
+	Item    string     `json:"item"`
+	Device  string     `json:"device"`
+	Status  ItemStatus `json:"status"`
+	Error   string     `json:"error,omitempty"`
+	Results int        `json:"results"` // number of the results, eg. the trials of slo search
+
+	done bool // finished, skipped or failed, which is counted in the finished of the run
+}
+
+// Run is the benchmark run submitted to the agent.
+type Run struct {
+	ID         string          `json:"id"`
+	Status     RunStatus       `json:"status"`
+	Error      string          `json:"error,omitempty"`
+	Dryrun     bool            `json:"dryrun"`
+	CreatedAt  time.Time       `json:"created_at"`
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+	Total      int             `json:"total"`
+	Finished   int             `json:"finished"` // number of the items finished, skipped or failed
+	Items      []*ItemProgress `json:"items,omitempty"`
+
+	dir      string
+	canceled bool
+	server   *FioServer
+	results  []*client.FioResult
+	items    map[string]*ItemProgress // keyed by the id of the work item
+}
+
+// snapshot returns a copy of the run which can be used without the lock.
+func (r *Run) snapshot() *Run {
+	run := &Run{
+		ID:         r.ID,
+		Status:     r.Status,
+		Error:      r.Error,
+		Dryrun:     r.Dryrun,
+		CreatedAt:  r.CreatedAt,
+		StartedAt:  r.StartedAt,
+		FinishedAt: r.FinishedAt,
+		Total:      r.Total,
+		Finished:   r.Finished,
+		dir:        r.dir,
+	}
+	for _, item := range r.Items {
+		progress := *item
+		run.Items = append(run.Items, &progress)
+	}
+	return run
+}
+
+// Dir returns the directory of the run, where the config, the results and the
+// chart of the run are saved.
+func (r *Run) Dir() string {
+	return r.dir
+}
+
+// Agent runs the submitted benchmark runs one after another, the runs are
+// saved in the data directory so that they are still served after restart.
+type Agent struct {
+	Executor exec.Executor
+	// Store is where the finished runs are also saved if it's not nil
+	Store *store.Store
+
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+
+	dir    string
+	dryrun bool
+
+	lock    sync.Mutex
+	runs    map[string]*Run
+	order   []string      // ids of the runs in the order of submission
+	wakeup  chan struct{} // notifies the worker of the submitted run
+	changed chan struct{} // closed and replaced once any run is changed
+}
+
+// NewAgent creates the agent saving the runs in the directory, all the runs are
+// run in dryrun mode if dryrun is true. The runs which were queued or running
+// when the agent exited are marked as failed.
+func NewAgent(dir string, dryrun bool) (*Agent, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	a := &Agent{
+		Executor:   &exec.CommandExecutor{},
+		ctx:        ctx,
+		cancelFunc: cancelFunc,
+		dir:        dir,
+		dryrun:     dryrun,
+		runs:       make(map[string]*Run),
+		wakeup:     make(chan struct{}, 1),
+		changed:    make(chan struct{}),
+	}
+	if err := a.load(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// load loads the runs saved in the data directory.
+func (a *Agent) load() error {
+	entries, err := os.ReadDir(a.dir)
+	if err != nil {
+		return err
+	}
+	var runs []*Run
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(a.dir, entry.Name())
+		run := &Run{}
+		if err := readJSON(filepath.Join(dir, runInfoFile), run); err != nil {
+			klog.Warningf("Failed to load the run of %s: %v", dir, err)
+			continue
+		}
+		run.dir = dir
+		if !run.Status.Done() {
+			run.Status = RunFailed
+			run.Error = "agent exited before the run was done"
+			if err := writeJSON(filepath.Join(dir, runInfoFile), run); err != nil {
+				klog.Warningf("Failed to save the run %s: %v", run.ID, err)
+			}
+		}
+		var output Output
+		if err := readJSON(filepath.Join(dir, runResultsFile), &output); err == nil {
+			run.results = output.Results
+		}
+		runs = append(runs, run)
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].CreatedAt.Before(runs[j].CreatedAt)
+	})
+	for _, run := range runs {
+		a.runs[run.ID] = run
+		a.order = append(a.order, run.ID)
+	}
+	klog.Infof("Loaded %d runs from %s", len(runs), a.dir)
+	return nil
+}
+
+// Start runs the submitted runs one after another until the agent is closed.
+func (a *Agent) Start() {
+	go func() {
+		for {
+			if run := a.next(); run != nil {
+				a.execute(run)
+				continue
+			}
+			select {
+			case <-a.wakeup:
+			case <-a.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// next marks the first queued run as running and returns it.
+func (a *Agent) next() *Run {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.ctx.Err() != nil {
+		return nil
+	}
+	for _, id := range a.order {
+		run := a.runs[id]
+		if run.Status == RunQueued {
+			now := time.Now()
+			run.Status = RunRunning
+			run.StartedAt = &now
+			a.saveLocked(run)
+			return run
+		}
+	}
+	return nil
+}
+
+// Submit validates the settings in yaml or json format and queues the run, the
+// run is in dryrun mode if dryrun is true or the agent is in dryrun mode.
+func (a *Agent) Submit(data []byte, dryrun bool) (*Run, error) {
+	if _, err := LoadSettings(data); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	id := store.NewID(now)
+	run := &Run{
+		ID:        id,
+		Status:    RunQueued,
+		Dryrun:    a.dryrun || dryrun,
+		CreatedAt: now,
+		dir:       filepath.Join(a.dir, id),
+	}
+	if err := os.MkdirAll(run.dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(run.dir, runConfigFile), data, 0644); err != nil {
+		return nil, err
+	}
+	a.lock.Lock()
+	a.runs[id] = run
+	a.order = append(a.order, id)
+	a.saveLocked(run)
+	snapshot := run.snapshot()
+	a.lock.Unlock()
+
+	select {
+	case a.wakeup <- struct{}{}:
+	default:
+	}
+	klog.Infof("Run %s is queued, dryrun: %t", id, run.Dryrun)
+	return snapshot, nil
+}
+
+// Cancel cancels the queued or running run, ErrRunDone is returned if the run
+// is already done.
+func (a *Agent) Cancel(id string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	run, ok := a.runs[id]
+	if !ok {
+		return ErrRunNotFound
+	}
+	if run.Status.Done() {
+		return ErrRunDone
+	}
+	run.canceled = true
+	if run.Status == RunQueued {
+		now := time.Now()
+		run.Status = RunCanceled
+		run.FinishedAt = &now
+		a.saveLocked(run)
+		return nil
+	}
+	if run.server != nil {
+		run.server.Close()
+	}
+	klog.Infof("Run %s is being canceled", id)
+	return nil
+}
+
+// Get returns a copy of the run.
+func (a *Agent) Get(id string) (*Run, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	run, ok := a.runs[id]
+	if !ok {
+		return nil, ErrRunNotFound
+	}
+	return run.snapshot(), nil
+}
+
+// List returns the copies of all the runs in the order of submission, the
+// progress of the work items is omitted.
+func (a *Agent) List() []*Run {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	runs := make([]*Run, 0, len(a.order))
+	for _, id := range a.order {
+		run := a.runs[id].snapshot()
+		run.Items = nil
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// Results returns the results of the run from the offset, the changed channel
+// is closed once the run is changed, which is nil if the run is done.
+func (a *Agent) Results(id string, offset int) ([]*client.FioResult, <-chan struct{}, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	run, ok := a.runs[id]
+	if !ok {
+		return nil, nil, ErrRunNotFound
+	}
+	var results []*client.FioResult
+	if offset < len(run.results) {
+		results = append(results, run.results[offset:]...)
+	}
+	if run.Status.Done() {
+		return results, nil, nil
+	}
+	return results, a.changed, nil
+}
+
+// Close cancels the running run and stops the agent.
+func (a *Agent) Close() {
+	a.cancelFunc()
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for _, run := range a.runs {
+		if run.server != nil {
+			run.server.Close()
+		}
+	}
+}
+
+// execute runs the benchmark of the run, the results and the chart are saved in
+// the directory of the run.
+func (a *Agent) execute(run *Run) {
+	klog.Infof("Starting run %s", run.ID)
+	server, err := NewFioServer(
+		WithCfgFile(filepath.Join(run.dir, runConfigFile)),
+		WithChartFile(filepath.Join(run.dir, runChartFile)),
+		WithOutputFile(filepath.Join(run.dir, runResultsFile)),
+		WithRenderFormat("json"),
+		WithDryrun(run.Dryrun),
+		WithStore(a.Store),
+		WithPreparedHandler(func(state *RunState) {
+			a.prepared(run, state)
+		}),
+		WithItemHandler(func(item *WorkItem, result *client.FioResult) {
+			a.itemFinished(run, item, result)
+		}),
+		withObserver(&runObserver{agent: a, run: run}))
+	if err == nil {
+		server.Executor = a.Executor
+		a.lock.Lock()
+		run.server = server
+		canceled := run.canceled
+		a.lock.Unlock()
+		if canceled {
+			server.Close()
+		}
+		err = server.Run(a.ctx.Done())
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	now := time.Now()
+	run.server = nil
+	run.FinishedAt = &now
+	switch {
+	case run.canceled:
+		run.Status = RunCanceled
+	case err != nil:
+		run.Status = RunFailed
+		run.Error = err.Error()
+	default:
+		run.Status = RunFinished
+	}
+	a.saveLocked(run)
+	klog.Infof("Run %s is %s", run.ID, run.Status)
+}
+
+// prepared records the work items of the run, only the first work item of each
+// device is searched by slo.
+func (a *Agent) prepared(run *Run, state *RunState) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	run.items = make(map[string]*ItemProgress)
+	for _, item := range run.server.progressItems(state) {
+		progress := &ItemProgress{
+			ID:     item.ID,
+			Item:   item.String(),
+			Device: item.FileName,
+			Status: ItemPending,
+		}
+		run.Items = append(run.Items, progress)
+		run.items[item.ID] = progress
+	}
+	run.Total = len(run.Items)
+	a.saveLocked(run)
+}
+
+// itemFinished records the result of the finished work item of the run.
+func (a *Agent) itemFinished(run *Run, item *WorkItem, result *client.FioResult) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	progress, ok := run.items[item.ID]
+	if !ok {
+		return
+	}
+	if !progress.done {
+		progress.done = true
+		run.Finished++
+	}
+	if result == nil {
+		progress.Status = ItemSkipped
+	} else {
+		progress.Status = ItemFinished
+		progress.Results++
+		run.results = append(run.results, result)
+	}
+	a.saveLocked(run)
+}
+
+// runObserver updates the progress of the work items of the run once they
+// start and stop running.
+type runObserver struct {
+	agent *Agent
+	run   *Run
+}
+
+func (o *runObserver) itemStarted(item *WorkItem) {
+	o.agent.lock.Lock()
+	defer o.agent.lock.Unlock()
+	progress, ok := o.run.items[item.ID]
+	if !ok {
+		return
+	}
+	progress.Status = ItemRunning
+	o.agent.saveLocked(o.run)
+}
+
+// itemStopped marks the failed work item, the item is finished by itemFinished
+// if it succeeded, or it's back to pending if the run is interrupted.
+func (o *runObserver) itemStopped(item *WorkItem, err error) {
+	o.agent.lock.Lock()
+	defer o.agent.lock.Unlock()
+	progress, ok := o.run.items[item.ID]
+	if !ok {
+		return
+	}
+	switch {
+	case err != nil:
+		progress.Status = ItemFailed
+		progress.Error = err.Error()
+		if !progress.done {
+			progress.done = true
+			o.run.Finished++
+		}
+	case progress.Results > 0:
+		progress.Status = ItemFinished // the previous trial of slo search
+	default:
+		progress.Status = ItemPending
+	}
+	o.agent.saveLocked(o.run)
+}
+
+// saveLocked saves the run and notifies the watchers, the lock must be held.
+func (a *Agent) saveLocked(run *Run) {
+	if err := writeJSON(filepath.Join(run.dir, runInfoFile), run); err != nil {
+		klog.Warningf("Failed to save the run %s: %v", run.ID, err)
+	}
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
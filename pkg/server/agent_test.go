@@ -0,0 +1,288 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+	"github.com/microyahoo/fio-benchmark/pkg/store"
+	exectest "github.com/microyahoo/fio-benchmark/pkg/util/exec/test"
+)
+
+func TestAgentSuite(t *testing.T) {
+	suite.Run(t, new(agentTestSuite))
+}
+
+type agentTestSuite struct {
+	suite.Suite
+
+	dir    string
+	agent  *Agent
+	server *httptest.Server
+	block  chan struct{} // fio is blocked until it's closed or canceled
+}
+
+func (s *agentTestSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.block = make(chan struct{})
+	s.agent = s.newAgent()
+	s.server = httptest.NewServer(NewAPIHandler(s.agent, ""))
+}
+
+func (s *agentTestSuite) TearDownTest() {
+	s.server.Close()
+	s.agent.Close()
+}
+
+func (s *agentTestSuite) newAgent() *Agent {
+	agent, err := NewAgent(s.dir, false)
+	s.Require().NoError(err)
+	agent.Executor = &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(command string, args ...string) (string, error) {
+			return "fio-3.27", nil
+		},
+		MockExecuteCommandWithContext: func(ctx context.Context, command string, args ...string) (string, error) {
+			select {
+			case <-s.block:
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+			return `{"jobs": [{"jobname": "randread", "job options": {"rw": "randread"}, "read": {"iops_mean": 100}, "write": {}, "trim": {}}]}`, nil
+		},
+	}
+	agent.Start()
+	return agent
+}
+
+func (s *agentTestSuite) settings() string {
+	return fmt.Sprintf(`
+fio_settings:
+  numjobs: [1]
+  bs: [4K]
+  iodepth: [1, 8]
+  rw: [randread]
+  runtime: 10
+  filename: [%s]
+`, filepath.Join(s.dir, "fio.db"))
+}
+
+func (s *agentTestSuite) do(method, path, body string) (*http.Response, string) {
+	req, err := http.NewRequest(method, s.server.URL+path, strings.NewReader(body))
+	s.Require().NoError(err)
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	s.Require().NoError(err)
+	return resp, string(data)
+}
+
+func (s *agentTestSuite) submit() *Run {
+	resp, body := s.do(http.MethodPost, apiPrefix, s.settings())
+	s.Require().Equal(http.StatusAccepted, resp.StatusCode, body)
+	var run Run
+	s.Require().NoError(json.Unmarshal([]byte(body), &run))
+	s.Equal(apiPrefix+"/"+run.ID, resp.Header.Get("Location"))
+	return &run
+}
+
+func (s *agentTestSuite) waitFor(id string, status RunStatus) *Run {
+	var run *Run
+	s.Require().Eventually(func() bool {
+		var err error
+		run, err = s.agent.Get(id)
+		s.Require().NoError(err)
+		return run.Status == status
+	}, 10*time.Second, 10*time.Millisecond)
+	return run
+}
+
+func (s *agentTestSuite) TestRun() {
+	run := s.submit()
+	s.waitFor(run.ID, RunRunning)
+
+	// follow the results while the run is running
+	resp, err := http.Get(s.server.URL + apiPrefix + "/" + run.ID + "/results?follow=true")
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	s.Equal("application/x-ndjson", resp.Header.Get("Content-Type"))
+	s.Eventually(func() bool {
+		running, err := s.agent.Get(run.ID)
+		s.Require().NoError(err)
+		return len(running.Items) == 2 && running.Items[0].Status == ItemRunning && running.Items[1].Status == ItemPending
+	}, 10*time.Second, 10*time.Millisecond)
+	close(s.block)
+	var results []*client.FioResult
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var result client.FioResult
+		s.NoError(json.Unmarshal(scanner.Bytes(), &result))
+		results = append(results, &result)
+	}
+	s.Len(results, 2)
+
+	run = s.waitFor(run.ID, RunFinished)
+	s.Equal(2, run.Total)
+	s.Equal(2, run.Finished)
+	for _, item := range run.Items {
+		s.Equal(ItemFinished, item.Status)
+		s.Equal(1, item.Results)
+	}
+	_, body := s.do(http.MethodGet, apiPrefix+"/"+run.ID+"/report?format=csv", "")
+	s.True(strings.HasPrefix(body, "filename,rw,"), body)
+	resp, body = s.do(http.MethodGet, apiPrefix+"/"+run.ID+"/chart", "")
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Contains(body, "echarts")
+	resp, _ = s.do(http.MethodPost, apiPrefix+"/"+run.ID+"/cancel", "")
+	s.Equal(http.StatusConflict, resp.StatusCode)
+
+	// the finished runs are served after restart
+	s.agent.Close()
+	agent := s.newAgent()
+	defer agent.Close()
+	loaded, err := agent.Get(run.ID)
+	s.NoError(err)
+	s.Equal(RunFinished, loaded.Status)
+	results, _, err = agent.Results(run.ID, 0)
+	s.NoError(err)
+	s.Len(results, 2)
+}
+
+func (s *agentTestSuite) TestFailedItem() {
+	s.agent.Executor = &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(command string, args ...string) (string, error) {
+			return "fio-3.27", nil
+		},
+		MockExecuteCommandWithContext: func(ctx context.Context, command string, args ...string) (string, error) {
+			if fioArg(args, "--iodepth") == "8" {
+				return "", errors.New("fio: io_u error")
+			}
+			return `{"jobs": [{"jobname": "randread", "job options": {"rw": "randread"}, "read": {"iops_mean": 100}, "write": {}, "trim": {}}]}`, nil
+		},
+	}
+	run := s.waitFor(s.submit().ID, RunFinished)
+	s.Equal(2, run.Total)
+	s.Equal(2, run.Finished, "the failed item is done")
+	s.Require().Len(run.Items, 2)
+	statuses := make(map[ItemStatus]*ItemProgress)
+	for _, item := range run.Items {
+		statuses[item.Status] = item
+	}
+	s.Require().Contains(statuses, ItemFinished)
+	s.Require().Contains(statuses, ItemFailed)
+	s.Contains(statuses[ItemFailed].Error, "fio: io_u error")
+	s.Zero(statuses[ItemFailed].Results)
+	s.Empty(statuses[ItemFinished].Error)
+}
+
+func (s *agentTestSuite) TestToken() {
+	server := httptest.NewServer(NewAPIHandler(s.agent, "secret"))
+	defer server.Close()
+	get := func(path, auth string) int {
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		s.Require().NoError(err)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		s.Require().NoError(err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	s.Equal(http.StatusUnauthorized, get(apiPrefix, ""))
+	s.Equal(http.StatusUnauthorized, get(apiPrefix, "Bearer wrong"))
+	s.Equal(http.StatusUnauthorized, get(apiPrefix+"/unknown", "secret"))
+	s.Equal(http.StatusOK, get(apiPrefix, "Bearer secret"))
+	s.Equal(http.StatusNotFound, get(apiPrefix+"/unknown", "Bearer secret"))
+	s.Equal(http.StatusOK, get("/healthz", ""))
+
+	for listen, loopback := range map[string]bool{
+		"127.0.0.1:8080": true,
+		"[::1]:8080":     true,
+		"localhost:8080": true,
+		":8080":          false,
+		"0.0.0.0:8080":   false,
+		"10.0.0.1:8080":  false,
+		"invalid":        false,
+	} {
+		s.Equal(loopback, IsLoopback(listen), listen)
+	}
+}
+
+func (s *agentTestSuite) TestStore() {
+	resultStore, err := store.Open(filepath.Join(s.T().TempDir(), "store"))
+	s.Require().NoError(err)
+	s.agent.Store = resultStore
+	close(s.block)
+	run := s.waitFor(s.submit().ID, RunFinished)
+
+	summaries, err := resultStore.List(nil)
+	s.NoError(err)
+	s.Require().Len(summaries, 1)
+	record, err := resultStore.Get(summaries[0].ID)
+	s.NoError(err)
+	s.Len(record.Results, 2)
+	s.Equal(filepath.Join(run.Dir(), runConfigFile), record.ConfigFile)
+	s.Equal(s.settings(), record.Config)
+	s.False(record.Interrupted)
+
+	// the run in dryrun mode isn't saved
+	resp, body := s.do(http.MethodPost, apiPrefix+"?dryrun=true", s.settings())
+	s.Require().Equal(http.StatusAccepted, resp.StatusCode, body)
+	var dryrun Run
+	s.NoError(json.Unmarshal([]byte(body), &dryrun))
+	s.True(dryrun.Dryrun)
+	s.waitFor(dryrun.ID, RunFinished)
+	summaries, err = resultStore.List(nil)
+	s.NoError(err)
+	s.Len(summaries, 1)
+}
+
+func (s *agentTestSuite) TestCancel() {
+	running := s.submit()
+	queued := s.submit()
+	s.waitFor(running.ID, RunRunning)
+
+	resp, body := s.do(http.MethodPost, apiPrefix+"/"+queued.ID+"/cancel", "")
+	s.Equal(http.StatusAccepted, resp.StatusCode, body)
+	s.waitFor(queued.ID, RunCanceled)
+	resp, _ = s.do(http.MethodGet, apiPrefix+"/"+running.ID+"/report", "")
+	s.Equal(http.StatusConflict, resp.StatusCode)
+	resp, _ = s.do(http.MethodPost, apiPrefix+"/"+running.ID+"/cancel", "")
+	s.Equal(http.StatusAccepted, resp.StatusCode)
+	run := s.waitFor(running.ID, RunCanceled)
+	s.Equal(0, run.Finished)
+	s.NotNil(run.FinishedAt)
+
+	var runs []*Run
+	_, body = s.do(http.MethodGet, apiPrefix, "")
+	s.NoError(json.Unmarshal([]byte(body), &runs))
+	s.Len(runs, 2)
+	s.Equal(running.ID, runs[0].ID)
+	s.Nil(runs[0].Items)
+}
+
+func (s *agentTestSuite) TestInvalid() {
+	resp, body := s.do(http.MethodPost, apiPrefix, "fio_settings: {bs: [4K]}\n")
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+	s.Contains(body, "filename or userAllDisks should be specified")
+	resp, _ = s.do(http.MethodGet, apiPrefix+"/unknown", "")
+	s.Equal(http.StatusNotFound, resp.StatusCode)
+	resp, _ = s.do(http.MethodDelete, apiPrefix, "")
+	s.Equal(http.StatusMethodNotAllowed, resp.StatusCode)
+	resp, body = s.do(http.MethodGet, "/healthz", "")
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("ok\n", body)
+}
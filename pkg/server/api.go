@@ -0,0 +1,226 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+const (
+	apiPrefix = "/api/v1/runs"
+
+	// maxSettingsSize is the max size of the settings submitted to the agent.
+	maxSettingsSize = 1 << 20
+)
+
+// NewAPIHandler returns the http handler of the REST API of the agent.
+//
+//	POST /api/v1/runs                       submit the settings in yaml or json, eg. ?dryrun=true
+//	GET  /api/v1/runs                       list the runs
+//	GET  /api/v1/runs/{id}                  get the run with the progress of the work items
+//	POST /api/v1/runs/{id}/cancel           cancel the queued or running run
+//	GET  /api/v1/runs/{id}/results          stream the results as json lines, eg. ?follow=true
+//	GET  /api/v1/runs/{id}/report           render the report of the done run, eg. ?format=csv
+//	GET  /api/v1/runs/{id}/chart            get the charts of the done run
+//
+// The API requires the bearer token in the Authorization header if the token
+// isn't empty, the health check doesn't.
+func NewAPIHandler(agent *Agent, token string) http.Handler {
+	h := &apiHandler{agent: agent, token: token}
+	mux := http.NewServeMux()
+	mux.HandleFunc(apiPrefix, h.authorized(h.runs))
+	mux.HandleFunc(apiPrefix+"/", h.authorized(h.run))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok\n")
+	})
+	return mux
+}
+
+type apiHandler struct {
+	agent *Agent
+	token string
+}
+
+// authorized returns the handler which requires the bearer token.
+func (h *apiHandler) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	if h.token == "" {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(auth, "Bearer ")
+		if token == auth || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAPIError(w, http.StatusUnauthorized, errors.New("invalid or missing bearer token"))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// IsLoopback returns true if the listen address only accepts the connections
+// from the local host, eg. 127.0.0.1:8080 or localhost:8080.
+func IsLoopback(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// runs serves the collection of the runs.
+func (h *apiHandler) runs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeAPIJSON(w, http.StatusOK, h.agent.List())
+	case http.MethodPost:
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxSettingsSize))
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		dryrun, _ := strconv.ParseBool(r.URL.Query().Get("dryrun"))
+		run, err := h.agent.Submit(data, dryrun)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		w.Header().Set("Location", apiPrefix+"/"+run.ID)
+		writeAPIJSON(w, http.StatusAccepted, run)
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, errors.Errorf("method %s is not allowed", r.Method))
+	}
+}
+
+// run serves the run and its sub resources.
+func (h *apiHandler) run(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, apiPrefix+"/"), "/")
+	method := http.MethodGet
+	if action == "cancel" {
+		method = http.MethodPost
+	}
+	if r.Method != method {
+		writeAPIError(w, http.StatusMethodNotAllowed, errors.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+	run, err := h.agent.Get(id)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	}
+	switch action {
+	case "":
+		writeAPIJSON(w, http.StatusOK, run)
+	case "cancel":
+		if err = h.agent.Cancel(id); err != nil {
+			writeAPIError(w, http.StatusConflict, err)
+			return
+		}
+		run, _ = h.agent.Get(id)
+		writeAPIJSON(w, http.StatusAccepted, run)
+	case "results":
+		h.results(w, r, id)
+	case "report":
+		h.report(w, r, run)
+	case "chart":
+		if !run.Status.Done() {
+			writeAPIError(w, http.StatusConflict, errors.Errorf("run %s is %s", id, run.Status))
+			return
+		}
+		chartFile := filepath.Join(run.Dir(), runChartFile)
+		if _, err = os.Stat(chartFile); err != nil {
+			writeAPIError(w, http.StatusNotFound, errors.Errorf("no chart of run %s", id))
+			return
+		}
+		http.ServeFile(w, r, chartFile)
+	default:
+		writeAPIError(w, http.StatusNotFound, errors.Errorf("unknown resource %s", action))
+	}
+}
+
+// results streams the results of the run as json lines, the new results are
+// streamed until the run is done if follow is true.
+func (h *apiHandler) results(w http.ResponseWriter, r *http.Request, id string) {
+	follow, _ := strconv.ParseBool(r.URL.Query().Get("follow"))
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	var offset int
+	for {
+		results, changed, err := h.agent.Results(id, offset)
+		if err != nil {
+			return
+		}
+		for _, result := range results {
+			if err = encoder.Encode(result); err != nil {
+				return
+			}
+		}
+		offset += len(results)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if !follow || changed == nil {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// report renders the output of the done run in the format, eg. table, html,
+// markdown, csv, json.
+func (h *apiHandler) report(w http.ResponseWriter, r *http.Request, run *Run) {
+	if !run.Status.Done() {
+		writeAPIError(w, http.StatusConflict, errors.Errorf("run %s is %s", run.ID, run.Status))
+		return
+	}
+	var output Output
+	if err := readJSON(filepath.Join(run.Dir(), runResultsFile), &output); err != nil {
+		writeAPIError(w, http.StatusNotFound, errors.Errorf("no report of run %s", run.ID))
+		return
+	}
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	output.Metadata, _ = strconv.ParseBool(r.URL.Query().Get("metadata"))
+	switch format {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	if err := output.Render(w, format); err != nil {
+		klog.Warningf("Failed to render the report of run %s: %v", run.ID, err)
+	}
+}
+
+func writeAPIJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		klog.Warningf("Failed to write the response: %v", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, code int, err error) {
+	writeAPIJSON(w, code, map[string]string{"error": err.Error()})
+}
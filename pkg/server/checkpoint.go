@@ -0,0 +1,237 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+)
+
+const (
+	runStateFile      = "run.json"
+	preconditionsFile = "preconditions.json"
+	resultsDir        = "results"
+)
+
+var (
+	invalidIDChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+)
+
+// RunState is the persisted state of a benchmark run, which is used to resume
+// the run after it was interrupted.
+type RunState struct {
+	Workers     int32        `json:"workers"`
+	Queues      []*WorkQueue `json:"queues"`
+	Percentiles []float64    `json:"percentiles,omitempty"`
+	LogAvgMsec  uint64       `json:"log_avg_msec,omitempty"`
+
+	Saturation *SaturationSettings `json:"saturation,omitempty"`
+
+	Repeat int32   `json:"repeat,omitempty"`
+	MaxCV  float64 `json:"max_cv,omitempty"`
+
+	Precondition *client.PreconditionSettings `json:"precondition,omitempty"`
+	AllowDestroy []*AllowDestroy              `json:"allow_destroy,omitempty"`
+
+	Expectations []*Expectation `json:"expectations,omitempty"`
+
+	Label string            `json:"label,omitempty"`
+	Chart *client.ChartSpec `json:"chart,omitempty"`
+
+	// Dryrun is whether the run is dry-run, which is nil for the runs saved
+	// before it was recorded
+	Dryrun *bool `json:"dryrun,omitempty"`
+}
+
+// SetPercentiles sets the completion latency percentiles reported by all the work items.
+func (s *RunState) SetPercentiles(percentiles []float64) {
+	s.Percentiles = percentiles
+	for _, queue := range s.Queues {
+		for _, items := range queue.Queue {
+			for _, item := range items {
+				item.Percentiles = percentiles
+			}
+		}
+	}
+}
+
+// jobFilePercentiles returns whether any job section of the job file has its own
+// percentile_list, which isn't replaced by the default percentiles.
+func (s *RunState) jobFilePercentiles() bool {
+	for _, queue := range s.Queues {
+		for _, items := range queue.Queue {
+			for _, item := range items {
+				if item.Job == nil {
+					continue
+				}
+				if _, ok := item.Job.Option("percentile_list"); ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// SetLogAvgMsec logs the time series of all the work items every logAvgMsec milliseconds.
+func (s *RunState) SetLogAvgMsec(logAvgMsec uint64) {
+	s.LogAvgMsec = logAvgMsec
+	for _, queue := range s.Queues {
+		for _, items := range queue.Queue {
+			for _, item := range items {
+				item.LogAvgMsec = logAvgMsec
+			}
+		}
+	}
+}
+
+// Checkpoint saves the state and the finished results of a benchmark run
+// into the run directory.
+//
+//	<run-dir>
+//	├── run.json
+//	├── preconditions.json
+//	└── results
+//	    ├── 000-vdb-randread-4K-1-1.json
+//	    ├── 001-vdb-randread-4K-8-1.skipped
+//	    └── ...
+type Checkpoint struct {
+	dir string
+}
+
+// NewCheckpoint creates a checkpoint in the run directory.
+func NewCheckpoint(dir string) (*Checkpoint, error) {
+	if err := os.MkdirAll(filepath.Join(dir, resultsDir), 0755); err != nil {
+		return nil, errors.Wrapf(err, "failed to create run directory %s", dir)
+	}
+	return &Checkpoint{dir: dir}, nil
+}
+
+// OpenCheckpoint opens the checkpoint of an existing run directory.
+func OpenCheckpoint(dir string) (*Checkpoint, error) {
+	if _, err := os.Stat(filepath.Join(dir, runStateFile)); err != nil {
+		return nil, errors.Wrapf(err, "%s is not a run directory", dir)
+	}
+	return NewCheckpoint(dir)
+}
+
+// Dir returns the run directory.
+func (c *Checkpoint) Dir() string {
+	return c.dir
+}
+
+// SaveState saves the state of the run, the IDs of the work items are assigned
+// if they haven't been.
+func (c *Checkpoint) SaveState(state *RunState) error {
+	assignItemIDs(state.Queues)
+	return writeJSON(filepath.Join(c.dir, runStateFile), state)
+}
+
+// LoadState loads the state of the run.
+func (c *Checkpoint) LoadState() (*RunState, error) {
+	var state RunState
+	if err := readJSON(filepath.Join(c.dir, runStateFile), &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// SaveResult saves the result of the finished work item.
+func (c *Checkpoint) SaveResult(item *WorkItem, result *client.FioResult) error {
+	return writeJSON(filepath.Join(c.dir, resultsDir, item.ID+".json"), result)
+}
+
+// SaveSkipped marks the work item as skipped, which won't be run on resume.
+func (c *Checkpoint) SaveSkipped(item *WorkItem) error {
+	return os.WriteFile(filepath.Join(c.dir, resultsDir, item.ID+".skipped"), nil, 0644)
+}
+
+// LoadSkipped loads the IDs of the skipped work items.
+func (c *Checkpoint) LoadSkipped() (map[string]bool, error) {
+	files, err := filepath.Glob(filepath.Join(c.dir, resultsDir, "*.skipped"))
+	if err != nil {
+		return nil, err
+	}
+	skipped := make(map[string]bool, len(files))
+	for _, f := range files {
+		skipped[strings.TrimSuffix(filepath.Base(f), ".skipped")] = true
+	}
+	return skipped, nil
+}
+
+// SavePreconditions saves the finished preconditioning, keyed by the device.
+func (c *Checkpoint) SavePreconditions(preconditions map[string]*client.Precondition) error {
+	return writeJSON(filepath.Join(c.dir, preconditionsFile), preconditions)
+}
+
+// LoadPreconditions loads the finished preconditioning, keyed by the device.
+func (c *Checkpoint) LoadPreconditions() (map[string]*client.Precondition, error) {
+	preconditions := make(map[string]*client.Precondition)
+	err := readJSON(filepath.Join(c.dir, preconditionsFile), &preconditions)
+	if os.IsNotExist(err) {
+		return preconditions, nil
+	}
+	return preconditions, err
+}
+
+// LoadResults loads the saved results, keyed by the work item ID.
+func (c *Checkpoint) LoadResults() (map[string]*client.FioResult, error) {
+	files, err := filepath.Glob(filepath.Join(c.dir, resultsDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	results := make(map[string]*client.FioResult, len(files))
+	for _, f := range files {
+		var result *client.FioResult
+		if err := readJSON(f, &result); err != nil {
+			klog.Warningf("Skip the broken result %s: %v", f, err)
+			continue
+		}
+		results[strings.TrimSuffix(filepath.Base(f), ".json")] = result
+	}
+	return results, nil
+}
+
+// assignItemIDs assigns a unique and readable ID to every work item.
+func assignItemIDs(queues []*WorkQueue) {
+	var seq int
+	for _, queue := range queues {
+		for _, key := range queue.Keys() {
+			for _, item := range queue.Queue[key] {
+				if item.ID == "" {
+					item.ID = invalidIDChars.ReplaceAllString(fmt.Sprintf("%03d-%s", seq, item), "_")
+				}
+				seq++
+			}
+		}
+	}
+}
+
+// writeJSON writes the value to a temporary file and renames it, so that the
+// file is never partially written.
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
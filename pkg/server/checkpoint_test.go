@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+	exectest "github.com/microyahoo/fio-benchmark/pkg/util/exec/test"
+)
+
+func TestCheckpointSuite(t *testing.T) {
+	suite.Run(t, new(checkpointTestSuite))
+}
+
+type checkpointTestSuite struct {
+	suite.Suite
+}
+
+func newTestQueue() *WorkQueue {
+	settings := &TestSettings{
+		FioSettings: &FioSettings{
+			NumJobs:   []int32{1, 2},
+			BlockSize: []string{"4K"},
+			IODepth:   []int32{1},
+			RW:        []string{"randread", "randwrite"},
+			FileName:  []string{"/dev/vdb", "/dev/vdc"},
+			Runtime:   10,
+		},
+	}
+	queue, _ := NewWorkQueue(settings, nil)
+	return queue
+}
+
+func (s *checkpointTestSuite) TestSaveAndLoad() {
+	dir := filepath.Join(s.T().TempDir(), "run")
+	_, err := OpenCheckpoint(dir)
+	s.Error(err)
+
+	c, err := NewCheckpoint(dir)
+	s.NoError(err)
+	queue := newTestQueue()
+	s.NoError(c.SaveState(&RunState{Workers: 2, Queues: []*WorkQueue{queue}}))
+	s.Equal("000-vdb-randread-4K-1-1", queue.Queue["/dev/vdb"][0].ID)
+	s.Equal("007-vdc-randwrite-4K-1-2", queue.Queue["/dev/vdc"][3].ID)
+
+	result := &client.FioResult{Jobs: []*client.FioJob{{JobName: "randread"}}}
+	s.NoError(c.SaveResult(queue.Queue["/dev/vdb"][0], result))
+
+	c, err = OpenCheckpoint(dir)
+	s.NoError(err)
+	state, err := c.LoadState()
+	s.NoError(err)
+	s.EqualValues(2, state.Workers)
+	s.Equal(queue.Queue, state.Queues[0].Queue)
+	results, err := c.LoadResults()
+	s.NoError(err)
+	s.Equal(map[string]*client.FioResult{"000-vdb-randread-4K-1-1": result}, results)
+}
+
+func (s *checkpointTestSuite) TestResume() {
+	defer mockBlockDevices()()
+	dir := filepath.Join(s.T().TempDir(), "run")
+	c, err := NewCheckpoint(dir)
+	s.NoError(err)
+	queue := newTestQueue()
+	s.NoError(c.SaveState(&RunState{Workers: 2, Queues: []*WorkQueue{queue}}))
+	for _, item := range queue.Queue["/dev/vdb"] {
+		s.NoError(c.SaveResult(item, &client.FioResult{Jobs: []*client.FioJob{{JobName: item.ID}}}))
+	}
+	s.NoError(c.SaveResult(queue.Queue["/dev/vdc"][0], &client.FioResult{Jobs: []*client.FioJob{{JobName: "vdc"}}}))
+
+	var filenames []string
+	server, err := NewFioServer(WithChartFile(filepath.Join(s.T().TempDir(), "chart.html")), WithRunDir(dir), WithResume(true))
+	s.NoError(err)
+	server.Executor = &exectest.MockExecutor{
+		MockExecuteCommandWithContext: func(ctx context.Context, command string, args ...string) (string, error) {
+			filenames = append(filenames, strings.Join(args[2:4], "="))
+			return `{"jobs": [{"jobname": "new"}]}`, nil
+		},
+	}
+	state, err := server.prepare()
+	s.NoError(err)
+	s.Len(server.results, 5)
+	s.Equal(3, state.Queues[0].Len())
+	s.NotContains(state.Queues[0].Queue, "/dev/vdb")
+
+	server.runQueues(state)
+	s.Len(server.results, 8)
+	s.Equal([]string{"--filename=/dev/vdc", "--filename=/dev/vdc", "--filename=/dev/vdc"}, filenames)
+	results, err := c.LoadResults()
+	s.NoError(err)
+	s.Len(results, 8)
+}
+
+func (s *checkpointTestSuite) TestResumeDryrun() {
+	dir := filepath.Join(s.T().TempDir(), "run")
+	cfgFile := filepath.Join(s.T().TempDir(), "conf.yaml")
+	s.NoError(os.WriteFile(cfgFile, []byte(fmt.Sprintf(`
+fio_settings:
+  numjobs: [1]
+  bs: [4K]
+  iodepth: [1]
+  rw: [randread]
+  runtime: 10
+  filename: [%s]
+`, filepath.Join(s.T().TempDir(), "fio.db"))), 0644))
+	prepare := func(opts ...ServerOption) error {
+		server, err := NewFioServer(append(opts, WithChartFile(filepath.Join(s.T().TempDir(), "chart.html")), WithRunDir(dir))...)
+		s.Require().NoError(err)
+		server.Executor = &exectest.MockExecutor{
+			MockExecuteCommandWithOutput: func(command string, args ...string) (string, error) {
+				return "fio-3.27", nil
+			},
+		}
+		_, err = server.prepare()
+		return err
+	}
+	s.NoError(prepare(WithCfgFile(cfgFile), WithDryrun(false)))
+	c, err := OpenCheckpoint(dir)
+	s.Require().NoError(err)
+	state, err := c.LoadState()
+	s.Require().NoError(err)
+	s.Require().NotNil(state.Dryrun)
+	s.False(*state.Dryrun)
+
+	// the run which isn't dry-run can't be resumed in dryrun mode
+	s.ErrorContains(prepare(WithResume(true), WithDryrun(true)), "was started with dryrun false, which can't be resumed with dryrun true")
+	s.NoError(prepare(WithResume(true), WithDryrun(false)))
+}
+
+func (s *checkpointTestSuite) TestRepeat() {
+	queue := newTestQueue()
+	queue.Repeat(3, nil)
+	s.Equal(24, queue.Len())
+	items := queue.Queue["/dev/vdb"]
+	s.Len(items, 12)
+	s.EqualValues(1, items[0].Trial)
+	s.EqualValues(2, items[4].Trial)
+	s.Equal(items[0].RW, items[4].RW)
+	s.Equal(items[0].NumJobs, items[4].NumJobs)
+	assignItemIDs([]*WorkQueue{queue})
+	s.Equal("000-vdb-randread-4K-1-1-t1", items[0].ID)
+	s.Equal("004-vdb-randread-4K-1-1-t2", items[4].ID)
+
+	queue = newTestQueue()
+	queue.Repeat(2, rand.New(rand.NewSource(1)))
+	trials := make(map[string]int)
+	for _, item := range queue.Queue["/dev/vdc"] {
+		trials[fmt.Sprintf("%s-%d-%d", item.RW, item.NumJobs, item.Trial)]++
+	}
+	s.Len(trials, 8)
+}
+
+func (s *checkpointTestSuite) TestChartAndLabel() {
+	defer mockBlockDevices()()
+	dir := filepath.Join(s.T().TempDir(), "run")
+	c, err := NewCheckpoint(dir)
+	s.NoError(err)
+	queue := newTestQueue()
+	s.NoError(c.SaveState(&RunState{Workers: 2, Queues: []*WorkQueue{queue}, Label: "kernel-6.1",
+		Chart: &client.ChartSpec{Preset: "qd-scaling", Metrics: []string{"read_iops"}}}))
+	s.NoError(c.SaveResult(queue.Queue["/dev/vdb"][0], &client.FioResult{Jobs: []*client.FioJob{{JobName: "vdb",
+		JobOptions: &client.JobOptions{RW: "randread", BlockSize: "4K", IODepth: "1", NumJobs: "1"},
+		ReadResult: &client.ReadResult{}, WriteResult: &client.WriteResult{}, TrimResult: &client.TrimResult{}}}}))
+
+	// the invalid chart spec fails the run before any work item is run
+	server, err := NewFioServer(WithRunDir(dir), WithResume(true), WithChartSpec(&client.ChartSpec{XAxis: "rw"}))
+	s.NoError(err)
+	_, err = server.prepare()
+	s.EqualError(err, `invalid chart x-axis "rw", which should be one of bs, iodepth, numjobs, outstanding`)
+
+	chartFile := filepath.Join(s.T().TempDir(), "chart.html")
+	server, err = NewFioServer(WithChartFile(chartFile), WithRunDir(dir), WithResume(true), WithChartSpec(&client.ChartSpec{Series: "label"}))
+	s.NoError(err)
+	server.Executor = &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(command string, args ...string) (string, error) {
+			return "fio-3.27", nil
+		},
+		MockExecuteCommandWithContext: func(ctx context.Context, command string, args ...string) (string, error) {
+			return fmt.Sprintf(`{"jobs": [{"jobname": "new", "job options": {"rw": "randread", "bs": "4K", "iodepth": "1", "numjobs": "%s"},
+				"read": {"iops_mean": 100}, "write": {}, "trim": {}}]}`, fioArg(args, "--numjobs")), nil
+		},
+	}
+	s.NoError(server.Run(make(chan struct{})))
+	s.Len(server.results, 8)
+	for _, result := range server.results {
+		s.Equal("kernel-6.1", result.Label)
+	}
+	results, err := c.LoadResults()
+	s.NoError(err)
+	s.Equal("kernel-6.1", results[queue.Queue["/dev/vdc"][0].ID].Label)
+	data, err := os.ReadFile(chartFile)
+	s.NoError(err)
+	html := string(data)
+	s.Contains(html, `"text":"readiops-randread-4K-1"`)
+	s.Contains(html, `"text":"readiops-randread-4K-2"`)
+	s.NotContains(html, "writeiops")
+	s.Contains(html, `"name":"kernel-6.1"`)
+	s.Contains(html, `"name":"iodepth","data":["1"]`)
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/microyahoo/fio-benchmark/pkg/util/exec"
+	"github.com/microyahoo/fio-benchmark/pkg/util/sys"
+)
+
+// DiscoveredDevice is a local device and whether it's selected by `use_all_disks`.
+type DiscoveredDevice struct {
+	Device     string   `json:"device" yaml:"device"`
+	KernelName string   `json:"kernel_name" yaml:"kernel_name"`
+	Type       string   `json:"type" yaml:"type"`
+	Size       uint64   `json:"size" yaml:"size"` // bytes
+	Rotational bool     `json:"rotational" yaml:"rotational"`
+	Bus        string   `json:"bus,omitempty" yaml:"bus,omitempty"`
+	Vendor     string   `json:"vendor,omitempty" yaml:"vendor,omitempty"`
+	Model      string   `json:"model,omitempty" yaml:"model,omitempty"`
+	Serial     string   `json:"serial,omitempty" yaml:"serial,omitempty"`
+	WWN        string   `json:"wwn,omitempty" yaml:"wwn,omitempty"`
+	Filesystem string   `json:"filesystem,omitempty" yaml:"filesystem,omitempty"`
+	MountPoint string   `json:"mount_point,omitempty" yaml:"mount_point,omitempty"`
+	Partitions int      `json:"partitions" yaml:"partitions"`
+	Parents    []string `json:"parents,omitempty" yaml:"parents,omitempty"`
+	Root       bool     `json:"root" yaml:"root"`
+	Selected   bool     `json:"selected" yaml:"selected"`
+	Reason     string   `json:"reason,omitempty" yaml:"reason,omitempty"` // why it isn't selected
+}
+
+// HumanSize returns the size in binary units, eg. 3.5Ti.
+func (d *DiscoveredDevice) HumanSize() string {
+	size := float64(d.Size)
+	for _, unit := range []string{"", "Ki", "Mi", "Gi", "Ti"} {
+		if size < 1024 {
+			return strings.TrimSuffix(fmt.Sprintf("%.1f", size), ".0") + unit
+		}
+		size /= 1024
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", size), ".0") + "Pi"
+}
+
+// Discover discovers all the local devices and checks whether they are selected
+// by `use_all_disks` with the device selector, which can be nil.
+func Discover(executor exec.Executor, selector *DeviceSelector) ([]*DiscoveredDevice, error) {
+	devices, err := sys.DiscoverAllDevices(executor)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to discover devices")
+	}
+	var discovered []*DiscoveredDevice
+	for _, d := range devices {
+		reason := IneligibleReason(d, selector)
+		discovered = append(discovered, &DiscoveredDevice{
+			Device:     d.RealPath,
+			KernelName: d.KernelName,
+			Type:       d.Type,
+			Size:       d.Size,
+			Rotational: d.Rotational,
+			Bus:        d.Bus,
+			Vendor:     d.Vendor,
+			Model:      d.Model,
+			Serial:     d.Serial,
+			WWN:        d.WWN,
+			Filesystem: d.Filesystem,
+			MountPoint: d.MountPoint,
+			Partitions: len(d.Partitions),
+			Parents:    d.Parents,
+			Root:       d.IsRoot,
+			Selected:   reason == "",
+			Reason:     reason,
+		})
+	}
+	sort.Slice(discovered, func(i, j int) bool {
+		return discovered[i].Device < discovered[j].Device
+	})
+	return discovered, nil
+}
+
+var configTemplate = template.Must(template.New("config").Parse(`# generated by fio-benchmark discover, edit it before running the benchmark
+fio_settings:
+  numjobs: # 1 2 4 8 16 32 64 128 256 512 1024 2048
+  - 1
+  - 8
+  ioengine: libaio
+  direct: true
+  verify: false
+  bs: # block size 4K, 8K, 16K, 32K, 256K, 512K, 1M, 4M
+  - 4K
+  - 1M
+  runtime: 120 # seconds
+  iodepth: # 1, 2, 4, 8, 16, 32, 64, 128
+  - 1
+  - 32
+  rw: # read, write, randread, randwrite, rw, randrw
+  - randread
+  - randwrite
+  filename:
+{{- range .Devices }}
+  - {{ .Device }} # {{ .Description }}
+{{- end }}
+  percentiles: # completion latency percentiles to report
+  - 50
+  - 99
+  - 99.9
+workers: {{ .Workers }}
+`))
+
+// GenerateConfig writes a config with the selected devices as the filenames,
+// the workers is the number of the devices so that they are run in parallel.
+func GenerateConfig(w io.Writer, devices []*DiscoveredDevice) error {
+	type device struct {
+		Device      string
+		Description string
+	}
+	var selected []device
+	for _, d := range devices {
+		if !d.Selected {
+			continue
+		}
+		var desc []string
+		for _, s := range []string{d.Bus, strings.TrimSpace(d.Vendor + " " + d.Model), d.Serial, d.HumanSize()} {
+			if s != "" {
+				desc = append(desc, s)
+			}
+		}
+		if d.Rotational {
+			desc = append(desc, "rotational")
+		}
+		selected = append(selected, device{Device: d.Device, Description: strings.Join(desc, ", ")})
+	}
+	if len(selected) == 0 {
+		return errors.New("no device is selected")
+	}
+	return configTemplate.Execute(w, map[string]interface{}{
+		"Devices": selected,
+		"Workers": len(selected),
+	})
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestDiscoverSuite(t *testing.T) {
+	suite.Run(t, new(discoverTestSuite))
+}
+
+type discoverTestSuite struct {
+	suite.Suite
+}
+
+func (s *discoverTestSuite) TestDiscover() {
+	devices, err := Discover(mockDiscoverExecutor(), nil)
+	s.NoError(err)
+	s.Len(devices, 5)
+	var selected []string
+	for _, d := range devices {
+		if d.Selected {
+			selected = append(selected, d.Device)
+		}
+	}
+	s.Equal([]string{"/dev/nvme0n1", "/dev/nvme1n1", "/dev/sda", "/dev/sdb"}, selected)
+	s.Equal("/dev/sdc", devices[4].Device)
+	s.Equal("usb disk", devices[4].Reason)
+	s.Equal("3.5Ti", devices[0].HumanSize())
+	s.Equal("SAMSUNG MZQL23T8HCLS-00A07", devices[0].Model)
+
+	rotational := true
+	devices, err = Discover(mockDiscoverExecutor(), &DeviceSelector{DeviceFilter: DeviceFilter{Rotational: &rotational}})
+	s.NoError(err)
+	s.False(devices[0].Selected)
+	s.Equal("not selected: rotational is false", devices[0].Reason)
+	s.True(devices[2].Selected)
+}
+
+func (s *discoverTestSuite) TestGenerateConfig() {
+	devices, err := Discover(mockDiscoverExecutor(), nil)
+	s.NoError(err)
+	var buf bytes.Buffer
+	s.NoError(GenerateConfig(&buf, devices))
+	s.Contains(buf.String(), "  - /dev/sda # scsi, SEAGATE ST16000NM002G, ZL2000A1, 14.6Ti, rotational\n")
+
+	cfgFile := filepath.Join(s.T().TempDir(), "conf.yaml")
+	s.NoError(os.WriteFile(cfgFile, buf.Bytes(), 0644))
+	settings, err := ParseSettings(cfgFile)
+	s.NoError(err)
+	s.Equal([]string{"/dev/nvme0n1", "/dev/nvme1n1", "/dev/sda", "/dev/sdb"}, settings.FioSettings.FileName)
+	s.EqualValues(4, settings.Workers)
+
+	s.Error(GenerateConfig(&buf, devices[4:]))
+}
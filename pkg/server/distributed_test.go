@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+	exectest "github.com/microyahoo/fio-benchmark/pkg/util/exec/test"
+)
+
+func TestDistributedSuite(t *testing.T) {
+	suite.Run(t, new(distributedTestSuite))
+}
+
+type distributedTestSuite struct {
+	suite.Suite
+}
+
+func (s *distributedTestSuite) writeConfig(extra string) string {
+	cfgFile := filepath.Join(s.T().TempDir(), "conf.yaml")
+	s.NoError(os.WriteFile(cfgFile, []byte(`
+fio_settings:
+  numjobs: [1]
+  bs: [4K]
+  iodepth: [1, 8]
+  rw: [randwrite]
+  runtime: 10
+  filename: [/dev/vdb]
+`+extra), 0644))
+	return cfgFile
+}
+
+func (s *distributedTestSuite) TestParseSettings() {
+	settings, err := ParseSettings(s.writeConfig("hosts: [node1, \"node2,8766\"]\n"))
+	s.NoError(err)
+	s.Equal([]string{"node1", "node2,8766"}, settings.Hosts)
+	queue, err := NewWorkQueue(settings, nil)
+	s.NoError(err)
+	for _, item := range queue.Queue["/dev/vdb"] {
+		s.Equal(settings.Hosts, item.Hosts)
+	}
+
+	for extra, msg := range map[string]string{
+		"hosts: [node1]\nuse_all_disks: true\n":                  "use_all_disks is not supported by hosts",
+		"hosts: [node1]\nprecondition: {}\n":                     "precondition is not supported by hosts",
+		"hosts: [node1]\ntuning: {queue: {scheduler: [none]}}\n": "tuning is not supported by hosts",
+		"hosts: [node1, \"\"]\n":                                 "invalid host",
+		"hosts: [\"node1 node2\"]\n":                             "invalid host",
+	} {
+		_, err = ParseSettings(s.writeConfig(extra))
+		s.ErrorContains(err, msg, extra)
+	}
+}
+
+func (s *distributedTestSuite) TestRun() {
+	defer mockBlockDevices("/dev/vdb")()
+	var clients [][]string
+	server, err := NewFioServer(WithChartFile(filepath.Join(s.T().TempDir(), "chart.html")), WithCfgFile(s.writeConfig("hosts: [node1, \"node2,8766\"]\n")),
+		WithOutputFile(filepath.Join(s.T().TempDir(), "output.txt")))
+	s.NoError(err)
+	server.Executor = &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(command string, args ...string) (string, error) {
+			s.Equal(client.FioTool, command, "the local devices shouldn't be inspected")
+			return "fio-3.27", nil
+		},
+		MockExecuteCommandWithContext: func(ctx context.Context, command string, args ...string) (string, error) {
+			var hosts []string
+			for _, arg := range args {
+				if strings.HasPrefix(arg, "--client=") {
+					hosts = append(hosts, strings.TrimPrefix(arg, "--client="))
+				}
+			}
+			clients = append(clients, hosts)
+			stat := func(jobname, hostname string) string {
+				return fmt.Sprintf(`{"jobname": %q, "hostname": %q, "job options": {"filename": "/dev/vdb", "rw": "randwrite"},
+					"read": {}, "write": {"iops_mean": 100}, "trim": {}}`, jobname, hostname)
+			}
+			return fmt.Sprintf(`{"client_stats": [%s, %s, %s]}`, stat("w", "node1"), stat("w", "node2"), stat("All clients", "node2")), nil
+		},
+	}
+	s.NoError(server.Run(make(chan struct{})))
+	s.Equal([][]string{{"node1", "node2,8766"}, {"node1", "node2,8766"}}, clients)
+	s.Len(server.results, 2)
+	for _, result := range server.results {
+		s.Nil(result.Device)
+		s.Nil(result.Host)
+		s.Len(result.Jobs, 3)
+		s.Equal(client.AllClients, result.Jobs[0].Hostname)
+	}
+	output, err := os.ReadFile(filepath.Join(server.outputFile))
+	s.NoError(err)
+	s.Contains(string(output), "CLIENT")
+}
@@ -0,0 +1,410 @@
+package server
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+)
+
+var (
+	ruleRegexp   = regexp.MustCompile(`^\s*(\S+)\s*(>=|<=|==|>|<)\s*(\S+)\s*$`)
+	metricRegexp = regexp.MustCompile(`^(read|write|trim)_(iops|bw_kib|lat_us|p([0-9.]+)_us)$`)
+)
+
+// Expectation is the rules which the jobs matched by the selector should pass,
+// the empty fields of the selector match all the jobs, eg.
+//
+//	expectations:
+//	- model: SAMSUNG MZQL2
+//	  rw: randread
+//	  bs: 4K
+//	  rules:
+//	  - read_iops >= 400000
+//	  - read_p99_us <= 500
+type Expectation struct {
+	Name      string   `yaml:"name" json:"name,omitempty"`
+	Model     string   `yaml:"model" json:"model,omitempty"`       // case-insensitive substring of the device model
+	FileName  string   `yaml:"filename" json:"filename,omitempty"` // filename or its base name, eg. /dev/nvme0n1 or nvme0n1
+	RW        string   `yaml:"rw" json:"rw,omitempty"`
+	BlockSize string   `yaml:"bs" json:"bs,omitempty"`
+	IODepth   int32    `yaml:"iodepth" json:"iodepth,omitempty"`
+	NumJobs   int32    `yaml:"numjobs" json:"numjobs,omitempty"`
+	Rules     []string `yaml:"rules" json:"rules"`
+}
+
+// String returns the name of the expectation, or its selector if the name is empty.
+func (e *Expectation) String() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	var selector []string
+	for _, s := range []struct {
+		key, value string
+	}{
+		{"model", e.Model},
+		{"filename", e.FileName},
+		{"rw", e.RW},
+		{"bs", e.BlockSize},
+		{"iodepth", formatInt(e.IODepth)},
+		{"numjobs", formatInt(e.NumJobs)},
+	} {
+		if s.value != "" {
+			selector = append(selector, s.key+"="+s.value)
+		}
+	}
+	if len(selector) == 0 {
+		return "all"
+	}
+	return strings.Join(selector, ",")
+}
+
+func formatInt(n int32) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(int(n))
+}
+
+func (e *Expectation) validate() error {
+	if len(e.Rules) == 0 {
+		return errors.Errorf("no rules of expectation %s", e)
+	}
+	for _, r := range e.Rules {
+		rule, err := ParseRule(r)
+		if err != nil {
+			return errors.Wrapf(err, "invalid rule of expectation %s", e)
+		}
+		if rule.Percentile > 0 {
+			if err = ValidatePercentiles([]float64{rule.Percentile}); err != nil {
+				return errors.Wrapf(err, "invalid rule of expectation %s", e)
+			}
+		}
+	}
+	return nil
+}
+
+// match returns true if the job of the result is selected.
+func (e *Expectation) match(result *client.FioResult, job *client.FioJob) bool {
+	o := job.JobOptions
+	if o == nil {
+		return false
+	}
+	if e.Model != "" && (result.Device == nil ||
+		!strings.Contains(strings.ToLower(result.Device.Model), strings.ToLower(e.Model))) {
+		return false
+	}
+	if e.FileName != "" && o.FileName != e.FileName && filepath.Base(o.FileName) != e.FileName {
+		return false
+	}
+	if e.RW != "" && o.RW != e.RW {
+		return false
+	}
+	if e.BlockSize != "" && !strings.EqualFold(o.BlockSize, e.BlockSize) {
+		return false
+	}
+	if e.IODepth != 0 && o.IODepth != strconv.Itoa(int(e.IODepth)) {
+		return false
+	}
+	if e.NumJobs != 0 && o.NumJobs != strconv.Itoa(int(e.NumJobs)) {
+		return false
+	}
+	return true
+}
+
+// Rule is a parsed rule of the expectation, eg. read_iops >= 400000. The metric
+// is the direction followed by iops, bw_kib, lat_us (mean latency) or the
+// completion latency percentile such as p99_us and p99.9_us.
+type Rule struct {
+	Metric     string
+	Direction  string
+	Op         string
+	Value      float64
+	Percentile float64 // percentile of the metric, 0 if it isn't a percentile
+}
+
+// ParseRule parses the rule in the format of "<metric> <op> <value>", the op is
+// one of >=, <=, >, < and ==.
+func ParseRule(s string) (*Rule, error) {
+	m := ruleRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return nil, errors.Errorf("invalid rule %q, eg. read_iops >= 400000", s)
+	}
+	metric := metricRegexp.FindStringSubmatch(m[1])
+	if metric == nil {
+		return nil, errors.Errorf("invalid metric %q, eg. read_iops, write_bw_kib, read_lat_us, write_p99_us", m[1])
+	}
+	value, err := strconv.ParseFloat(m[3], 64)
+	if err != nil {
+		return nil, errors.Errorf("invalid value %q of rule %q", m[3], s)
+	}
+	rule := &Rule{Metric: m[1], Direction: metric[1], Op: m[2], Value: value}
+	if metric[3] != "" {
+		if rule.Percentile, err = strconv.ParseFloat(metric[3], 64); err != nil {
+			return nil, errors.Errorf("invalid percentile of metric %q", m[1])
+		}
+	}
+	return rule, nil
+}
+
+func (r *Rule) String() string {
+	return fmt.Sprintf("%s %s %s", r.Metric, r.Op, strconv.FormatFloat(r.Value, 'f', -1, 64))
+}
+
+// value returns the value of the metric of the job, false is returned if the
+// percentile isn't reported.
+func (r *Rule) value(job *client.FioJob) (float64, bool) {
+	var result *client.IOResult
+	switch r.Direction {
+	case "read":
+		result = job.ReadResult
+	case "write":
+		result = job.WriteResult
+	default:
+		result = job.TrimResult
+	}
+	if result == nil {
+		result = &client.IOResult{}
+	}
+	if r.Percentile > 0 {
+		v, ok := result.ClatNs.Percentile[client.PercentileKey(r.Percentile)]
+		return v / 1000, ok
+	}
+	switch {
+	case strings.HasSuffix(r.Metric, "_iops"):
+		return result.IOPSMean, true
+	case strings.HasSuffix(r.Metric, "_bw_kib"):
+		return result.BWMean, true
+	default:
+		return result.LatencyNs.Mean / 1000, true
+	}
+}
+
+func (r *Rule) pass(value float64) bool {
+	switch r.Op {
+	case ">=":
+		return value >= r.Value
+	case "<=":
+		return value <= r.Value
+	case ">":
+		return value > r.Value
+	case "<":
+		return value < r.Value
+	default:
+		return value == r.Value
+	}
+}
+
+// expectationPercentiles returns the percentiles of the rules of the expectations.
+func expectationPercentiles(expectations []*Expectation) []float64 {
+	var percentiles []float64
+	for _, e := range expectations {
+		for _, r := range e.Rules {
+			if rule, err := ParseRule(r); err == nil && rule.Percentile > 0 {
+				percentiles = withPercentile(percentiles, rule.Percentile)
+			}
+		}
+	}
+	return percentiles
+}
+
+// ExpectationCheck is the check of a rule of the expectation against a job, the
+// job is nil if the expectation matched no job, which fails the check. The check
+// of a failed work item has the item instead of the rule.
+type ExpectationCheck struct {
+	Expectation *Expectation
+	Rule        string
+	Item        *WorkItem
+	Result      *client.FioResult
+	Job         *client.FioJob
+	Value       float64
+	Passed      bool
+	Message     string
+}
+
+// Name returns the job options and the rule of the check.
+func (c *ExpectationCheck) Name() string {
+	if c.Item != nil {
+		return c.Item.String()
+	}
+	if c.Job == nil {
+		return c.Rule
+	}
+	o := c.Job.JobOptions
+	name := fmt.Sprintf("%s %s bs=%s iodepth=%s numjobs=%s", o.FileName, o.RW, o.BlockSize, o.IODepth, o.NumJobs)
+	if c.Job.Hostname != "" {
+		name += " client=" + c.Job.Hostname
+	}
+	return name + ": " + c.Rule
+}
+
+// CheckExpectations checks every job of the results against the rules of the
+// matched expectations, the rules of the expectation which matched no job fail,
+// eg. the work items of the device failed.
+func CheckExpectations(expectations []*Expectation, results []*client.FioResult) []*ExpectationCheck {
+	var checks []*ExpectationCheck
+	for _, e := range expectations {
+		var matched bool
+		for _, result := range results {
+			for _, job := range result.Jobs {
+				if !e.match(result, job) {
+					continue
+				}
+				matched = true
+				for _, r := range e.Rules {
+					checks = append(checks, checkRule(e, r, result, job))
+				}
+			}
+		}
+		if !matched {
+			for _, r := range e.Rules {
+				checks = append(checks, &ExpectationCheck{Expectation: e, Rule: r, Message: "no job is matched"})
+			}
+		}
+	}
+	return checks
+}
+
+// failedItemsExpectation is the expectation of the checks of the failed work
+// items, which are reported in a test suite of their own.
+var failedItemsExpectation = &Expectation{Name: "work items"}
+
+// failedItem is a work item which failed to run.
+type failedItem struct {
+	item *WorkItem
+	err  error
+}
+
+// checkFailedItems returns a failed check for each failed work item.
+func checkFailedItems(failed []*failedItem) []*ExpectationCheck {
+	var checks []*ExpectationCheck
+	for _, f := range failed {
+		checks = append(checks, &ExpectationCheck{Expectation: failedItemsExpectation, Item: f.item, Message: f.err.Error()})
+	}
+	return checks
+}
+
+func checkRule(e *Expectation, r string, result *client.FioResult, job *client.FioJob) *ExpectationCheck {
+	check := &ExpectationCheck{Expectation: e, Rule: r, Result: result, Job: job}
+	rule, err := ParseRule(r)
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	value, ok := rule.value(job)
+	if !ok {
+		check.Message = fmt.Sprintf("%s isn't reported", rule.Metric)
+		return check
+	}
+	check.Value = value
+	check.Passed = rule.pass(value)
+	check.Message = fmt.Sprintf("%s is %s", rule.Metric, strconv.FormatFloat(value, 'f', -1, 64))
+	return check
+}
+
+// ExpectationError is returned if any check of the expectations failed.
+type ExpectationError struct {
+	Failed int
+	Total  int
+}
+
+func (e *ExpectationError) Error() string {
+	return fmt.Sprintf("%d of %d expectation checks failed", e.Failed, e.Total)
+}
+
+// expectationError returns the error if any check failed.
+func expectationError(checks []*ExpectationCheck) error {
+	var failed int
+	for _, c := range checks {
+		if !c.Passed {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	return &ExpectationError{Failed: failed, Total: len(checks)}
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Name     string            `xml:"name,attr"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Suites   []*junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Cases    []*junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+}
+
+// WriteJUnit writes the checks as a JUnit XML report, one test suite for each
+// expectation and one test case for each check, the failed work items are
+// reported in the test suite of their own.
+func WriteJUnit(w io.Writer, checks []*ExpectationCheck) error {
+	report := &junitTestSuites{Name: "fio-benchmark"}
+	suites := make(map[*Expectation]*junitTestSuite)
+	for _, c := range checks {
+		suite, ok := suites[c.Expectation]
+		if !ok {
+			suite = &junitTestSuite{Name: c.Expectation.String()}
+			suites[c.Expectation] = suite
+			report.Suites = append(report.Suites, suite)
+		}
+		tc := &junitTestCase{Name: c.Name(), ClassName: "fio-benchmark", Time: "0"}
+		if c.Passed {
+			tc.SystemOut = c.Message
+		} else {
+			tc.Failure = &junitMessage{Message: c.Message}
+			suite.Failures++
+		}
+		if c.Item != nil {
+			tc.ClassName = "fio-benchmark." + c.Item.FileName
+		}
+		if c.Job != nil {
+			tc.ClassName = "fio-benchmark." + c.Job.JobOptions.FileName
+			if c.Result.Device != nil && c.Result.Device.Model != "" {
+				tc.ClassName += "." + c.Result.Device.Model
+			}
+			tc.Time = strconv.FormatFloat(float64(c.Job.JobRuntime)/1000, 'f', 3, 64)
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, tc)
+	}
+	for _, suite := range report.Suites {
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+	exectest "github.com/microyahoo/fio-benchmark/pkg/util/exec/test"
+)
+
+func TestExpectationsSuite(t *testing.T) {
+	suite.Run(t, new(expectationsTestSuite))
+}
+
+type expectationsTestSuite struct {
+	suite.Suite
+}
+
+func (s *expectationsTestSuite) TestParseRule() {
+	rule, err := ParseRule("read_iops >= 400000")
+	s.NoError(err)
+	s.Equal(&Rule{Metric: "read_iops", Direction: "read", Op: ">=", Value: 400000}, rule)
+	rule, err = ParseRule("write_p99.9_us<500")
+	s.NoError(err)
+	s.Equal("write", rule.Direction)
+	s.Equal(99.9, rule.Percentile)
+	s.Equal("write_p99.9_us < 500", rule.String())
+
+	for _, r := range []string{"read_iops", "read_iops => 1", "read_qps >= 1", "read_iops >= many", "read_pxx_us <= 1"} {
+		_, err = ParseRule(r)
+		s.Error(err, r)
+	}
+
+	cfg := func(rules string) []byte {
+		return []byte(`
+fio_settings:
+  bs: [4K]
+  filename: [/dev/vdb]
+expectations:
+- rw: randread
+  rules: [` + rules + `]
+`)
+	}
+	settings, err := LoadSettings(cfg("read_iops >= 1, read_p99_us <= 500"))
+	s.NoError(err)
+	s.Len(settings.Expectations[0].Rules, 2)
+	_, err = LoadSettings(cfg("read_p101_us <= 500"))
+	s.ErrorContains(err, "invalid percentile")
+	_, err = LoadSettings(cfg(""))
+	s.ErrorContains(err, "no rules of expectation rw=randread")
+}
+
+func newExpectationResult(filename, model, rw string, iops, p99us float64) *client.FioResult {
+	return &client.FioResult{
+		Device: &client.Device{Model: model},
+		Jobs: []*client.FioJob{{
+			JobOptions: &client.JobOptions{FileName: filename, RW: rw, BlockSize: "4K", IODepth: "32", NumJobs: "4"},
+			ReadResult: &client.ReadResult{
+				IOPSMean: iops,
+				ClatNs:   client.LatencyNs{Percentile: map[string]float64{client.PercentileKey(99): p99us * 1000}},
+			},
+			JobRuntime: 1500,
+		}},
+	}
+}
+
+func (s *expectationsTestSuite) TestCheckExpectations() {
+	expectations := []*Expectation{
+		{Model: "samsung", RW: "randread", IODepth: 32, Rules: []string{"read_iops >= 400000", "read_p99_us <= 500"}},
+		{Name: "hdd", Model: "ST4000", Rules: []string{"read_iops > 100"}},
+		{FileName: "vdb", Rules: []string{"read_p99.9_us <= 100"}},
+	}
+	results := []*client.FioResult{
+		newExpectationResult("/dev/vdb", "SAMSUNG MZQL2", "randread", 450000, 600),
+		newExpectationResult("/dev/vdc", "SAMSUNG MZQL2", "randread", 350000, 400),
+		newExpectationResult("/dev/vdc", "SAMSUNG MZQL2", "randwrite", 0, 0),
+	}
+	checks := CheckExpectations(expectations, results)
+	s.Len(checks, 6)
+	var passed []bool
+	for _, c := range checks {
+		passed = append(passed, c.Passed)
+	}
+	s.Equal([]bool{true, false, false, true, false, false}, passed)
+	s.Equal("/dev/vdb randread bs=4K iodepth=32 numjobs=4: read_p99_us <= 500", checks[1].Name())
+	s.Equal("read_p99_us is 600", checks[1].Message)
+	s.Nil(checks[4].Job, "hdd matched no job")
+	s.Equal("no job is matched", checks[4].Message)
+	s.Equal("read_p99.9_us isn't reported", checks[5].Message)
+
+	err := expectationError(checks)
+	var expectationErr *ExpectationError
+	s.True(errors.As(err, &expectationErr))
+	s.Equal(4, expectationErr.Failed)
+
+	item := &WorkItem{ID: "1", FileName: "/dev/vdd", RW: "randread", BlockSize: "4K", IODepth: 32, NumJobs: 4}
+	checks = append(checks, checkFailedItems([]*failedItem{{item: item, err: errors.New("fio exited with 1")}})...)
+	var buf bytes.Buffer
+	s.NoError(WriteJUnit(&buf, checks))
+	s.True(strings.HasPrefix(buf.String(), xml.Header))
+	var report junitTestSuites
+	s.NoError(xml.Unmarshal(buf.Bytes(), &report))
+	s.Equal(7, report.Tests)
+	s.Equal(5, report.Failures)
+	s.Len(report.Suites, 4)
+	s.Equal("model=samsung,rw=randread,iodepth=32", report.Suites[0].Name)
+	s.Equal("hdd", report.Suites[1].Name)
+	s.Equal("fio-benchmark./dev/vdb.SAMSUNG MZQL2", report.Suites[0].Cases[0].ClassName)
+	s.Equal("1.500", report.Suites[0].Cases[0].Time)
+	s.Equal("read_p99_us is 600", report.Suites[0].Cases[1].Failure.Message)
+	s.Equal("no job is matched", report.Suites[1].Cases[0].Failure.Message)
+	s.Equal("work items", report.Suites[3].Name)
+	s.Equal("vdd-randread-4K-32-4", report.Suites[3].Cases[0].Name)
+	s.Equal("fio-benchmark./dev/vdd", report.Suites[3].Cases[0].ClassName)
+	s.Equal("fio exited with 1", report.Suites[3].Cases[0].Failure.Message)
+}
+
+func (s *expectationsTestSuite) TestRun() {
+	dir := s.T().TempDir()
+	cfgFile := filepath.Join(dir, "conf.yaml")
+	s.NoError(os.WriteFile(cfgFile, []byte(`
+fio_settings:
+  numjobs: [1]
+  bs: [4K]
+  iodepth: [1]
+  rw: [randread]
+  runtime: 10
+  filename: [`+filepath.Join(dir, "fio.db")+`]
+  percentiles: [50]
+expectations:
+- rules: [read_iops >= 1000, read_p99_us <= 500]
+`), 0644))
+	var args []string
+	junitFile := filepath.Join(dir, "junit.xml")
+	server, err := NewFioServer(WithCfgFile(cfgFile), WithChartFile(filepath.Join(dir, "chart.html")),
+		WithOutputFile(filepath.Join(dir, "output.txt")), WithJUnitFile(junitFile))
+	s.NoError(err)
+	server.Executor = &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(command string, args ...string) (string, error) {
+			return "fio-3.27", nil
+		},
+		MockExecuteCommandWithContext: func(ctx context.Context, command string, arg ...string) (string, error) {
+			args = arg
+			return `{"jobs": [{"jobname": "randread", "job options": {"rw": "randread"},
+				"read": {"iops_mean": 2000, "clat_ns": {"percentile": {"50.000000": 100000, "99.000000": 800000}}},
+				"write": {}, "trim": {}}]}`, nil
+		},
+	}
+	err = server.Run(make(chan struct{}))
+	var expectationErr *ExpectationError
+	s.Require().True(errors.As(err, &expectationErr), "%v", err)
+	s.Equal(&ExpectationError{Failed: 1, Total: 2}, expectationErr)
+	s.Contains(strings.Join(args, " "), "--percentile_list 50:99", "the percentile of the rules is reported")
+	data, err := os.ReadFile(junitFile)
+	s.NoError(err)
+	s.Contains(string(data), `<failure message="read_p99_us is 800"></failure>`)
+}
+
+func (s *expectationsTestSuite) TestRunFailedItems() {
+	dir := s.T().TempDir()
+	cfgFile := filepath.Join(dir, "conf.yaml")
+	s.NoError(os.WriteFile(cfgFile, []byte(`
+fio_settings:
+  numjobs: [1]
+  bs: [4K]
+  iodepth: [1]
+  rw: [randread]
+  runtime: 10
+  filename: [`+filepath.Join(dir, "good.db")+`, `+filepath.Join(dir, "bad.db")+`]
+expectations:
+- rules: [read_iops >= 1000]
+- filename: bad.db
+  rules: [read_iops >= 1000]
+`), 0644))
+	junitFile := filepath.Join(dir, "junit.xml")
+	// the charts fail to be rendered, which doesn't hide the failed checks
+	server, err := NewFioServer(WithCfgFile(cfgFile), WithChartFile(filepath.Join(dir, "missing", "chart.html")),
+		WithOutputFile(filepath.Join(dir, "output.txt")), WithJUnitFile(junitFile))
+	s.NoError(err)
+	server.Executor = &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(command string, args ...string) (string, error) {
+			return "fio-3.27", nil
+		},
+		MockExecuteCommandWithContext: func(ctx context.Context, command string, args ...string) (string, error) {
+			if strings.HasSuffix(fioArg(args, "--filename"), "bad.db") {
+				return "", errors.New("fio exited with 1")
+			}
+			return `{"jobs": [{"jobname": "randread", "job options": {"rw": "randread"},
+				"read": {"iops_mean": 2000}, "write": {}, "trim": {}}]}`, nil
+		},
+	}
+	err = server.Run(make(chan struct{}))
+	var expectationErr *ExpectationError
+	s.Require().True(errors.As(err, &expectationErr), "%v", err)
+	// the expectation of bad.db matched no job, and the work item of bad.db failed
+	s.Equal(&ExpectationError{Failed: 2, Total: 3}, expectationErr)
+	data, err := os.ReadFile(junitFile)
+	s.NoError(err)
+	s.Contains(string(data), `<failure message="no job is matched"></failure>`)
+	s.Contains(string(data), `<testsuite name="work items" tests="1" failures="1">`)
+	s.NotContains(string(data), "skipped")
+}
+
+func (s *expectationsTestSuite) TestPreparePercentiles() {
+	dir := s.T().TempDir()
+	prepare := func(percentiles string) (*RunState, error) {
+		cfgFile := filepath.Join(dir, "conf.yaml")
+		s.NoError(os.WriteFile(cfgFile, []byte(`
+fio_settings:
+  numjobs: [1]
+  bs: [4K]
+  iodepth: [1]
+  rw: [randread]
+  runtime: 10
+  filename: [`+filepath.Join(dir, "fio.db")+`]
+  percentiles: `+percentiles+`
+expectations:
+- rules: [read_p97_us <= 500]
+`), 0644))
+		server, err := NewFioServer(WithCfgFile(cfgFile), WithChartFile(filepath.Join(dir, "chart.html")), WithDryrun(true))
+		s.Require().NoError(err)
+		server.Executor = &exectest.MockExecutor{
+			MockExecuteCommandWithOutput: func(command string, args ...string) (string, error) {
+				return "fio-3.27", nil
+			},
+		}
+		return server.prepare()
+	}
+
+	// the percentile of the rule is added to the default percentiles
+	state, err := prepare("[]")
+	s.Require().NoError(err)
+	s.Equal([]float64{50, 90, 97, 99, 99.9, 99.99}, state.Percentiles)
+	s.Equal(state.Percentiles, state.Queues[0].Queue[state.Queues[0].Keys()[0]][0].Percentiles)
+
+	_, err = prepare("[1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20]")
+	s.ErrorContains(err, "at most 20 percentiles can be specified")
+}
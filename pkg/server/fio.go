@@ -2,16 +2,23 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/pkg/errors"
 	"k8s.io/klog/v2"
 
 	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+	"github.com/microyahoo/fio-benchmark/pkg/store"
 	"github.com/microyahoo/fio-benchmark/pkg/util/exec"
+	"github.com/microyahoo/fio-benchmark/pkg/util/sys"
 )
 
 const (
@@ -22,9 +29,23 @@ type ServerOptions struct {
 	jobFile      string
 	cfgFile      string
 	chartFile    string
+	chartType    string
+	chartSpec    *client.ChartSpec
 	outputFile   string
 	dryrun       bool
 	renderFormat string
+	runDir       string
+	resume       bool
+	percentiles  []float64
+	logAvgMsec   uint64
+	prepared     func(state *RunState)
+	itemHandler  ItemHandler
+	store        *store.Store
+	junitFile    string
+	exporter     *Exporter
+	observer     itemObserver
+	label        string
+	metadata     bool
 }
 
 type ServerOption func(*ServerOptions)
@@ -41,6 +62,37 @@ func WithChartFile(chartFile string) ServerOption {
 	}
 }
 
+// WithChartType specifies the type of the charts, eg. 2d, 3d or both.
+func WithChartType(chartType string) ServerOption {
+	return func(opts *ServerOptions) {
+		opts.chartType = chartType
+	}
+}
+
+// WithChartSpec lays out the line charts, whose non-empty fields override the
+// chart of the config file.
+func WithChartSpec(spec *client.ChartSpec) ServerOption {
+	return func(opts *ServerOptions) {
+		opts.chartSpec = spec
+	}
+}
+
+// WithLabel attaches the label to the results of the run, which overrides the
+// label of the config file.
+func WithLabel(label string) ServerOption {
+	return func(opts *ServerOptions) {
+		opts.label = label
+	}
+}
+
+// WithShowMetadata renders the device and host columns in the output, which
+// are always kept in json.
+func WithShowMetadata(metadata bool) ServerOption {
+	return func(opts *ServerOptions) {
+		opts.metadata = metadata
+	}
+}
+
 func WithCfgFile(cfgFile string) ServerOption {
 	return func(opts *ServerOptions) {
 		opts.cfgFile = cfgFile
@@ -59,6 +111,84 @@ func WithDryrun(dryrun bool) ServerOption {
 	}
 }
 
+// WithRunDir specifies the directory where the state and the finished
+// results of the run are saved.
+func WithRunDir(runDir string) ServerOption {
+	return func(opts *ServerOptions) {
+		opts.runDir = runDir
+	}
+}
+
+// WithResume resumes the run saved in the run directory.
+func WithResume(resume bool) ServerOption {
+	return func(opts *ServerOptions) {
+		opts.resume = resume
+	}
+}
+
+// WithPercentiles specifies the completion latency percentiles to report,
+// which overrides the percentiles of the config file.
+func WithPercentiles(percentiles []float64) ServerOption {
+	return func(opts *ServerOptions) {
+		opts.percentiles = percentiles
+	}
+}
+
+// WithLogAvgMsec logs the time series of the work items every logAvgMsec
+// milliseconds, which overrides log_avg_msec of the config file.
+func WithLogAvgMsec(logAvgMsec uint64) ServerOption {
+	return func(opts *ServerOptions) {
+		opts.logAvgMsec = logAvgMsec
+	}
+}
+
+// WithPreparedHandler specifies the handler called with the run state once the
+// work items are prepared and before any of them is run.
+func WithPreparedHandler(handler func(state *RunState)) ServerOption {
+	return func(opts *ServerOptions) {
+		opts.prepared = handler
+	}
+}
+
+// WithItemHandler specifies the handler called for every finished work item,
+// the result is nil if the work item is skipped.
+func WithItemHandler(handler ItemHandler) ServerOption {
+	return func(opts *ServerOptions) {
+		opts.itemHandler = handler
+	}
+}
+
+// withObserver specifies the observer notified once a work item starts and
+// stops running, eg. the agent reporting the progress of the run.
+func withObserver(observer itemObserver) ServerOption {
+	return func(opts *ServerOptions) {
+		opts.observer = observer
+	}
+}
+
+// WithStore specifies the store where the finished run is saved, the run isn't
+// saved in dryrun mode.
+func WithStore(store *store.Store) ServerOption {
+	return func(opts *ServerOptions) {
+		opts.store = store
+	}
+}
+
+// WithJUnitFile specifies the file where the checks of the expectations are
+// written as a JUnit XML report.
+func WithJUnitFile(junitFile string) ServerOption {
+	return func(opts *ServerOptions) {
+		opts.junitFile = junitFile
+	}
+}
+
+// WithExporter publishes the results and the progress of the run by the exporter.
+func WithExporter(exporter *Exporter) ServerOption {
+	return func(opts *ServerOptions) {
+		opts.exporter = exporter
+	}
+}
+
 func WithRenderFormat(format string) ServerOption {
 	return func(opts *ServerOptions) {
 		opts.renderFormat = format
@@ -71,10 +201,26 @@ type FioServer struct {
 	ctx        context.Context
 	cancelFunc context.CancelFunc
 
-	jobFile    string // TODO: not support
+	jobFile    string
 	cfgFile    string
 	chartFile  string
+	chartType  string
+	chartSpec  *client.ChartSpec
 	outputFile string
+	runDir     string
+	resume     bool
+	junitFile  string
+
+	percentiles []float64
+	logAvgMsec  uint64
+	label       string
+	checkpoint  *Checkpoint
+
+	prepared    func(state *RunState)
+	itemHandler ItemHandler
+	store       *store.Store
+	exporter    *Exporter
+	observer    itemObserver
 
 	wg          *sync.WaitGroup
 	workerPool  chan *Worker
@@ -82,9 +228,20 @@ type FioServer struct {
 
 	dryrun       bool
 	renderFormat string
+	metadata     bool
+
+	lock       sync.Mutex
+	results    []*client.FioResult
+	sloReports []*SLOReport
 
-	lock    sync.Mutex
-	results []*client.FioResult
+	preconditions  map[string]*client.Precondition // finished preconditioning keyed by the device
+	resumed        map[string]WorkItems            // work items finished before the run was resumed keyed by the queue key
+	resumedResults map[string]*client.FioResult    // results of the resumed work items keyed by the id
+	aggregated     []*client.AggregatedResult
+	failed         map[string]*failedItem // work items failed in the run keyed by the id
+
+	host    *sys.HostInfo             // facts of the host which are attached to the results
+	devices map[string]*client.Device // snapshots of the devices keyed by the filename
 
 	settings *TestSettings
 }
@@ -102,56 +259,593 @@ func NewFioServer(options ...ServerOption) (*FioServer, error) {
 		jobFile:      opts.jobFile,
 		cfgFile:      opts.cfgFile,
 		chartFile:    opts.chartFile,
+		chartType:    opts.chartType,
+		chartSpec:    opts.chartSpec,
 		outputFile:   opts.outputFile,
 		renderFormat: opts.renderFormat,
+		metadata:     opts.metadata,
 		dryrun:       opts.dryrun,
+		runDir:       opts.runDir,
+		resume:       opts.resume,
+		percentiles:  opts.percentiles,
+		logAvgMsec:   opts.logAvgMsec,
+		label:        opts.label,
+		prepared:     opts.prepared,
+		itemHandler:  opts.itemHandler,
+		store:        opts.store,
+		junitFile:    opts.junitFile,
+		exporter:     opts.exporter,
+		observer:     opts.observer,
+		failed:       make(map[string]*failedItem),
 	}
+	s.ctx = withItemObserver(ctx, s)
 	return s, nil
 }
 
 func (s *FioServer) Run(stopCh <-chan struct{}) (err error) {
+	// the stop channel isn't closed if the run is finished, eg. by the agent
+	// which runs the servers one after another
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stopCh:
+			s.Close()
+		case <-s.ctx.Done():
+		case <-done:
+		}
+	}()
 	_, err = client.FioVersion(s.Executor)
 	if err != nil {
 		return err
 	}
-	settings, err := ParseSettings(s.cfgFile)
+	state, err := s.prepare()
 	if err != nil {
 		return err
 	}
-	s.settings = settings
-	err = s.doWork(settings)
-	if err != nil {
+	if s.prepared != nil {
+		s.prepared(state)
+	}
+	if s.exporter != nil {
+		s.exporter.prepared(s.progressItems(state))
+	}
+	s.collectMetadata(state)
+	if s.settings != nil && s.settings.SLO != nil {
+		s.runSLO(state)
+	} else {
+		s.runQueues(state)
+	}
+	if s.ctx.Err() != nil {
+		klog.Warningf("fio benchmark is interrupted, rendering the %d finished results", len(s.results))
+	}
+	chartResults := s.results
+	if state.Repeat > 1 {
+		s.aggregated = client.AggregateResults(s.results, state.MaxCV)
+		chartResults = nil
+		for _, a := range s.aggregated {
+			if a.Unstable {
+				klog.Warningf("Results of %s %s %s numjobs %s iodepth %s are unstable, the coefficient of variation is above %v%%",
+					a.Options.FileName, a.Options.RW, a.Options.BlockSize, a.Options.NumJobs, a.Options.IODepth, state.MaxCV)
+			}
+			chartResults = append(chartResults, a.MeanResult())
+		}
+	}
+	s.printResults(s.outputFile, s.renderFormat, state.Percentiles)
+	s.saveRecord(state)
+	// the expectations are checked first so that the failed checks are reported
+	// even if the charts can't be rendered
+	expectationErr := s.checkExpectations(state)
+	if err = client.RenderCharts(chartResults, s.chartFile, s.chartType, state.Chart); err != nil {
+		klog.Warningf("Failed to render charts: %v", err)
+		if expectationErr != nil {
+			return expectationErr
+		}
 		return err
 	}
-	s.printResults(s.outputFile, s.renderFormat)
-	err = client.RenderCharts(s.results, s.settings.FioSettings.NumJobs, s.chartFile)
+	if s.ctx.Err() != nil {
+		if s.checkpoint != nil {
+			return errors.Errorf("fio benchmark is interrupted, it can be resumed from %s", s.checkpoint.Dir())
+		}
+		return errors.New("fio benchmark is interrupted")
+	}
+	return expectationErr
+}
+
+// checkExpectations checks the results against the expectations and writes the
+// JUnit XML report, an ExpectationError is returned if any check failed. The
+// expectations aren't checked in dryrun mode since there is no result.
+func (s *FioServer) checkExpectations(state *RunState) error {
+	if len(state.Expectations) == 0 && s.junitFile == "" {
+		return nil
+	}
+	if s.dryrun {
+		klog.Infof("Skip checking the expectations in dryrun mode")
+		return nil
+	}
+	checks := CheckExpectations(state.Expectations, s.results)
+	checks = append(checks, checkFailedItems(s.failedItems())...)
+	for _, c := range checks {
+		if !c.Passed {
+			klog.Warningf("Expectation %s failed: %s, %s", c.Expectation, c.Name(), c.Message)
+		}
+	}
+	if s.junitFile != "" {
+		f, err := os.Create(s.junitFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to create the JUnit report")
+		}
+		defer f.Close()
+		if err = WriteJUnit(f, checks); err != nil {
+			return errors.Wrapf(err, "failed to write the JUnit report %s", s.junitFile)
+		}
+	}
+	err := expectationError(checks)
+	if err == nil {
+		klog.Infof("All the %d expectation checks passed", len(checks))
+	}
+	return err
+}
+
+// saveRecord saves the results of the run into the store, the chart file is
+// named by the id of the record if it's not specified.
+func (s *FioServer) saveRecord(state *RunState) {
+	if s.store == nil || s.dryrun || len(s.results) == 0 {
+		return
+	}
+	record := &store.Record{
+		ConfigFile:  s.cfgFile,
+		Interrupted: s.ctx.Err() != nil,
+		Host:        s.host,
+		Devices:     s.devices,
+		Percentiles: state.Percentiles,
+		Results:     s.results,
+		Aggregated:  s.aggregated,
+	}
+	if s.jobFile != "" {
+		record.ConfigFile = s.jobFile
+	}
+	if record.ConfigFile != "" {
+		if data, err := os.ReadFile(record.ConfigFile); err == nil {
+			record.Config = string(data)
+		}
+	}
+	if err := s.store.Save(record); err != nil {
+		klog.Warningf("Failed to save the results into store %s: %v", s.store.Dir(), err)
+		return
+	}
+	klog.Infof("Results are saved into store %s as %s", s.store.Dir(), record.ID)
+	if s.chartFile == "" {
+		s.chartFile = fmt.Sprintf("chart-%s.html", record.ID)
+	}
+}
+
+// prepare builds the work queues of the run from the job file or the config
+// file, or loads the remaining work items if the run is resumed.
+func (s *FioServer) prepare() (*RunState, error) {
+	if s.resume {
+		state, err := s.resumeState()
+		if err != nil {
+			return nil, err
+		}
+		if err = s.prepareCharts(state); err != nil {
+			return nil, err
+		}
+		return state, s.checkWriteTargets(state)
+	}
+	state, settings, err := NewRunState(s.jobFile, s.cfgFile, s.Executor)
 	if err != nil {
-		klog.Warningf("Failed to render charts", err)
+		return nil, err
+	}
+	s.settings = settings
+	if len(s.percentiles) > 0 {
+		if err = ValidatePercentiles(s.percentiles); err != nil {
+			return nil, err
+		}
+		state.SetPercentiles(s.percentiles)
+	}
+	if len(state.Percentiles) == 0 && !state.jobFilePercentiles() {
+		state.SetPercentiles(client.DefaultPercentiles)
+	}
+	if s.logAvgMsec > 0 {
+		if settings != nil && len(settings.Hosts) > 0 {
+			return nil, errors.New("log_avg_msec is not supported by hosts")
+		}
+		state.SetLogAvgMsec(s.logAvgMsec)
+	}
+	if settings != nil && settings.SLO != nil {
+		if s.runDir != "" {
+			return nil, errors.New("run directory is not supported by slo search")
+		}
+		state.Percentiles = requirePercentile(state.Percentiles, settings.SLO.Percentile)
+	}
+	if state.Saturation != nil {
+		if p, ok := state.Saturation.percentile(); ok {
+			state.SetPercentiles(requirePercentile(state.Percentiles, p))
+		}
+	}
+	for _, p := range expectationPercentiles(state.Expectations) {
+		state.SetPercentiles(requirePercentile(state.Percentiles, p))
+	}
+	if err = ValidatePercentiles(state.Percentiles); err != nil {
+		return nil, errors.Wrap(err, "invalid percentiles including those of the slo, saturation and expectations")
+	}
+	if s.label != "" {
+		state.Label = s.label
+	}
+	if err = s.prepareCharts(state); err != nil {
+		return nil, err
+	}
+	if err = s.checkWriteTargets(state); err != nil {
+		return nil, err
+	}
+	assignItemIDs(state.Queues)
+	dryrun := s.dryrun
+	state.Dryrun = &dryrun
+	if s.runDir != "" {
+		if _, err := OpenCheckpoint(s.runDir); err == nil {
+			return nil, errors.Errorf("run directory %s already exists, it can be resumed by the resume command", s.runDir)
+		}
+		checkpoint, err := NewCheckpoint(s.runDir)
+		if err != nil {
+			return nil, err
+		}
+		if err = checkpoint.SaveState(state); err != nil {
+			return nil, err
+		}
+		s.checkpoint = checkpoint
+	}
+	return state, nil
+}
+
+// prepareCharts overrides the chart spec of the run by the chart spec of the
+// server, which is validated so that an invalid spec fails the run before any
+// work item is run. The label of the run is attached to the finished results.
+func (s *FioServer) prepareCharts(state *RunState) error {
+	spec := state.Chart.Override(s.chartSpec)
+	if _, err := spec.Resolve(); err != nil {
 		return err
 	}
-	// <-stopCh
+	state.Chart = spec
+	s.label = state.Label
+	for _, result := range s.results {
+		result.Label = s.label
+	}
 	return nil
 }
 
-func (s *FioServer) doWork(settings *TestSettings) error {
+// checkWriteTargets refuses to run write workloads on the block devices in use,
+// which is only warned in dryrun mode.
+func (s *FioServer) checkWriteTargets(state *RunState) error {
+	var slo *SLOSettings
+	if s.settings != nil {
+		slo = s.settings.SLO
+	}
+	err := checkWriteTargets(s.Executor, writeTargets(state, slo), state.AllowDestroy)
+	if err != nil && s.dryrun {
+		klog.Warningf("%v", err)
+		return nil
+	}
+	return err
+}
+
+// NewRunState builds the work queues from the job file if it's specified,
+// otherwise from the config file, the settings is nil for the job file.
+func NewRunState(jobFile, cfgFile string, executor exec.Executor) (*RunState, *TestSettings, error) {
+	state := &RunState{}
+	if jobFile != "" {
+		queues, err := NewJobFileQueues(jobFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		klog.Infof("There are %d stonewall groups in job file %s", len(queues), jobFile)
+		state.Queues = queues
+		return state, nil, nil
+	}
+	settings, err := ParseSettings(cfgFile)
+	if err != nil {
+		return nil, nil, err
+	}
 	klog.Infof("fio test settings: %+v, use_all_disk: %t, workers: %d", settings.FioSettings, settings.UseAllDisks, settings.Workers)
-	workQueue, err := NewWorkQueue(settings, s.Executor)
+	workQueue, err := NewWorkQueue(settings, executor)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	if workQueue != nil && len(workQueue.Queue) > 0 {
+		if settings.Tuning != nil {
+			workQueue.Tune(settings.Tuning)
+		}
+		if settings.Repeat > 1 {
+			var rnd *rand.Rand
+			if settings.Shuffle {
+				seed := time.Now().UnixNano()
+				klog.Infof("Shuffle the trials with seed %d", seed)
+				rnd = rand.New(rand.NewSource(seed))
+			}
+			workQueue.Repeat(settings.Repeat, rnd)
+		}
+		state.Queues = []*WorkQueue{workQueue}
+	}
+	state.Workers = settings.Workers
+	state.Saturation = settings.Saturation
+	state.Precondition = settings.Precondition
+	state.AllowDestroy = settings.AllowDestroy
+	state.Repeat = settings.Repeat
+	state.MaxCV = settings.MaxCV
+	state.Expectations = settings.Expectations
+	state.SetPercentiles(settings.FioSettings.Percentiles)
+	state.SetLogAvgMsec(settings.FioSettings.LogAvgMsec)
+	state.Label = settings.Label
+	state.Chart = settings.Chart
+	return state, settings, nil
+}
+
+// resumeState loads the run state from the run directory, the finished work
+// items are removed from the queues and their results are loaded.
+func (s *FioServer) resumeState() (*RunState, error) {
+	checkpoint, err := OpenCheckpoint(s.runDir)
+	if err != nil {
+		return nil, err
+	}
+	state, err := checkpoint.LoadState()
+	if err != nil {
+		return nil, err
 	}
-	if len(workQueue.Queue) == 0 {
+	if state.Dryrun != nil && *state.Dryrun != s.dryrun {
+		return nil, errors.Errorf("the run in %s was started with dryrun %t, which can't be resumed with dryrun %t", s.runDir, *state.Dryrun, s.dryrun)
+	}
+	results, err := checkpoint.LoadResults()
+	if err != nil {
+		return nil, err
+	}
+	skipped, err := checkpoint.LoadSkipped()
+	if err != nil {
+		return nil, err
+	}
+	s.preconditions, err = checkpoint.LoadPreconditions()
+	if err != nil {
+		return nil, err
+	}
+	var finished, remaining int
+	s.resumed = make(map[string]WorkItems)
+	s.resumedResults = results
+	for _, queue := range state.Queues {
+		for key, items := range queue.Queue {
+			var left []*WorkItem
+			for _, item := range items {
+				if result, ok := results[item.ID]; ok {
+					s.results = append(s.results, result)
+					s.resumed[key] = append(s.resumed[key], item)
+					finished++
+				} else if skipped[item.ID] {
+					finished++
+				} else {
+					left = append(left, item)
+				}
+			}
+			if len(left) == 0 {
+				delete(queue.Queue, key)
+			} else {
+				queue.Queue[key] = left
+			}
+			remaining += len(left)
+		}
+	}
+	klog.Infof("Resuming run %s, %d work items are finished, %d work items remain", s.runDir, finished, remaining)
+	s.checkpoint = checkpoint
+	return state, nil
+}
+
+// runQueues runs the queues one after another.
+func (s *FioServer) runQueues(state *RunState) {
+	var total int
+	for _, queue := range state.Queues {
+		total += queue.Len()
+	}
+	if total == 0 {
 		klog.Infof("There is no work need to do")
-		return nil
+		return
+	}
+	for i, queue := range state.Queues {
+		if s.ctx.Err() != nil {
+			break
+		}
+		if len(queue.Queue) == 0 {
+			continue
+		}
+		if len(state.Queues) > 1 {
+			klog.Infof("Running stonewall group %d with %d jobs", i, len(queue.Queue))
+		} else {
+			klog.Infof("There are %d devices need to run", len(queue.Queue))
+		}
+		s.runQueue(queue, state)
+	}
+}
+
+// runSLO searches the max sustainable IOPS under the SLO for each device of the
+// queues, the devices are searched concurrently by the workers.
+func (s *FioServer) runSLO(state *RunState) {
+	var jobs []Job
+	var searches []*SLOSearch
+	for _, queue := range state.Queues {
+		for _, key := range queue.Keys() {
+			search := NewSLOSearch(queue.Queue[key][0], s.settings.SLO)
+			searches = append(searches, search)
+			job := withTuning(search, []*WorkItem{search.Item})
+			job = s.withMetadata(job, search.Item.FileName)
+			jobs = append(jobs, s.withPrecondition(job, search.Item.FileName, state.Precondition))
+		}
+	}
+	if len(jobs) == 0 {
+		klog.Infof("There is no work need to do")
+		return
+	}
+	klog.Infof("Searching max IOPS under %s for %d devices with method %s", s.settings.SLO, len(jobs), s.settings.SLO.Method)
+	s.runJobs(jobs, int(state.Workers))
+	for _, search := range searches {
+		if search.Report != nil && search.Report.Trials > 0 {
+			s.sloReports = append(s.sloReports, search.Report)
+		}
+	}
+}
+
+// progressItems returns the work items whose progress is reported, which are
+// the first work items of the devices if the SLO is searched since the others
+// are replaced by the trials of the search.
+func (s *FioServer) progressItems(state *RunState) []*WorkItem {
+	slo := s.settings != nil && s.settings.SLO != nil
+	var items []*WorkItem
+	for _, queue := range state.Queues {
+		for _, key := range queue.Keys() {
+			if slo {
+				items = append(items, queue.Queue[key][0])
+			} else {
+				items = append(items, queue.Queue[key]...)
+			}
+		}
+	}
+	return items
+}
+
+// itemFinished saves the result of the finished work item into the checkpoint,
+// the work item is marked as skipped if the result is nil.
+func (s *FioServer) itemFinished(item *WorkItem, result *client.FioResult) {
+	if result != nil && s.label != "" {
+		result.Label = s.label
+	}
+	if s.itemHandler != nil {
+		s.itemHandler(item, result)
+	}
+	if s.exporter != nil {
+		s.exporter.itemFinished(item, result)
+	}
+	if s.checkpoint == nil {
+		return
+	}
+	if result == nil {
+		if err := s.checkpoint.SaveSkipped(item); err != nil {
+			klog.Warningf("Failed to mark %s as skipped: %v", item, err)
+		}
+		return
+	}
+	if err := s.checkpoint.SaveResult(item, result); err != nil {
+		klog.Warningf("Failed to save the result of %s: %v", item, err)
+	}
+}
+
+func (s *FioServer) itemStarted(item *WorkItem) {
+	if s.exporter != nil {
+		s.exporter.itemStarted(item)
+	}
+	if s.observer != nil {
+		s.observer.itemStarted(item)
+	}
+}
+
+// itemStopped records the failed work items, which fail the expectations.
+func (s *FioServer) itemStopped(item *WorkItem, err error) {
+	if s.exporter != nil {
+		s.exporter.itemStopped(item, err)
+	}
+	if s.observer != nil {
+		s.observer.itemStopped(item, err)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err != nil {
+		s.failed[item.ID] = &failedItem{item: item, err: err}
 	} else {
-		klog.Infof("There are %d devices need to run", len(workQueue.Queue))
+		delete(s.failed, item.ID)
+	}
+}
+
+// failedItems returns the failed work items sorted by the id.
+func (s *FioServer) failedItems() []*failedItem {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	failed := make([]*failedItem, 0, len(s.failed))
+	for _, f := range s.failed {
+		failed = append(failed, f)
+	}
+	sort.Slice(failed, func(i, j int) bool {
+		return failed[i].item.ID < failed[j].item.ID
+	})
+	return failed
+}
+
+// kneeDetected saves the knee flag of the result into the checkpoint, whose
+// work item was already finished.
+func (s *FioServer) kneeDetected(item *WorkItem, result *client.FioResult) {
+	if s.checkpoint == nil {
+		return
+	}
+	if err := s.checkpoint.SaveResult(item, result); err != nil {
+		klog.Warningf("Failed to save the knee of %s: %v", item, err)
+	}
+}
+
+// runQueue runs the work items of the queue with at most state.Workers workers,
+// the items with the same key are run one by one. All the keys are run
+// concurrently if the workers is not positive. The higher concurrency items
+// are skipped once the knee is detected if saturation is specified.
+func (s *FioServer) runQueue(workQueue *WorkQueue, state *RunState) {
+	var jobs []Job
+	for _, key := range workQueue.Keys() {
+		items := workQueue.Queue[key]
+		var job Job = (WorkItems)(items)
+		if state.Saturation != nil && items[0].Job == nil {
+			// the finished work items seed the knee detection of the resumed run
+			job = &SaturationItems{Items: append(append(WorkItems{}, s.resumed[key]...), items...), Saturation: state.Saturation,
+				Finished: s.resumedResults, Knee: s.kneeDetected}
+		}
+		job = withTuning(job, items)
+		job = s.withMetadata(job, items[0].FileName)
+		jobs = append(jobs, s.withPrecondition(job, items[0].FileName, state.Precondition))
+	}
+	s.runJobs(jobs, int(state.Workers))
+}
+
+// withPrecondition wraps the job of the device to precondition the device
+// first if preconditioning is specified.
+func (s *FioServer) withPrecondition(job Job, filename string, settings *client.PreconditionSettings) Job {
+	if settings == nil {
+		return job
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return &PreconditionedJob{
+		Job:          job,
+		FileName:     filename,
+		Settings:     settings,
+		Precondition: s.preconditions[filename],
+		finished:     s.preconditioned,
+	}
+}
+
+// preconditioned records the finished preconditioning into the checkpoint.
+func (s *FioServer) preconditioned(filename string, p *client.Precondition) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.preconditions == nil {
+		s.preconditions = make(map[string]*client.Precondition)
+	}
+	s.preconditions[filename] = p
+	if s.checkpoint == nil {
+		return
+	}
+	if err := s.checkpoint.SavePreconditions(s.preconditions); err != nil {
+		klog.Warningf("Failed to save the preconditioning of %s: %v", filename, err)
+	}
+}
+
+// runJobs runs the jobs with at most numWorkers workers, all the jobs are run
+// concurrently if numWorkers is not positive.
+func (s *FioServer) runJobs(jobs []Job, numWorkers int) {
+	if numWorkers <= 0 || numWorkers > len(jobs) {
+		numWorkers = len(jobs)
 	}
-	numWorkers := int(settings.Workers)
 	if numWorkers > WorkersLimit {
 		numWorkers = WorkersLimit
 	}
-	if numWorkers > len(workQueue.Queue) {
-		numWorkers = len(workQueue.Queue)
-	}
 	wg := &sync.WaitGroup{}
 	s.wg = wg
 	s.jobListener = make(chan *DelayedJob)
@@ -163,10 +857,9 @@ func (s *FioServer) doWork(settings *TestSettings) error {
 		for job := range s.jobListener {
 			time.Sleep(job.delayPeriod)
 			worker := <-s.workerPool
-			worker.wg.Add(1)
 			go func(job Job, worker *Worker) {
 				defer worker.wg.Done()
-				results, _ := job.Do(s.Executor, s.dryrun)
+				results, _ := job.Do(s.ctx, s.Executor, s.dryrun, s.itemFinished)
 				s.lock.Lock()
 				s.results = append(s.results, results...)
 				s.lock.Unlock()
@@ -175,94 +868,68 @@ func (s *FioServer) doWork(settings *TestSettings) error {
 			}(job, worker)
 		}
 	}()
-	for _, items := range workQueue.Queue {
-		s.jobListener <- &DelayedJob{Job: (WorkItems)(items)}
+dispatch:
+	for _, job := range jobs {
+		wg.Add(1) // must be added before dispatching, otherwise Wait may return too early
+		select {
+		case s.jobListener <- &DelayedJob{Job: job}:
+		case <-s.ctx.Done():
+			wg.Done()
+			klog.Infof("Stop dispatching work items since benchmark is canceled")
+			break dispatch
+		}
 	}
 	s.wg.Wait()          // wait for all worker to finish their jobs
 	close(s.jobListener) // stop job dispatching loop
+}
+
+// Output is the results of the run rendered in json format.
+type Output struct {
+	Results     []*client.FioResult        `json:"results"`
+	SLOReports  []*SLOReport               `json:"slo_reports,omitempty"`
+	Aggregated  []*client.AggregatedResult `json:"aggregated,omitempty"`
+	Percentiles []float64                  `json:"percentiles,omitempty"`
+	Metadata    bool                       `json:"-"` // whether the device and host columns are rendered
+}
 
+// Render renders the output in the format, eg. table, html, markdown, csv, json.
+func (o *Output) Render(w io.Writer, format string) error {
+	if strings.ToLower(format) == "json" {
+		// a single document so that it can be parsed by the other tools
+		data, err := json.MarshalIndent(o, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal the results")
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+	client.RenderResults(o.Results, w, format, o.Percentiles, o.Metadata)
+	if len(o.SLOReports) > 0 {
+		RenderSLOReports(o.SLOReports, w, format)
+	}
+	if len(o.Aggregated) > 0 {
+		client.RenderAggregatedResults(o.Aggregated, w, format)
+	}
+	if client.HasTimeSeries(o.Results) {
+		client.RenderStability(o.Results, w, format)
+	}
 	return nil
 }
 
-func (s *FioServer) printResults(outputFile, format string) {
-	t := table.NewWriter()
+func (s *FioServer) printResults(outputFile, format string, percentiles []float64) {
+	var w io.Writer = os.Stdout
 	if outputFile != "" {
 		f, err := os.Create(outputFile)
 		if err != nil {
 			klog.Warningf("Failed to open file %s: %s", outputFile, err)
-			t.SetOutputMirror(os.Stdout)
 		} else {
 			defer f.Close()
-			t.SetOutputMirror(f)
+			w = f
 		}
-	} else {
-		t.SetOutputMirror(os.Stdout)
 	}
-	t.AppendHeader(table.Row{ //"job",
-		"filename", "rw", "numjobs", "runtime", "direct", "blocksize", "iodepth",
-		"read-iops-mean", "read-bw-mean(KiB/s)", "latency-read-min(us)", "latency-read-max(us)", "latency-read-mean(us)", "read-stddev(us)",
-		"write-iops-mean", "write-bw-mean(KiB/s)", "latency-write-min(us)", "latency-write-max(us)", "latency-write-mean(us)", "latency-write-stddev(us)",
-		"ioengine", "verify"})
-	for _, result := range s.results {
-		for _, job := range result.Jobs {
-			t.AppendRow(table.Row{
-				// job.JobName,
-				job.JobOptions.FileName,
-				job.JobOptions.RW,
-				job.JobOptions.NumJobs,
-				job.JobOptions.Runtime,
-				job.JobOptions.Direct,
-				job.JobOptions.BlockSize,
-				job.JobOptions.IODepth,
-				job.ReadResult.IOPSMean,
-				job.ReadResult.BWMean,
-				job.ReadResult.LatencyNs.Min / 1000,
-				job.ReadResult.LatencyNs.Max / 1000,
-				job.ReadResult.LatencyNs.Mean / 1000,
-				job.ReadResult.LatencyNs.Stddev / 1000,
-				job.WriteResult.IOPSMean,
-				job.WriteResult.BWMean,
-				job.WriteResult.LatencyNs.Min / 1000,
-				job.WriteResult.LatencyNs.Max / 1000,
-				job.WriteResult.LatencyNs.Mean / 1000,
-				job.WriteResult.LatencyNs.Stddev / 1000,
-				job.JobOptions.IOEngine,
-				job.JobOptions.Verify,
-			})
-		}
-		t.AppendSeparator()
-	}
-	t.SortBy([]table.SortBy{
-		{
-			Name: "filename",
-			Mode: table.Asc,
-		},
-		{
-			Name: "numjobs",
-			Mode: table.Asc,
-		},
-		{
-			Name: "iodepth",
-			Mode: table.Asc,
-		},
-		{
-			Name: "rw",
-			Mode: table.Asc,
-		},
-		{
-			Name: "blocksize",
-			Mode: table.Asc,
-		},
-	})
-	switch strings.ToLower(format) {
-	case "md", "markdown":
-		t.RenderMarkdown()
-	case "csv":
-		t.RenderCSV()
-	case "html":
-		t.RenderHTML()
-	default:
-		t.Render()
+	output := &Output{Results: s.results, SLOReports: s.sloReports, Aggregated: s.aggregated, Percentiles: percentiles, Metadata: s.metadata}
+	if err := output.Render(w, format); err != nil {
+		klog.Warningf("Failed to render the results: %v", err)
 	}
 }
 
@@ -280,7 +947,7 @@ type Worker struct {
 // Job defines a task, which is given to a dispatcher to be executed
 // by a worker with a separate goroutine
 type Job interface {
-	Do(context exec.Executor, dryrun bool) ([]*client.FioResult, error)
+	Do(ctx context.Context, executor exec.Executor, dryrun bool, handler ItemHandler) ([]*client.FioResult, error)
 }
 
 type DelayedJob struct {
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	exectest "github.com/microyahoo/fio-benchmark/pkg/util/exec/test"
+)
+
+func TestFioServerSuite(t *testing.T) {
+	suite.Run(t, new(fioServerTestSuite))
+}
+
+type fioServerTestSuite struct {
+	suite.Suite
+}
+
+func (s *fioServerTestSuite) TestRunReleasesGoroutines() {
+	cfgFile := filepath.Join(s.T().TempDir(), "conf.yaml")
+	s.NoError(os.WriteFile(cfgFile, []byte(fmt.Sprintf(`
+fio_settings:
+  numjobs: [1]
+  bs: [4K]
+  iodepth: [1]
+  rw: [randread]
+  runtime: 10
+  filename: [%s]
+`, filepath.Join(s.T().TempDir(), "fio.db"))), 0644))
+	stopCh := make(chan struct{}) // never closed, eg. the stop channel of the agent
+	run := func() {
+		server, err := NewFioServer(WithCfgFile(cfgFile), WithChartFile(filepath.Join(s.T().TempDir(), "chart.html")),
+			WithOutputFile(filepath.Join(s.T().TempDir(), "output.txt")))
+		s.Require().NoError(err)
+		server.Executor = &exectest.MockExecutor{
+			MockExecuteCommandWithOutput: func(command string, args ...string) (string, error) {
+				return "fio-3.27", nil
+			},
+			MockExecuteCommandWithContext: func(ctx context.Context, command string, args ...string) (string, error) {
+				return `{"jobs": [{"jobname": "randread", "job options": {"rw": "randread"}, "read": {"iops_mean": 100}, "write": {}, "trim": {}}]}`, nil
+			},
+		}
+		s.Require().NoError(server.Run(stopCh))
+	}
+	run()
+	baseline := runtime.NumGoroutine()
+	for i := 0; i < 5; i++ {
+		run()
+	}
+	s.Eventually(func() bool { return runtime.NumGoroutine() <= baseline }, time.Second, 10*time.Millisecond,
+		"%d goroutines are left, %d before", runtime.NumGoroutine(), baseline)
+}
+
+func (s *fioServerTestSuite) TestDefaultPercentiles() {
+	dir := s.T().TempDir()
+	prepare := func(opts ...ServerOption) *RunState {
+		server, err := NewFioServer(append(opts, WithChartFile(filepath.Join(dir, "chart.html")), WithDryrun(true))...)
+		s.Require().NoError(err)
+		server.Executor = &exectest.MockExecutor{
+			MockExecuteCommandWithOutput: func(command string, args ...string) (string, error) {
+				return "fio-3.27", nil
+			},
+		}
+		state, err := server.prepare()
+		s.Require().NoError(err)
+		return state
+	}
+	items := func(state *RunState) []*WorkItem {
+		var items []*WorkItem
+		for _, queue := range state.Queues {
+			for _, key := range queue.Keys() {
+				items = append(items, queue.Queue[key]...)
+			}
+		}
+		s.Require().NotEmpty(items)
+		return items
+	}
+	defaults := []float64{50, 90, 99, 99.9, 99.99}
+
+	cfgFile := filepath.Join(dir, "conf.yaml")
+	s.NoError(os.WriteFile(cfgFile, []byte(fmt.Sprintf(`
+fio_settings:
+  numjobs: [1]
+  bs: [4K]
+  iodepth: [1]
+  rw: [randread]
+  runtime: 10
+  filename: [%s]
+`, filepath.Join(dir, "fio.db"))), 0644))
+	state := prepare(WithCfgFile(cfgFile))
+	s.Equal(defaults, state.Percentiles)
+	for _, item := range items(state) {
+		s.Equal("50:90:99:99.9:99.99", fioArg(item.fioArgs(), "--percentile_list"))
+	}
+	state = prepare(WithCfgFile(cfgFile), WithPercentiles([]float64{99}))
+	s.Equal([]float64{99}, state.Percentiles)
+
+	jobFile := filepath.Join(dir, "job.fio")
+	s.NoError(os.WriteFile(jobFile, []byte("[job]\nfilename="+filepath.Join(dir, "fio.db")+"\nrw=randread\n"), 0644))
+	state = prepare(WithJobFile(jobFile))
+	s.Equal(defaults, state.Percentiles)
+	for _, item := range items(state) {
+		s.Equal(defaults, item.Percentiles)
+	}
+
+	// the percentile_list of the job file isn't replaced
+	s.NoError(os.WriteFile(jobFile, []byte("[job]\nfilename="+filepath.Join(dir, "fio.db")+"\nrw=randread\npercentile_list=99:99.9\n"), 0644))
+	state = prepare(WithJobFile(jobFile))
+	s.Empty(state.Percentiles)
+	for _, item := range items(state) {
+		s.Empty(item.Percentiles)
+		s.Equal("99:99.9", fioArg(item.clientArgs(), "--percentile_list"))
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/microyahoo/fio-benchmark/pkg/util/exec"
+	"github.com/microyahoo/fio-benchmark/pkg/util/sys"
+)
+
+// AllowDestroy is a block device which is allowed to be overwritten although it's
+// in use, the device is confirmed by its serial or WWN.
+type AllowDestroy struct {
+	Device string `json:"device" yaml:"device"`
+	Serial string `json:"serial,omitempty" yaml:"serial"`
+	WWN    string `json:"wwn,omitempty" yaml:"wwn"`
+}
+
+func (a *AllowDestroy) validate() error {
+	if a.Device == "" {
+		return errors.New("device of allow_destroy should be specified")
+	}
+	if a.Serial == "" && a.WWN == "" {
+		return errors.Errorf("serial or wwn of allow_destroy device %s should be specified", a.Device)
+	}
+	return nil
+}
+
+// matches returns whether the entry is the device and the serial or WWN is confirmed.
+func (a *AllowDestroy) matches(target string, device *sys.LocalDevice) bool {
+	if !sameFile(a.Device, target) {
+		return false
+	}
+	if a.Serial != "" && a.Serial == device.Serial {
+		return true
+	}
+	return a.WWN != "" && (a.WWN == device.WWN || a.WWN == device.WWNVendorExtension)
+}
+
+func sameFile(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ra, err1 := filepath.EvalSymlinks(a)
+	rb, err2 := filepath.EvalSymlinks(b)
+	return err1 == nil && err2 == nil && ra == rb
+}
+
+// isBlockDevice is a variable so that it can be mocked in tests.
+var isBlockDevice = func(path string) bool {
+	st, err := os.Stat(path)
+	return err == nil && st.Mode()&os.ModeDevice != 0 && st.Mode()&os.ModeCharDevice == 0
+}
+
+// isWriteWorkload returns whether the fio rw writes or trims the target.
+func isWriteWorkload(rw string) bool {
+	switch rw {
+	case "", "read", "randread":
+		return false
+	}
+	return true
+}
+
+// writeTargets returns the write workloads of the run keyed by the target.
+func writeTargets(state *RunState, slo *SLOSettings) map[string][]string {
+	targets := make(map[string][]string)
+	add := func(filename, workload string) {
+		// fio separates multiple files by colon
+		for _, f := range strings.Split(filename, ":") {
+			if f == "" {
+				continue
+			}
+			for _, w := range targets[f] {
+				if w == workload {
+					return
+				}
+			}
+			targets[f] = append(targets[f], workload)
+		}
+	}
+	for _, queue := range state.Queues {
+		for _, items := range queue.Queue {
+			for _, item := range items {
+				if len(item.Hosts) > 0 {
+					continue // the devices of the fio servers can't be checked locally
+				}
+				if state.Precondition != nil {
+					add(item.FileName, "precondition")
+				}
+				if slo != nil {
+					if isWriteWorkload(slo.RW) {
+						add(item.FileName, slo.RW)
+					}
+				} else if isWriteWorkload(item.RW) {
+					add(item.FileName, item.RW)
+				}
+			}
+		}
+	}
+	return targets
+}
+
+// checkWriteTargets refuses to run write workloads on the block devices which
+// are in use, unless they are allowed to be destroyed explicitly.
+func checkWriteTargets(executor exec.Executor, targets map[string][]string, allowDestroy []*AllowDestroy) error {
+	var names []string
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var refused []string
+	for _, target := range names {
+		if !isBlockDevice(target) {
+			continue
+		}
+		workloads := strings.Join(targets[target], ",")
+		usage, err := sys.GetDeviceUsage(executor, target)
+		if err != nil {
+			refused = append(refused, fmt.Sprintf("%s (%s): failed to check whether it's in use: %v", target, workloads, err))
+			continue
+		}
+		reasons := usage.Reasons()
+		if len(reasons) == 0 {
+			continue
+		}
+		var allowed, listed bool
+		for _, a := range allowDestroy {
+			listed = listed || sameFile(a.Device, target)
+			allowed = allowed || a.matches(target, usage.Device)
+		}
+		if allowed {
+			klog.Warningf("%s will be destroyed by %s although it %s", target, workloads, strings.Join(reasons, ", "))
+			continue
+		}
+		if listed {
+			reasons = append(reasons, fmt.Sprintf("serial %q and wwn %q don't match allow_destroy", usage.Device.Serial, usage.Device.WWN))
+		}
+		refused = append(refused, fmt.Sprintf("%s (%s): %s", target, workloads, strings.Join(reasons, ", ")))
+	}
+	if len(refused) > 0 {
+		return errors.Errorf("refuse to run write workloads on the devices in use, which can be listed in allow_destroy with their serial or wwn:\n  %s",
+			strings.Join(refused, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+	exectest "github.com/microyahoo/fio-benchmark/pkg/util/exec/test"
+	"github.com/microyahoo/fio-benchmark/pkg/util/sys"
+)
+
+func TestGuardSuite(t *testing.T) {
+	suite.Run(t, new(guardTestSuite))
+}
+
+type guardTestSuite struct {
+	suite.Suite
+}
+
+// mockBlockDevices mocks the block devices and returns the function to restore.
+func mockBlockDevices(devices ...string) func() {
+	old := isBlockDevice
+	isBlockDevice = func(path string) bool {
+		for _, d := range devices {
+			if d == path {
+				return true
+			}
+		}
+		return false
+	}
+	return func() { isBlockDevice = old }
+}
+
+// mockDeviceExecutor mocks /dev/vdb with a mounted partition, /dev/vdc with an
+// xfs signature and /dev/vdd which is empty.
+func mockDeviceExecutor() *exectest.MockExecutor {
+	devices := map[string]string{
+		"/dev/vdb": `SIZE="53687091200" ROTA="0" RO="0" TYPE="disk" PKNAME="" NAME="/dev/vdb" KNAME="/dev/vdb" UUID="" WWN="" MOUNTPOINT=""
+SIZE="53686042624" ROTA="0" RO="0" TYPE="part" PKNAME="/dev/vdb" NAME="/dev/vdb1" KNAME="/dev/vdb1" UUID="" WWN="" MOUNTPOINT="/data"`,
+		"/dev/vdc": `SIZE="53687091200" ROTA="0" RO="0" TYPE="disk" PKNAME="" NAME="/dev/vdc" KNAME="/dev/vdc" UUID="" WWN="" MOUNTPOINT=""`,
+		"/dev/vdd": `SIZE="53687091200" ROTA="0" RO="0" TYPE="disk" PKNAME="" NAME="/dev/vdd" KNAME="/dev/vdd" UUID="" WWN="" MOUNTPOINT=""`,
+	}
+	return &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(command string, args ...string) (string, error) {
+			switch command {
+			case "udevadm":
+				device := args[len(args)-1]
+				if device == "/dev/vdc" {
+					return "ID_FS_TYPE=xfs\nID_SERIAL=serial-vdc\nID_WWN=0x5000c500a1b2c3d4", nil
+				}
+				return fmt.Sprintf("ID_SERIAL=serial-%s", filepath.Base(device)), nil
+			case "lsblk":
+				if args[len(args)-1] == "NAME,SIZE,TYPE,PKNAME" {
+					return fmt.Sprintf(`NAME="%s" SIZE="53687091200" TYPE="disk" PKNAME=""`, args[0]), nil
+				}
+				return devices[args[0]], nil
+			}
+			return "fio-3.27", nil
+		},
+	}
+}
+
+func (s *guardTestSuite) SetupTest() {
+	sysfs := s.T().TempDir()
+	old := sys.SysClassBlock
+	sys.SysClassBlock = sysfs
+	s.T().Cleanup(func() { sys.SysClassBlock = old })
+}
+
+func (s *guardTestSuite) TestWriteTargets() {
+	queue := newTestQueue()
+	state := &RunState{Queues: []*WorkQueue{queue}}
+	s.Equal(map[string][]string{"/dev/vdb": {"randwrite"}, "/dev/vdc": {"randwrite"}}, writeTargets(state, nil))
+	s.Empty(writeTargets(state, &SLOSettings{RW: "randread"}))
+
+	state.Precondition = &client.PreconditionSettings{}
+	s.Equal([]string{"precondition", "randwrite"}, writeTargets(state, nil)["/dev/vdb"])
+
+	item := newJobFileItem(&client.JobSection{Name: "job", Options: []string{"filename=/dev/vdb:/dev/vdc", "rw=randrw"}})
+	state = &RunState{Queues: []*WorkQueue{{Queue: map[string][]*WorkItem{"job": {item}}}}}
+	s.Equal(map[string][]string{"/dev/vdb": {"randrw"}, "/dev/vdc": {"randrw"}}, writeTargets(state, nil))
+
+	// readwrite is the alias of rw
+	jobFile := filepath.Join(s.T().TempDir(), "job.fio")
+	s.NoError(os.WriteFile(jobFile, []byte("[job]\nfilename=/dev/vdb\nreadwrite=randwrite\n"), 0644))
+	f, err := client.ParseJobFile(jobFile)
+	s.Require().NoError(err)
+	item = newJobFileItem(f.Jobs[0])
+	state = &RunState{Queues: []*WorkQueue{{Queue: map[string][]*WorkItem{"job": {item}}}}}
+	s.Equal(map[string][]string{"/dev/vdb": {"randwrite"}}, writeTargets(state, nil))
+}
+
+func (s *guardTestSuite) TestCheckWriteTargets() {
+	defer mockBlockDevices("/dev/vdb", "/dev/vdc", "/dev/vdd")()
+	executor := mockDeviceExecutor()
+	targets := map[string][]string{
+		"/dev/vdb":     {"randwrite"},
+		"/dev/vdc":     {"write", "randwrite"},
+		"/dev/vdd":     {"randwrite"},
+		"/data/fio.db": {"randwrite"},
+	}
+	err := checkWriteTargets(executor, targets, nil)
+	s.Error(err)
+	s.Contains(err.Error(), "/dev/vdb (randwrite): mounted on /data, has children /dev/vdb1")
+	s.Contains(err.Error(), "/dev/vdc (write,randwrite): has xfs signature")
+	s.NotContains(err.Error(), "/dev/vdd")
+	s.NotContains(err.Error(), "fio.db")
+
+	err = checkWriteTargets(executor, targets, []*AllowDestroy{
+		{Device: "/dev/vdb", Serial: "serial-vdb"},
+		{Device: "/dev/vdc", Serial: "wrong"},
+	})
+	s.Error(err)
+	s.NotContains(err.Error(), "/dev/vdb")
+	s.Contains(err.Error(), `serial "serial-vdc" and wwn "0x5000c500a1b2c3d4" don't match allow_destroy`)
+
+	s.NoError(checkWriteTargets(executor, targets, []*AllowDestroy{
+		{Device: "/dev/vdb", Serial: "serial-vdb"},
+		{Device: "/dev/vdc", WWN: "0x5000c500a1b2c3d4"},
+	}))
+}
+
+func (s *guardTestSuite) TestPrepare() {
+	defer mockBlockDevices("/dev/vdb", "/dev/vdc")()
+	cfgFile := filepath.Join(s.T().TempDir(), "conf.yaml")
+	s.NoError(os.WriteFile(cfgFile, []byte(`
+fio_settings:
+  numjobs: [1]
+  bs: [4K]
+  iodepth: [1]
+  rw: [randread, randwrite]
+  runtime: 10
+  filename: [/dev/vdb, /dev/vdc]
+allow_destroy:
+- device: /dev/vdc
+  serial: serial-vdc
+`), 0644))
+	dir := filepath.Join(s.T().TempDir(), "run")
+	server, err := NewFioServer(WithChartFile(filepath.Join(s.T().TempDir(), "chart.html")), WithCfgFile(cfgFile), WithRunDir(dir))
+	s.NoError(err)
+	server.Executor = mockDeviceExecutor()
+	_, err = server.prepare()
+	s.Error(err)
+	s.Contains(err.Error(), "/dev/vdb (randwrite)")
+	_, err = OpenCheckpoint(dir)
+	s.Error(err, "run directory shouldn't be created if the check fails")
+
+	server, err = NewFioServer(WithChartFile(filepath.Join(s.T().TempDir(), "chart.html")), WithCfgFile(cfgFile), WithRunDir(dir), WithDryrun(true))
+	s.NoError(err)
+	server.Executor = mockDeviceExecutor()
+	state, err := server.prepare()
+	s.NoError(err)
+	s.Len(state.AllowDestroy, 1)
+
+	s.NoError(os.WriteFile(cfgFile, []byte(`
+fio_settings:
+  filename: [/dev/vdb]
+allow_destroy:
+- device: /dev/vdb
+`), 0644))
+	_, err = ParseSettings(cfgFile)
+	s.Error(err)
+}
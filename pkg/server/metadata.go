@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+
+	"k8s.io/klog/v2"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+	"github.com/microyahoo/fio-benchmark/pkg/util/exec"
+	"github.com/microyahoo/fio-benchmark/pkg/util/sys"
+)
+
+// MetadataJob attaches the snapshot of the device and the host to the results of the job.
+type MetadataJob struct {
+	Job
+	Device *client.Device
+	Host   *sys.HostInfo
+}
+
+// attach only writes the missing metadata, since the result may have been
+// handed out to the item handler.
+func (j *MetadataJob) attach(result *client.FioResult) {
+	if result.Device == nil && j.Device != nil {
+		result.Device = j.Device
+	}
+	if result.Host == nil && j.Host != nil {
+		result.Host = j.Host
+	}
+}
+
+func (j *MetadataJob) Do(ctx context.Context, executor exec.Executor, dryrun bool, handler ItemHandler) ([]*client.FioResult, error) {
+	results, err := j.Job.Do(ctx, executor, dryrun, func(item *WorkItem, result *client.FioResult) {
+		if result != nil {
+			j.attach(result)
+		}
+		if handler != nil {
+			handler(item, result)
+		}
+	})
+	for _, result := range results {
+		j.attach(result)
+	}
+	return results, err
+}
+
+// deviceMetadata returns the snapshot of the block device, which is nil if the
+// filename is not a block device, eg. a regular file.
+func deviceMetadata(executor exec.Executor, filename string) (*client.Device, error) {
+	if !isBlockDevice(filename) {
+		return nil, nil
+	}
+	props, err := sys.GetDevicePropertiesFromPath(executor, filename)
+	if err != nil {
+		return nil, err
+	}
+	device, err := sys.PopulateDeviceInfo([]map[string]string{props})
+	if err != nil {
+		return nil, err
+	}
+	if device, err = sys.PopulateDeviceUdevInfo(executor, filename, device); err != nil {
+		klog.Warningf("Failed to get udev info of %s: %v", filename, err)
+	}
+	queue, err := sys.GetQueueInfo(filename)
+	if err != nil {
+		klog.Warningf("Failed to get queue settings of %s: %v", filename, err)
+	}
+	return client.NewDevice(device, queue), nil
+}
+
+// collectMetadata collects the host facts and the snapshots of the devices of
+// the queues before they are run, the work items run by the fio servers of the
+// hosts are skipped since they aren't run locally.
+func (s *FioServer) collectMetadata(state *RunState) {
+	s.devices = make(map[string]*client.Device)
+	var local bool
+	for _, queue := range state.Queues {
+		for _, items := range queue.Queue {
+			for _, item := range items {
+				if len(item.Hosts) > 0 {
+					continue
+				}
+				local = true
+				filename := item.FileName
+				if _, ok := s.devices[filename]; ok {
+					continue
+				}
+				device, err := deviceMetadata(s.Executor, filename)
+				if err != nil {
+					klog.Warningf("Failed to get device info of %s: %v", filename, err)
+				}
+				s.devices[filename] = device
+			}
+		}
+	}
+	if !local {
+		return
+	}
+	host, err := sys.GetHostInfo()
+	if err != nil {
+		klog.Warningf("Failed to get host info: %v", err)
+	}
+	s.host = host
+}
+
+// withMetadata wraps the job of the device to attach the device and host
+// metadata to its results.
+func (s *FioServer) withMetadata(job Job, filename string) Job {
+	if s.host == nil && s.devices[filename] == nil {
+		return job
+	}
+	return &MetadataJob{Job: job, Device: s.devices[filename], Host: s.host}
+}
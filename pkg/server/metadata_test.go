@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	exectest "github.com/microyahoo/fio-benchmark/pkg/util/exec/test"
+	"github.com/microyahoo/fio-benchmark/pkg/util/sys"
+)
+
+func TestMetadataSuite(t *testing.T) {
+	suite.Run(t, new(metadataTestSuite))
+}
+
+type metadataTestSuite struct {
+	suite.Suite
+}
+
+func (s *metadataTestSuite) TestRun() {
+	defer mockBlockDevices("/dev/vdb")()
+	sysfs := s.T().TempDir()
+	defer func(old string) { sys.SysClassBlock = old }(sys.SysClassBlock)
+	sys.SysClassBlock = sysfs
+	s.NoError(os.MkdirAll(filepath.Join(sysfs, "vdb", "queue"), 0755))
+	s.NoError(os.WriteFile(filepath.Join(sysfs, "vdb", "queue", "scheduler"), []byte("[none] mq-deadline\n"), 0644))
+
+	cfgFile := filepath.Join(s.T().TempDir(), "conf.yaml")
+	dataFile := filepath.Join(s.T().TempDir(), "fio.db")
+	s.NoError(os.WriteFile(cfgFile, []byte(fmt.Sprintf(`
+fio_settings:
+  numjobs: [1]
+  bs: [4K]
+  iodepth: [1]
+  rw: [randread]
+  runtime: 10
+  filename: [/dev/vdb, %s]
+workers: 2
+`, dataFile)), 0644))
+	dir := filepath.Join(s.T().TempDir(), "run")
+	server, err := NewFioServer(WithChartFile(filepath.Join(s.T().TempDir(), "chart.html")), WithCfgFile(cfgFile),
+		WithRunDir(dir), WithOutputFile(filepath.Join(dir, "output.txt")), WithShowMetadata(true))
+	s.NoError(err)
+	server.Executor = &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(command string, args ...string) (string, error) {
+			switch command {
+			case "lsblk":
+				return `SIZE="53687091200" ROTA="0" RO="0" TYPE="disk" PKNAME="" NAME="/dev/vdb" KNAME="/dev/vdb" UUID=""`, nil
+			case "udevadm":
+				return "ID_MODEL=QEMU HARDDISK\nID_SERIAL=serial-vdb\nID_REVISION=2.5+\nID_BUS=ata", nil
+			}
+			return "fio-3.27", nil
+		},
+		MockExecuteCommandWithContext: func(ctx context.Context, command string, args ...string) (string, error) {
+			return fmt.Sprintf(`{"jobs": [{"jobname": "test", "job options": {"filename": %q, "rw": "randread"},
+				"read": {}, "write": {}, "trim": {}}]}`, fioArg(args, "--filename")), nil
+		},
+	}
+	s.NoError(server.Run(make(chan struct{})))
+	s.Len(server.results, 2)
+	for _, result := range server.results {
+		s.NotNil(result.Host)
+		if result.Jobs[0].JobOptions.FileName != "/dev/vdb" {
+			s.Nil(result.Device)
+			continue
+		}
+		s.Equal("QEMU HARDDISK", result.Device.Model)
+		s.Equal("2.5+", result.Device.Firmware)
+		s.Equal("ata", result.Device.Bus)
+		s.EqualValues(53687091200, result.Device.Size)
+		s.Equal("none", result.Device.Queue.Scheduler)
+	}
+
+	c, err := OpenCheckpoint(dir)
+	s.NoError(err)
+	saved, err := c.LoadResults()
+	s.NoError(err)
+	for _, result := range saved {
+		s.NotNil(result.Host)
+		s.Equal(result.Jobs[0].JobOptions.FileName == "/dev/vdb", result.Device != nil)
+	}
+	output, err := os.ReadFile(filepath.Join(dir, "output.txt"))
+	s.NoError(err)
+	s.Contains(string(output), "QEMU HARDDISK")
+
+	jsonFile := filepath.Join(dir, "output.json")
+	server.printResults(jsonFile, "json", nil)
+	data, err := os.ReadFile(jsonFile)
+	s.NoError(err)
+	var out Output
+	s.NoError(json.Unmarshal(data, &out))
+	s.Len(out.Results, 2)
+	for _, result := range out.Results {
+		s.Equal(result.Jobs[0].JobOptions.FileName == "/dev/vdb", result.Device != nil)
+	}
+}
@@ -0,0 +1,295 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"k8s.io/klog/v2"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+)
+
+const (
+	metricsPrefix = "fio_benchmark_"
+
+	// metricsContentType is the content type of the Prometheus text exposition format.
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// itemObserver is notified once a work item starts and stops running, the err
+// is nil if the work item succeeded or the run is interrupted.
+type itemObserver interface {
+	itemStarted(item *WorkItem)
+	itemStopped(item *WorkItem, err error)
+}
+
+type itemObserverKey struct{}
+
+// withItemObserver returns the context carrying the observer of the work items
+// which are run with it.
+func withItemObserver(ctx context.Context, observer itemObserver) context.Context {
+	return context.WithValue(ctx, itemObserverKey{}, observer)
+}
+
+func itemObserverFrom(ctx context.Context) itemObserver {
+	observer, _ := ctx.Value(itemObserverKey{}).(itemObserver)
+	return observer
+}
+
+// exportedItem is the progress of a work item tracked by the exporter.
+type exportedItem struct {
+	item    string
+	device  string
+	running bool
+	done    bool // finished or skipped
+	failed  bool
+}
+
+// Exporter publishes the results and the progress of the run as Prometheus
+// gauges in the text exposition format, which can be scraped from /metrics
+// during the run or written into a .prom file of the textfile collector.
+type Exporter struct {
+	lock    sync.Mutex
+	items   map[string]*exportedItem // keyed by the id of the work item
+	results []*client.FioResult
+}
+
+// NewExporter returns an exporter without any work item.
+func NewExporter() *Exporter {
+	return &Exporter{items: make(map[string]*exportedItem)}
+}
+
+// prepared resets the progress with the work items of the run.
+func (e *Exporter) prepared(items []*WorkItem) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.items = make(map[string]*exportedItem, len(items))
+	for _, item := range items {
+		e.items[item.ID] = &exportedItem{item: item.String(), device: item.FileName}
+	}
+}
+
+func (e *Exporter) itemStarted(item *WorkItem) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if exported, ok := e.items[item.ID]; ok {
+		exported.running = true
+	}
+}
+
+func (e *Exporter) itemStopped(item *WorkItem, err error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if exported, ok := e.items[item.ID]; ok {
+		exported.running = false
+		exported.failed = exported.failed || err != nil
+	}
+}
+
+// itemFinished records the result of the finished work item, the work item is
+// skipped if the result is nil.
+func (e *Exporter) itemFinished(item *WorkItem, result *client.FioResult) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if exported, ok := e.items[item.ID]; ok {
+		exported.done = true
+	}
+	if result != nil {
+		e.results = append(e.results, result)
+	}
+}
+
+// ServeHTTP serves the metrics in the text exposition format.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metricsContentType)
+	if err := e.Write(w); err != nil {
+		klog.Warningf("Failed to write the metrics: %v", err)
+	}
+}
+
+// WriteFile writes the metrics into the file atomically so that the textfile
+// collector never reads a partial file.
+func (e *Exporter) WriteFile(path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err = e.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Write writes the metrics in the text exposition format.
+func (e *Exporter) Write(w io.Writer) error {
+	e.lock.Lock()
+	families := e.families()
+	e.lock.Unlock()
+	for _, f := range families {
+		if err := f.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// families returns the metric families of the progress and the results, the
+// lock must be held.
+func (e *Exporter) families() []*metricFamily {
+	var done, failed int
+	current := &metricFamily{name: "current_item", help: "Work items which are running, the value is always 1."}
+	ids := make([]string, 0, len(e.items))
+	for id := range e.items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		item := e.items[id]
+		switch {
+		case item.done:
+			done++
+		case item.failed:
+			failed++
+		}
+		if item.running {
+			current.add(1, "id", id, "item", item.item, "device", item.device)
+		}
+	}
+	families := []*metricFamily{
+		{name: "work_items", help: "Number of the work items of the run.", samples: []*metricSample{{value: float64(len(e.items))}}},
+		{name: "work_items_done", help: "Number of the work items which are finished or skipped.", samples: []*metricSample{{value: float64(done)}}},
+		{name: "work_items_failed", help: "Number of the work items which failed.", samples: []*metricSample{{value: float64(failed)}}},
+		current,
+	}
+	return append(families, resultFamilies(e.results)...)
+}
+
+// resultFamilies returns the metric families of the results, one sample for
+// each direction of the jobs which has IOPS. The cluster-wide jobs are exported
+// for the distributed results, and the later results win if the labels are the
+// same, eg. the repeated trials.
+func resultFamilies(results []*client.FioResult) []*metricFamily {
+	iops := &metricFamily{name: "iops", help: "Mean IOPS of the job."}
+	bw := &metricFamily{name: "bandwidth_bytes", help: "Mean bandwidth of the job in bytes per second."}
+	lat := &metricFamily{name: "latency_mean_seconds", help: "Mean total latency of the job."}
+	clat := &metricFamily{name: "latency_percentile_seconds", help: "Completion latency percentiles of the job."}
+	for _, result := range results {
+		var model string
+		if result.Device != nil {
+			model = result.Device.Model
+		}
+		for _, job := range result.SummaryJobs() {
+			o := job.JobOptions
+			if o == nil {
+				o = &client.JobOptions{}
+			}
+			directions := []struct {
+				name   string
+				result *client.IOResult
+			}{
+				{"read", job.ReadResult},
+				{"write", job.WriteResult},
+				{"trim", job.TrimResult},
+			}
+			for _, d := range directions {
+				r := d.result
+				if r == nil || r.IOPSMean == 0 {
+					continue
+				}
+				labels := []string{"job", jobLabel(job.JobName), "device", o.FileName, "model", model, "rw", o.RW,
+					"bs", o.BlockSize, "iodepth", o.IODepth, "numjobs", o.NumJobs, "tuning", strings.Join(result.Tuning, ","),
+					"label", result.Label, "direction", d.name}
+				iops.add(r.IOPSMean, labels...)
+				bw.add(r.BWMean*1024, labels...)
+				lat.add(r.LatencyNs.Mean/1e9, labels...)
+				for key, value := range r.ClatNs.Percentile {
+					p, err := strconv.ParseFloat(key, 64)
+					if err != nil {
+						continue
+					}
+					clat.add(value/1e9, append(labels, "percentile", strconv.FormatFloat(p, 'f', -1, 64))...)
+				}
+			}
+		}
+	}
+	return []*metricFamily{iops, bw, lat, clat}
+}
+
+// jobUUIDRegexp matches the uuid suffix of the job names of the generated work
+// items, eg. randread-<uuid>.
+var jobUUIDRegexp = regexp.MustCompile(`-[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// jobLabel returns the job name without the uuid suffix, so that the label is
+// the section name of the job file and the rw of the generated work items.
+func jobLabel(name string) string {
+	return jobUUIDRegexp.ReplaceAllString(name, "")
+}
+
+// metricFamily is a gauge with its samples.
+type metricFamily struct {
+	name    string // without the prefix
+	help    string
+	samples []*metricSample
+	index   map[string]*metricSample // keyed by the formatted labels
+}
+
+type metricSample struct {
+	labels string // formatted labels, eg. {rw="randread"}
+	value  float64
+}
+
+// add adds the sample with the label pairs, eg. "rw", "randread", the sample
+// with the same labels is replaced.
+func (f *metricFamily) add(value float64, labels ...string) {
+	var pairs []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], labelValueEscaper.Replace(labels[i+1])))
+	}
+	formatted := ""
+	if len(pairs) > 0 {
+		formatted = "{" + strings.Join(pairs, ",") + "}"
+	}
+	if s, ok := f.index[formatted]; ok {
+		s.value = value
+		return
+	}
+	if f.index == nil {
+		f.index = make(map[string]*metricSample)
+	}
+	sample := &metricSample{labels: formatted, value: value}
+	f.index[formatted] = sample
+	f.samples = append(f.samples, sample)
+}
+
+func (f *metricFamily) write(w io.Writer) error {
+	name := metricsPrefix + f.name
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, f.help, name); err != nil {
+		return err
+	}
+	sort.SliceStable(f.samples, func(i, j int) bool {
+		return f.samples[i].labels < f.samples[j].labels
+	})
+	for _, s := range f.samples {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", name, s.labels, strconv.FormatFloat(s.value, 'g', -1, 64)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// labelValueEscaper escapes the backslash, double-quote and line feed of the
+// label values.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+	exectest "github.com/microyahoo/fio-benchmark/pkg/util/exec/test"
+)
+
+func TestMetricsSuite(t *testing.T) {
+	suite.Run(t, new(metricsTestSuite))
+}
+
+type metricsTestSuite struct {
+	suite.Suite
+}
+
+func (s *metricsTestSuite) TestRun() {
+	dataFile := filepath.Join(s.T().TempDir(), "fio.db")
+	cfgFile := filepath.Join(s.T().TempDir(), "conf.yaml")
+	s.NoError(os.WriteFile(cfgFile, []byte(fmt.Sprintf(`
+fio_settings:
+  numjobs: [1]
+  bs: [4K]
+  iodepth: [1, 8]
+  rw: [randread]
+  runtime: 10
+  filename: [%s]
+`, dataFile)), 0644))
+	exporter := NewExporter()
+	server, err := NewFioServer(WithCfgFile(cfgFile), WithExporter(exporter),
+		WithChartFile(filepath.Join(s.T().TempDir(), "chart.html")), WithOutputFile(filepath.Join(s.T().TempDir(), "output.txt")))
+	s.Require().NoError(err)
+	server.Executor = &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(command string, args ...string) (string, error) {
+			return "fio-3.27", nil
+		},
+		MockExecuteCommandWithContext: func(ctx context.Context, command string, args ...string) (string, error) {
+			if fioArg(args, "--iodepth") == "8" {
+				return "", errors.New("fio failed")
+			}
+			return fmt.Sprintf(`{"jobs": [{"jobname": "randread", "job options": {"filename": %q, "rw": "randread", "bs": "4K", "iodepth": "1", "numjobs": "1"},
+				"read": {"iops_mean": 100, "bw_mean": 400, "lat_ns": {"mean": 2000}, "clat_ns": {"percentile": {"99.000000": 5000}}},
+				"write": {}, "trim": {}}]}`, dataFile), nil
+		},
+	}
+	s.NoError(server.Run(make(chan struct{})))
+
+	metricsFile := filepath.Join(s.T().TempDir(), "fio_benchmark.prom")
+	s.NoError(exporter.WriteFile(metricsFile))
+	data, err := os.ReadFile(metricsFile)
+	s.NoError(err)
+	metrics := string(data)
+	labels := fmt.Sprintf(`job="randread",device="%s",model="",rw="randread",bs="4K",iodepth="1",numjobs="1",tuning="",label="",direction="read"`, dataFile)
+	for _, line := range []string{
+		"# TYPE fio_benchmark_iops gauge",
+		"fio_benchmark_work_items 2",
+		"fio_benchmark_work_items_done 1",
+		"fio_benchmark_work_items_failed 1",
+		"fio_benchmark_iops{" + labels + "} 100",
+		"fio_benchmark_bandwidth_bytes{" + labels + "} 409600",
+		"fio_benchmark_latency_mean_seconds{" + labels + "} 2e-06",
+		"fio_benchmark_latency_percentile_seconds{" + labels + `,percentile="99"} 5e-06`,
+	} {
+		s.Contains(metrics, line+"\n")
+	}
+	s.NotContains(metrics, "fio_benchmark_current_item{")
+	s.NotContains(metrics, `direction="write"`)
+}
+
+func (s *metricsTestSuite) TestResultLabels() {
+	result := func(name string, tuning []string, iops float64) *client.FioResult {
+		return &client.FioResult{
+			Tuning: tuning,
+			Jobs: []*client.FioJob{{
+				JobName:    name,
+				JobOptions: &client.JobOptions{FileName: "/dev/sdb", RW: "randread", BlockSize: "4K", IODepth: "1", NumJobs: "1"},
+				ReadResult: &client.ReadResult{IOPSMean: iops},
+			}},
+		}
+	}
+	families := resultFamilies([]*client.FioResult{
+		result("randread-"+uuid.NewString(), []string{"scheduler=none"}, 100),
+		result("randread-"+uuid.NewString(), []string{"scheduler=mq-deadline", "nr_requests=64"}, 200),
+		result("randread-"+uuid.NewString(), []string{"scheduler=none"}, 300), // the repeated trial
+		result("section", nil, 400),
+	})
+	var b strings.Builder
+	s.NoError(families[0].write(&b))
+	labels := `device="/dev/sdb",model="",rw="randread",bs="4K",iodepth="1",numjobs="1"`
+	for _, line := range []string{
+		`fio_benchmark_iops{job="randread",` + labels + `,tuning="scheduler=none",label="",direction="read"} 300`,
+		`fio_benchmark_iops{job="randread",` + labels + `,tuning="scheduler=mq-deadline,nr_requests=64",label="",direction="read"} 200`,
+		`fio_benchmark_iops{job="section",` + labels + `,tuning="",label="",direction="read"} 400`,
+	} {
+		s.Contains(b.String(), line+"\n")
+	}
+	s.Len(families[0].samples, 3)
+}
+
+func (s *metricsTestSuite) TestProgress() {
+	item := &WorkItem{ID: "1", FileName: "/dev/sdb", RW: "randread", BlockSize: "4K", IODepth: 1, NumJobs: 1}
+	exporter := NewExporter()
+	exporter.prepared([]*WorkItem{item, {ID: "2", FileName: "/dev/sdc"}})
+	ctx := withItemObserver(context.Background(), exporter)
+
+	var running string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithContext: func(ctx context.Context, command string, args ...string) (string, error) {
+			recorder := httptest.NewRecorder()
+			exporter.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+			s.Equal(metricsContentType, recorder.Header().Get("Content-Type"))
+			data, _ := io.ReadAll(recorder.Body)
+			running = string(data)
+			return "", errors.New("fio failed")
+		},
+	}
+	_, err := item.Run(ctx, executor, false)
+	s.Error(err)
+	s.Contains(running, `fio_benchmark_current_item{id="1",item="sdb-randread-4K-1-1",device="/dev/sdb"} 1`+"\n")
+
+	var b strings.Builder
+	s.NoError(exporter.Write(&b))
+	s.NotContains(b.String(), "fio_benchmark_current_item{")
+	s.Contains(b.String(), "fio_benchmark_work_items_failed 1\n")
+
+	// the interrupted work item isn't failed
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = (&WorkItem{ID: "2", FileName: "/dev/sdc"}).Run(canceled, &exectest.MockExecutor{
+		MockExecuteCommandWithContext: func(ctx context.Context, command string, args ...string) (string, error) {
+			return "", ctx.Err()
+		},
+	}, false)
+	s.Error(err)
+	b.Reset()
+	s.NoError(exporter.Write(&b))
+	s.Contains(b.String(), "fio_benchmark_work_items_failed 1\n")
+
+	f := &metricFamily{name: "test"}
+	f.add(1, "name", "a\"b\\c\nd")
+	f.add(2, "name", "a\"b\\c\nd")
+	b.Reset()
+	s.NoError(f.write(&b))
+	s.Contains(b.String(), `fio_benchmark_test{name="a\"b\\c\nd"} 2`+"\n")
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"sort"
+	"time"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+)
+
+const (
+	// DefaultItemOverhead is the estimated overhead of each work item besides
+	// its runtime, which is spent on dropping caches, starting and stopping fio.
+	DefaultItemOverhead = 5 * time.Second
+)
+
+// Duration is a time.Duration which is marshaled in human readable format.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + d.String() + `"`), nil
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+// DevicePlan is the work items of a device which are run one by one.
+type DevicePlan struct {
+	Stage    int         `json:"stage" yaml:"stage"`
+	Device   string      `json:"device" yaml:"device"`
+	Items    []*WorkItem `json:"items" yaml:"items"`
+	Duration Duration    `json:"duration" yaml:"duration"`
+}
+
+// Plan is the expanded work items of a run and its estimated wall-clock time.
+type Plan struct {
+	Devices      []*DevicePlan `json:"devices" yaml:"devices"`
+	Stages       int           `json:"stages" yaml:"stages"`
+	TotalItems   int           `json:"total_items" yaml:"total_items"`
+	Workers      int           `json:"workers" yaml:"workers"`
+	ItemOverhead Duration      `json:"item_overhead" yaml:"item_overhead"`
+	Estimate     Duration      `json:"estimate" yaml:"estimate"`
+}
+
+// NewPlan expands the work queues of the run state and estimates the wall-clock
+// time in the same way as the work items are dispatched to the workers.
+func NewPlan(state *RunState, itemOverhead time.Duration) *Plan {
+	assignItemIDs(state.Queues)
+	plan := &Plan{
+		Stages:       len(state.Queues),
+		ItemOverhead: Duration(itemOverhead),
+	}
+	var estimate time.Duration
+	for stage, queue := range state.Queues {
+		workers := effectiveWorkers(int(state.Workers), len(queue.Queue))
+		if workers > plan.Workers {
+			plan.Workers = workers
+		}
+		var durations []time.Duration
+		for _, key := range queue.Keys() {
+			items := queue.Queue[key]
+			var d time.Duration
+			for _, item := range items {
+				d += itemDuration(item) + itemOverhead
+			}
+			device := key
+			if items[0].Job != nil && items[0].FileName != "" {
+				// the key of job file queue is the job name
+				device = items[0].FileName
+			}
+			plan.Devices = append(plan.Devices, &DevicePlan{
+				Stage:    stage,
+				Device:   device,
+				Items:    items,
+				Duration: Duration(d),
+			})
+			plan.TotalItems += len(items)
+			durations = append(durations, d)
+		}
+		estimate += makespan(durations, workers)
+	}
+	plan.Estimate = Duration(estimate)
+	return plan
+}
+
+// effectiveWorkers returns the number of workers which runQueue uses.
+func effectiveWorkers(workers, devices int) int {
+	if workers <= 0 || workers > devices {
+		workers = devices
+	}
+	if workers > WorkersLimit {
+		workers = WorkersLimit
+	}
+	return workers
+}
+
+func itemDuration(item *WorkItem) time.Duration {
+	d := time.Duration(item.Runtime) * time.Second
+	if item.Job != nil {
+		if v, ok := item.Job.Option("ramp_time"); ok {
+			ramp, _ := client.ParseFioDuration(v)
+			d += ramp
+		}
+	}
+	return d
+}
+
+// makespan assigns the durations in order to the earliest free worker and
+// returns the time when all of them are finished.
+func makespan(durations []time.Duration, workers int) time.Duration {
+	if workers <= 0 {
+		return 0
+	}
+	free := make([]time.Duration, workers)
+	for _, d := range durations {
+		sort.Slice(free, func(i, j int) bool { return free[i] < free[j] })
+		free[0] += d
+	}
+	var max time.Duration
+	for _, f := range free {
+		if f > max {
+			max = f
+		}
+	}
+	return max
+}
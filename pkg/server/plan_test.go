@@ -0,0 +1,39 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestPlanSuite(t *testing.T) {
+	suite.Run(t, new(planTestSuite))
+}
+
+type planTestSuite struct {
+	suite.Suite
+}
+
+func (s *planTestSuite) TestNewPlan() {
+	queue := newTestQueue()
+	plan := NewPlan(&RunState{Workers: 1, Queues: []*WorkQueue{queue}}, 5*time.Second)
+	s.Equal(8, plan.TotalItems)
+	s.Equal(1, plan.Workers)
+	s.Len(plan.Devices, 2)
+	s.Equal("/dev/vdb", plan.Devices[0].Device)
+	s.Equal(Duration(4*15*time.Second), plan.Devices[0].Duration)
+	s.Equal(Duration(8*15*time.Second), plan.Estimate)
+
+	plan = NewPlan(&RunState{Workers: 64, Queues: []*WorkQueue{queue}}, 5*time.Second)
+	s.Equal(2, plan.Workers)
+	s.Equal(Duration(4*15*time.Second), plan.Estimate)
+}
+
+func (s *planTestSuite) TestMakespan() {
+	durations := []time.Duration{3 * time.Minute, time.Minute, time.Minute, time.Minute, 2 * time.Minute}
+	s.Equal(8*time.Minute, makespan(durations, 1))
+	s.Equal(5*time.Minute, makespan(durations, 2)) // dispatched in order, not optimal
+	s.Equal(3*time.Minute, makespan(durations, 3))
+	s.Equal(time.Duration(0), makespan(nil, 0))
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+	"github.com/microyahoo/fio-benchmark/pkg/util/exec"
+	"github.com/microyahoo/fio-benchmark/pkg/util/sys"
+)
+
+// PreconditionedJob preconditions the device before the job is run if the
+// device is non-rotational, and records the preconditioning in the results.
+type PreconditionedJob struct {
+	Job
+	FileName string
+	Settings *client.PreconditionSettings
+
+	// Precondition is the finished preconditioning of the device, which is
+	// not run again, eg. the run is resumed.
+	Precondition *client.Precondition
+	// finished is called once the device is preconditioned
+	finished func(filename string, p *client.Precondition)
+}
+
+func (j *PreconditionedJob) Do(ctx context.Context, executor exec.Executor, dryrun bool, handler ItemHandler) ([]*client.FioResult, error) {
+	p := j.Precondition
+	if p == nil {
+		rotational, err := isRotational(executor, j.FileName)
+		if err != nil {
+			klog.Warningf("Skip preconditioning %s: %v", j.FileName, err)
+		} else if rotational {
+			klog.Infof("Skip preconditioning %s since it's rotational", j.FileName)
+		} else {
+			klog.Infof("Preconditioning %s", j.FileName)
+			p, err = client.RunPrecondition(ctx, executor, j.FileName, j.Settings, dryrun)
+			if err != nil {
+				klog.Warningf("Skip the work items of %s since preconditioning failed: %v", j.FileName, err)
+				return nil, err
+			}
+			if p != nil {
+				klog.Infof("%s is preconditioned in %s", j.FileName, p)
+				if j.finished != nil {
+					j.finished(j.FileName, p)
+				}
+			}
+		}
+	}
+	if p == nil {
+		return j.Job.Do(ctx, executor, dryrun, handler)
+	}
+	results, err := j.Job.Do(ctx, executor, dryrun, func(item *WorkItem, result *client.FioResult) {
+		if result != nil {
+			result.Precondition = p
+		}
+		if handler != nil {
+			handler(item, result)
+		}
+	})
+	for _, result := range results {
+		result.Precondition = p
+	}
+	return results, err
+}
+
+// isRotational returns whether the block device is rotational according to lsblk.
+func isRotational(executor exec.Executor, filename string) (bool, error) {
+	props, err := sys.GetDevicePropertiesFromPath(executor, filename)
+	if err != nil {
+		return false, err
+	}
+	rota, ok := props["ROTA"]
+	if !ok {
+		return false, errors.Errorf("%s is not a block device", filename)
+	}
+	return rota == "1", nil
+}
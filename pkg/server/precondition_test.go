@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+	exectest "github.com/microyahoo/fio-benchmark/pkg/util/exec/test"
+)
+
+func TestPreconditionSuite(t *testing.T) {
+	suite.Run(t, new(preconditionTestSuite))
+}
+
+type preconditionTestSuite struct {
+	suite.Suite
+}
+
+// mockPreconditionExecutor mocks /dev/vdb as ssd and /dev/vdc as hdd, and
+// records the rw of the fio runs of each device.
+func mockPreconditionExecutor(runs map[string][]string) *exectest.MockExecutor {
+	var lock sync.Mutex
+	return &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(command string, args ...string) (string, error) {
+			if command != "lsblk" {
+				return "fio-3.27", nil
+			}
+			rota := "0"
+			if args[0] == "/dev/vdc" {
+				rota = "1"
+			}
+			return fmt.Sprintf(`SIZE="53687091200" ROTA="%s" RO="0" TYPE="disk" PKNAME="" NAME="%s" KNAME="%s" UUID=""`, rota, args[0], args[0]), nil
+		},
+		MockExecuteCommandWithContext: func(ctx context.Context, command string, args ...string) (string, error) {
+			filename := fioArg(args, "--filename")
+			lock.Lock()
+			runs[filename] = append(runs[filename], fioArg(args, "--rw"))
+			lock.Unlock()
+			if fioArg(args, "--steadystate") != "" {
+				return `{"jobs": [{"jobname": "precondition", "steadystate": {"ss": "iops_slope", "attained": 1}}]}`, nil
+			}
+			return fmt.Sprintf(`{"jobs": [{"jobname": "test", "job options": {"filename": %q, "rw": %q},
+				"read": {}, "write": {}, "trim": {}}]}`, filename, fioArg(args, "--rw")), nil
+		},
+	}
+}
+
+func (s *preconditionTestSuite) TestComplete() {
+	settings := &client.PreconditionSettings{}
+	s.NoError(settings.Complete())
+	s.Equal("128K", settings.FillBlockSize)
+	s.Equal("iops_slope:10%", settings.SteadyState)
+	s.EqualValues(7200, settings.MaxRuntime)
+
+	s.Error((&client.PreconditionSettings{SteadyState: "lat:10%"}).Complete())
+	s.Error((&client.PreconditionSettings{SteadyStateDuration: 600, MaxRuntime: 300}).Complete())
+}
+
+func (s *preconditionTestSuite) TestRunAndResume() {
+	defer mockBlockDevices()()
+	cfgFile := filepath.Join(s.T().TempDir(), "conf.yaml")
+	s.NoError(os.WriteFile(cfgFile, []byte(`
+fio_settings:
+  numjobs: [1]
+  bs: [4K]
+  iodepth: [1]
+  rw: [randread, randwrite]
+  runtime: 10
+  filename: [/dev/vdb, /dev/vdc]
+precondition:
+  ss_duration: 60
+  max_runtime: 600
+workers: 2
+`), 0644))
+	dir := filepath.Join(s.T().TempDir(), "run")
+	runs := make(map[string][]string)
+	server, err := NewFioServer(WithChartFile(filepath.Join(s.T().TempDir(), "chart.html")), WithCfgFile(cfgFile), WithRunDir(dir), WithOutputFile(filepath.Join(dir, "output.txt")))
+	s.NoError(err)
+	server.Executor = mockPreconditionExecutor(runs)
+	s.NoError(server.Run(make(chan struct{})))
+	s.Equal([]string{"write", "randwrite", "randread", "randwrite"}, runs["/dev/vdb"])
+	s.Equal([]string{"randread", "randwrite"}, runs["/dev/vdc"])
+
+	s.Len(server.results, 4)
+	for _, result := range server.results {
+		if result.Jobs[0].JobOptions.FileName == "/dev/vdb" {
+			s.NotNil(result.Precondition)
+			s.True(result.Precondition.Attained)
+			s.Equal("iops_slope:10%", result.Precondition.Settings.SteadyState)
+		} else {
+			s.Nil(result.Precondition)
+		}
+	}
+	c, err := OpenCheckpoint(dir)
+	s.NoError(err)
+	saved, err := c.LoadResults()
+	s.NoError(err)
+	for id, result := range saved {
+		s.Equal(id[4:7] == "vdb", result.Precondition != nil, id)
+	}
+
+	// the preconditioning isn't run again on resume
+	s.NoError(os.Remove(filepath.Join(dir, resultsDir, "001-vdb-randwrite-4K-1-1.json")))
+	runs = make(map[string][]string)
+	server, err = NewFioServer(WithChartFile(filepath.Join(s.T().TempDir(), "chart.html")), WithRunDir(dir), WithResume(true), WithOutputFile(filepath.Join(dir, "output.txt")))
+	s.NoError(err)
+	server.Executor = mockPreconditionExecutor(runs)
+	s.NoError(server.Run(make(chan struct{})))
+	s.Len(runs["/dev/vdb"], 1)
+	s.Empty(runs["/dev/vdc"])
+	for _, result := range server.results {
+		s.Equal(result.Jobs[0].JobOptions.FileName == "/dev/vdb", result.Precondition != nil)
+	}
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+	"github.com/microyahoo/fio-benchmark/pkg/util/exec"
+)
+
+const (
+	defaultSaturationMinGain = 5
+	defaultSaturationSteps   = 2
+	saturationLatencyMean    = "mean"
+)
+
+// SaturationSettings is the knee detection policy, the remaining higher concurrency
+// work items of a device, rw and bs are skipped once the throughput gain is below
+// min_gain for steps consecutive steps while the latency keeps growing.
+type SaturationSettings struct {
+	MinGain float64 `json:"min_gain" yaml:"min_gain"` // percent, 5 by default
+	Steps   int     `json:"steps" yaml:"steps"`       // 2 by default
+	Latency string  `json:"latency" yaml:"latency"`   // mean or completion latency percentile such as p99, mean by default
+}
+
+// complete fills the defaults of the saturation settings and validates them.
+func (s *SaturationSettings) complete() error {
+	if s.MinGain == 0 {
+		s.MinGain = defaultSaturationMinGain
+	}
+	if s.MinGain < 0 {
+		return errors.Errorf("invalid saturation min_gain %v, which should be positive", s.MinGain)
+	}
+	if s.Steps <= 0 {
+		s.Steps = defaultSaturationSteps
+	}
+	if s.Latency == "" {
+		s.Latency = saturationLatencyMean
+	}
+	if p, ok := s.percentile(); ok {
+		return ValidatePercentiles([]float64{p})
+	} else if s.Latency != saturationLatencyMean {
+		return errors.Errorf("invalid saturation latency %s, which should be mean or percentile such as p99", s.Latency)
+	}
+	return nil
+}
+
+// percentile returns the completion latency percentile of the latency metric.
+func (s *SaturationSettings) percentile() (float64, bool) {
+	if !strings.HasPrefix(s.Latency, "p") {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(strings.TrimPrefix(s.Latency, "p"), 64)
+	return p, err == nil
+}
+
+// SaturationItems are the work items of a device which are run in ascending
+// order of concurrency for each rw and bs, the higher concurrency items are
+// skipped once the knee is detected.
+type SaturationItems struct {
+	Items      WorkItems
+	Saturation *SaturationSettings
+
+	// Finished are the results of the items which were finished before the run
+	// was resumed keyed by the item id, they aren't run again but seed the knee
+	// detection
+	Finished map[string]*client.FioResult
+
+	// Knee is called once the knee of a series is detected, the knee flag of
+	// the result which was already handled is set, eg. to save it into the checkpoint
+	Knee func(item *WorkItem, result *client.FioResult)
+}
+
+func (si *SaturationItems) Do(ctx context.Context, executor exec.Executor, dryrun bool, handler ItemHandler) ([]*client.FioResult, error) {
+	var results []*client.FioResult
+	for _, series := range saturationSeries(si.Items) {
+		if si.finished(series) {
+			continue
+		}
+		detector := &kneeDetector{settings: si.Saturation}
+		for i, wi := range series {
+			result, ok := si.Finished[wi.ID]
+			if !ok {
+				if ctx.Err() != nil {
+					klog.Infof("Skip the remaining work items of %s since benchmark is canceled", wi.FileName)
+					return results, ctx.Err()
+				}
+				var err error
+				result, err = wi.Run(ctx, executor, dryrun)
+				if err != nil {
+					klog.Warningf("Failed to do fio test: %v", err)
+					continue
+				}
+				if result == nil {
+					continue
+				}
+				results = append(results, result)
+				if handler != nil {
+					handler(wi, result)
+				}
+			}
+			knee := detector.add(wi, result)
+			if knee == nil {
+				continue
+			}
+			if !knee.result.Knee {
+				knee.result.Knee = true
+				if si.Knee != nil {
+					si.Knee(knee.item, knee.result)
+				}
+			}
+			klog.Infof("Knee of %s %s %s is detected at numjobs %d iodepth %d, skip the remaining %d work items",
+				wi.FileName, wi.RW, wi.BlockSize, knee.item.NumJobs, knee.item.IODepth, len(series)-i-1)
+			if handler != nil {
+				for _, skipped := range series[i+1:] {
+					handler(skipped, nil)
+				}
+			}
+			break
+		}
+	}
+	return results, nil
+}
+
+// finished returns whether all the work items of the series were finished
+// before the run was resumed.
+func (si *SaturationItems) finished(series WorkItems) bool {
+	for _, wi := range series {
+		if _, ok := si.Finished[wi.ID]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// saturationSeries groups the work items by rw and bs in the order they appear,
+// and sorts each group by ascending concurrency, which is numjobs * iodepth, the
+// work items of the same concurrency are one step of the knee detection.
+func saturationSeries(items WorkItems) []WorkItems {
+	var (
+		keys   []string
+		groups = make(map[string]WorkItems)
+	)
+	for _, item := range items {
+		key := item.RW + "/" + item.BlockSize + "/" + strings.Join(item.Tuning, ",")
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], item)
+	}
+	var series []WorkItems
+	for _, key := range keys {
+		group := groups[key]
+		sort.SliceStable(group, func(i, j int) bool {
+			ci, cj := group[i].NumJobs*group[i].IODepth, group[j].NumJobs*group[j].IODepth
+			if ci != cj {
+				return ci < cj
+			}
+			return group[i].NumJobs < group[j].NumJobs
+		})
+		series = append(series, group)
+	}
+	return series
+}
+
+type kneePoint struct {
+	item    *WorkItem
+	result  *client.FioResult
+	iops    float64
+	latency float64
+}
+
+// kneeStep is the points of the same concurrency, eg. 1x8, 2x4 and 8x1, which
+// are merged into the one with the highest throughput.
+type kneeStep struct {
+	concurrency int32
+	best        *kneePoint
+	flat        int // number of the consecutive steps without enough gain up to this step
+}
+
+// kneeDetector detects the knee of a series of results with ascending concurrency.
+type kneeDetector struct {
+	settings *SaturationSettings
+	steps    []*kneeStep
+}
+
+// add adds the result to the series and returns the knee if it's detected,
+// which is the best point of the last step before the throughput stops improving.
+func (d *kneeDetector) add(item *WorkItem, result *client.FioResult) *kneePoint {
+	p := &kneePoint{item: item, result: result}
+	for _, job := range result.SummaryJobs() {
+		for _, r := range []*client.IOResult{job.ReadResult, job.WriteResult, job.TrimResult} {
+			if r == nil || r.TotalIOs == 0 && r.IOPSMean == 0 {
+				continue
+			}
+			p.iops += r.IOPSMean
+			latency := r.LatencyNs.Mean
+			if percentile, ok := d.settings.percentile(); ok {
+				latency = r.Percentile(percentile)
+			}
+			if latency > p.latency {
+				p.latency = latency
+			}
+		}
+	}
+	concurrency := item.NumJobs * item.IODepth
+	n := len(d.steps)
+	if n > 0 && d.steps[n-1].concurrency == concurrency {
+		// the point of the same concurrency isn't a step
+		if p.iops <= d.steps[n-1].best.iops {
+			return nil
+		}
+		d.steps[n-1].best = p
+	} else {
+		d.steps = append(d.steps, &kneeStep{concurrency: concurrency, best: p})
+		n++
+	}
+	step := d.steps[n-1]
+	step.flat = 0
+	if n > 1 {
+		prev := d.steps[n-2]
+		if prev.best.iops > 0 && (step.best.iops-prev.best.iops)/prev.best.iops*100 < d.settings.MinGain &&
+			step.best.latency > prev.best.latency {
+			step.flat = prev.flat + 1
+		}
+	}
+	if step.flat < d.settings.Steps {
+		return nil
+	}
+	return d.steps[n-1-step.flat].best
+}
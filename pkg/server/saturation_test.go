@@ -0,0 +1,260 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+	exectest "github.com/microyahoo/fio-benchmark/pkg/util/exec/test"
+)
+
+func TestSaturationSuite(t *testing.T) {
+	suite.Run(t, new(saturationTestSuite))
+}
+
+type saturationTestSuite struct {
+	suite.Suite
+}
+
+// mockSaturatedExecutor mocks a device whose iops is saturated at 8 outstanding
+// ios while the mean latency keeps growing with numjobs and iodepth.
+func mockSaturatedExecutor(runs *[]string) *exectest.MockExecutor {
+	var lock sync.Mutex
+	return &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(command string, arg ...string) (string, error) {
+			return "fio-3.27", nil
+		},
+		MockExecuteCommandWithContext: func(ctx context.Context, command string, args ...string) (string, error) {
+			numJobs, _ := strconv.Atoi(fioArg(args, "--numjobs"))
+			iodepth, _ := strconv.Atoi(fioArg(args, "--iodepth"))
+			lock.Lock()
+			*runs = append(*runs, fmt.Sprintf("%d-%d", numJobs, iodepth))
+			lock.Unlock()
+			outstanding := numJobs * iodepth
+			iops := outstanding * 10000
+			if outstanding > 8 {
+				iops = 80000
+			}
+			return fmt.Sprintf(`{"jobs": [{"jobname": "saturation",
+				"job options": {"filename": %q, "rw": "randread", "bs": "4K", "numjobs": "%d", "iodepth": "%d"},
+				"read": {"total_ios": 1, "iops_mean": %d, "lat_ns": {"mean": %d}}, "write": {}, "trim": {}}]}`,
+				fioArg(args, "--filename"), numJobs, iodepth, iops, outstanding*100000+numJobs*10000), nil
+		},
+	}
+}
+
+func (s *saturationTestSuite) TestComplete() {
+	settings := &SaturationSettings{}
+	s.NoError(settings.complete())
+	s.Equal(&SaturationSettings{MinGain: 5, Steps: 2, Latency: "mean"}, settings)
+	_, ok := settings.percentile()
+	s.False(ok)
+
+	settings = &SaturationSettings{Latency: "p99.9"}
+	s.NoError(settings.complete())
+	p, ok := settings.percentile()
+	s.True(ok)
+	s.Equal(99.9, p)
+
+	s.Error((&SaturationSettings{Latency: "max"}).complete())
+	s.Error((&SaturationSettings{Latency: "p101"}).complete())
+}
+
+func (s *saturationTestSuite) TestSeries() {
+	var items WorkItems
+	for _, numJobs := range []int32{1, 2} {
+		for _, iodepth := range []int32{1, 4, 8} {
+			for _, rw := range []string{"randread", "randwrite"} {
+				items = append(items, &WorkItem{NumJobs: numJobs, IODepth: iodepth, RW: rw, BlockSize: "4K"})
+			}
+		}
+	}
+	series := saturationSeries(items)
+	s.Len(series, 2)
+	for i, rw := range []string{"randread", "randwrite"} {
+		var order []string
+		for _, item := range series[i] {
+			s.Equal(rw, item.RW)
+			order = append(order, fmt.Sprintf("%d-%d", item.NumJobs, item.IODepth))
+		}
+		s.Equal([]string{"1-1", "2-1", "1-4", "1-8", "2-4", "2-8"}, order)
+	}
+}
+
+func (s *saturationTestSuite) TestEqualConcurrency() {
+	settings := &SaturationSettings{}
+	s.NoError(settings.complete())
+	result := func(iops, latency int) *client.FioResult {
+		return &client.FioResult{Jobs: []*client.FioJob{{
+			ReadResult: &client.ReadResult{IOPSMean: float64(iops), LatencyNs: client.LatencyNs{Mean: float64(latency)}},
+		}}}
+	}
+	// the device scales with iodepth rather than numjobs, and is saturated at
+	// 16 outstanding ios
+	var items WorkItems
+	for _, numJobs := range []int32{1, 2, 8} {
+		for _, iodepth := range []int32{1, 4, 8, 16, 32, 64} {
+			items = append(items, &WorkItem{NumJobs: numJobs, IODepth: iodepth, RW: "randread", BlockSize: "4K"})
+		}
+	}
+	series := saturationSeries(items)
+	s.Require().Len(series, 1)
+	detector := &kneeDetector{settings: settings}
+	var (
+		order []string
+		knee  *kneePoint
+	)
+	for _, item := range series[0] {
+		order = append(order, fmt.Sprintf("%d-%d", item.NumJobs, item.IODepth))
+		outstanding := int(item.NumJobs * item.IODepth)
+		iops := int(item.IODepth) * 10000
+		if iops > 160000 {
+			iops = 160000
+		}
+		if knee = detector.add(item, result(iops, outstanding*1000+int(item.NumJobs)*100)); knee != nil {
+			break
+		}
+	}
+	// 2-4 and 8-1 don't improve iops after 1-8, but they are the same step so
+	// that the knee isn't detected until the steps 32 and 64
+	s.Require().NotNil(knee)
+	s.Equal([]string{"1-1", "2-1", "1-4", "1-8", "2-4", "8-1", "1-16", "2-8", "1-32", "2-16", "8-4", "1-64"}, order)
+	s.Equal("1-16", fmt.Sprintf("%d-%d", knee.item.NumJobs, knee.item.IODepth))
+}
+
+func (s *saturationTestSuite) TestRunAndResume() {
+	cfgFile := filepath.Join(s.T().TempDir(), "conf.yaml")
+	s.NoError(os.WriteFile(cfgFile, []byte(`
+fio_settings:
+  numjobs: [1, 2]
+  bs: [4K]
+  iodepth: [1, 4, 8, 16, 32]
+  rw: [randread]
+  runtime: 10
+  filename: [/dev/vdb]
+saturation:
+  min_gain: 5
+  steps: 2
+`), 0644))
+	dir := filepath.Join(s.T().TempDir(), "run")
+	outputFile := filepath.Join(s.T().TempDir(), "output.csv")
+	var (
+		runs    []string
+		handled = make(map[string]int)
+	)
+	server, err := NewFioServer(WithChartFile(filepath.Join(s.T().TempDir(), "chart.html")), WithCfgFile(cfgFile), WithRunDir(dir), WithOutputFile(outputFile), WithRenderFormat("csv"),
+		WithItemHandler(func(item *WorkItem, result *client.FioResult) {
+			handled[item.ID]++
+		}))
+	s.NoError(err)
+	server.Executor = mockSaturatedExecutor(&runs)
+	s.NoError(server.Run(make(chan struct{})))
+	// 2-4 is the same step as 1-8, the steps 16 and 32 don't improve iops while
+	// the latency grows, the knee is 1-8
+	s.Equal([]string{"1-1", "2-1", "1-4", "1-8", "2-4", "1-16", "2-8", "1-32"}, runs)
+	// the knee isn't handled again
+	s.Len(handled, 10)
+	for id, n := range handled {
+		s.Equal(1, n, id)
+	}
+
+	f, err := os.Open(outputFile)
+	s.NoError(err)
+	defer f.Close()
+	results, err := client.ParseCSVResults(f)
+	s.NoError(err)
+	s.Len(results, 8)
+	var knees []string
+	for _, r := range results {
+		if r.Knee {
+			knees = append(knees, r.Jobs[0].JobOptions.NumJobs+"-"+r.Jobs[0].JobOptions.IODepth)
+		}
+	}
+	s.Equal([]string{"1-8"}, knees)
+
+	c, err := OpenCheckpoint(dir)
+	s.NoError(err)
+	skipped, err := c.LoadSkipped()
+	s.NoError(err)
+	s.Len(skipped, 2)
+	saved, err := c.LoadResults()
+	s.NoError(err)
+	s.Len(saved, 8)
+	knees = nil
+	for _, r := range saved {
+		if r.Knee {
+			knees = append(knees, r.Jobs[0].JobOptions.NumJobs+"-"+r.Jobs[0].JobOptions.IODepth)
+		}
+	}
+	s.Equal([]string{"1-8"}, knees)
+
+	runs = nil
+	server, err = NewFioServer(WithChartFile(filepath.Join(s.T().TempDir(), "chart.html")), WithRunDir(dir), WithResume(true), WithOutputFile(outputFile))
+	s.NoError(err)
+	server.Executor = mockSaturatedExecutor(&runs)
+	s.NoError(server.Run(make(chan struct{})))
+	s.Empty(runs)
+	s.Len(server.results, 8)
+}
+
+func (s *saturationTestSuite) TestResumeDetectsKnee() {
+	cfgFile := filepath.Join(s.T().TempDir(), "conf.yaml")
+	s.NoError(os.WriteFile(cfgFile, []byte(`
+fio_settings:
+  numjobs: [1, 2]
+  bs: [4K]
+  iodepth: [1, 4, 8, 16, 32]
+  rw: [randread]
+  runtime: 10
+  filename: [/dev/vdb]
+saturation:
+  min_gain: 5
+  steps: 2
+`), 0644))
+	dir := filepath.Join(s.T().TempDir(), "run")
+	var runs []string
+	server, err := NewFioServer(WithChartFile(filepath.Join(s.T().TempDir(), "chart.html")), WithCfgFile(cfgFile), WithRunDir(dir))
+	s.NoError(err)
+	executor := mockSaturatedExecutor(&runs)
+	execute := executor.MockExecuteCommandWithContext
+	// interrupted before 2-4, which is the first point after the knee
+	executor.MockExecuteCommandWithContext = func(ctx context.Context, command string, args ...string) (string, error) {
+		if len(runs) == 4 {
+			server.Close()
+			return "", ctx.Err()
+		}
+		return execute(ctx, command, args...)
+	}
+	server.Executor = executor
+	s.Error(server.Run(make(chan struct{})))
+	s.Equal([]string{"1-1", "2-1", "1-4", "1-8"}, runs)
+
+	runs = nil
+	server, err = NewFioServer(WithChartFile(filepath.Join(s.T().TempDir(), "chart.html")), WithRunDir(dir), WithResume(true))
+	s.NoError(err)
+	server.Executor = mockSaturatedExecutor(&runs)
+	s.NoError(server.Run(make(chan struct{})))
+	// the finished points seed the detection, so the knee is detected after 1-32
+	s.Equal([]string{"2-4", "1-16", "2-8", "1-32"}, runs)
+	s.Len(server.results, 8)
+	for _, r := range server.results {
+		s.Equal(r.Jobs[0].JobOptions.IODepth == "8" && r.Jobs[0].JobOptions.NumJobs == "1", r.Knee)
+	}
+	c, err := OpenCheckpoint(dir)
+	s.NoError(err)
+	skipped, err := c.LoadSkipped()
+	s.NoError(err)
+	s.Len(skipped, 2)
+	saved, err := c.LoadResults()
+	s.NoError(err)
+	for id, r := range saved {
+		s.Equal(r.Jobs[0].JobOptions.IODepth == "8" && r.Jobs[0].JobOptions.NumJobs == "1", r.Knee, id)
+	}
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/microyahoo/fio-benchmark/pkg/util/sys"
+)
+
+const (
+	devDiskByID   = "/dev/disk/by-id/"
+	devDiskByPath = "/dev/disk/by-path/"
+)
+
+// DeviceFilter filters the discovered devices, all the specified fields should be
+// matched and any of the values of a list field should be matched.
+type DeviceFilter struct {
+	Rotational  *bool    `json:"rotational,omitempty" yaml:"rotational"`     // true for hdd, false for ssd and nvme
+	Bus         []string `json:"bus,omitempty" yaml:"bus"`                   // ID_BUS of udev, eg. ata, scsi, nvme, usb
+	Vendor      string   `json:"vendor,omitempty" yaml:"vendor"`             // regex of ID_VENDOR
+	Model       string   `json:"model,omitempty" yaml:"model"`               // regex of ID_MODEL
+	Serials     []string `json:"serials,omitempty" yaml:"serials"`           // ID_SERIAL of udev
+	WWNs        []string `json:"wwns,omitempty" yaml:"wwns"`                 // ID_WWN or ID_WWN_WITH_EXTENSION of udev
+	MinSize     string   `json:"min_size,omitempty" yaml:"min_size"`         // eg. 1Ti, 500G
+	MaxSize     string   `json:"max_size,omitempty" yaml:"max_size"`         // eg. 4Ti
+	KernelNames []string `json:"kernel_names,omitempty" yaml:"kernel_names"` // globs of the kernel name, eg. nvme*n1, sd?
+	ByID        []string `json:"by_id,omitempty" yaml:"by_id"`               // globs of the links in /dev/disk/by-id, eg. nvme-SAMSUNG*
+	ByPath      []string `json:"by_path,omitempty" yaml:"by_path"`           // globs of the links in /dev/disk/by-path, eg. pci-0000:3b:00.0-sas-*
+
+	vendor, model    *regexp.Regexp
+	minSize, maxSize *resource.Quantity
+}
+
+// DeviceSelector selects the devices of `use_all_disks` which match the filter
+// and don't match any of the excluded filters.
+type DeviceSelector struct {
+	DeviceFilter `yaml:",inline"`
+	Exclude      []*DeviceFilter `json:"exclude,omitempty" yaml:"exclude"`
+}
+
+func (f *DeviceFilter) complete() (err error) {
+	if f.Vendor != "" {
+		if f.vendor, err = regexp.Compile(f.Vendor); err != nil {
+			return errors.Wrapf(err, "invalid vendor %s", f.Vendor)
+		}
+	}
+	if f.Model != "" {
+		if f.model, err = regexp.Compile(f.Model); err != nil {
+			return errors.Wrapf(err, "invalid model %s", f.Model)
+		}
+	}
+	if f.MinSize != "" {
+		q, err := resource.ParseQuantity(f.MinSize)
+		if err != nil {
+			return errors.Wrapf(err, "invalid min_size %s", f.MinSize)
+		}
+		f.minSize = &q
+	}
+	if f.MaxSize != "" {
+		q, err := resource.ParseQuantity(f.MaxSize)
+		if err != nil {
+			return errors.Wrapf(err, "invalid max_size %s", f.MaxSize)
+		}
+		f.maxSize = &q
+	}
+	if f.minSize != nil && f.maxSize != nil && f.minSize.Cmp(*f.maxSize) > 0 {
+		return errors.Errorf("min_size %s should not be greater than max_size %s", f.MinSize, f.MaxSize)
+	}
+	for _, patterns := range [][]string{f.KernelNames, f.ByID, f.ByPath} {
+		for _, p := range patterns {
+			if _, err = filepath.Match(p, ""); err != nil {
+				return errors.Wrapf(err, "invalid pattern %s", p)
+			}
+		}
+	}
+	return nil
+}
+
+// mismatch returns why the device doesn't match the filter, or empty if it matches.
+func (f *DeviceFilter) mismatch(d *sys.LocalDevice) string {
+	if f.Rotational != nil && *f.Rotational != d.Rotational {
+		return fmt.Sprintf("rotational is %t", d.Rotational)
+	}
+	if len(f.Bus) > 0 && !containsString(f.Bus, d.Bus) {
+		return fmt.Sprintf("bus %q is not one of %v", d.Bus, f.Bus)
+	}
+	if f.vendor != nil && !f.vendor.MatchString(d.Vendor) {
+		return fmt.Sprintf("vendor %q doesn't match %s", d.Vendor, f.Vendor)
+	}
+	if f.model != nil && !f.model.MatchString(d.Model) {
+		return fmt.Sprintf("model %q doesn't match %s", d.Model, f.Model)
+	}
+	if len(f.Serials) > 0 && !containsString(f.Serials, d.Serial) {
+		return fmt.Sprintf("serial %q is not listed", d.Serial)
+	}
+	if len(f.WWNs) > 0 && !containsString(f.WWNs, d.WWN) && !containsString(f.WWNs, d.WWNVendorExtension) {
+		return fmt.Sprintf("wwn %q is not listed", d.WWN)
+	}
+	size := resource.NewQuantity(int64(d.Size), resource.BinarySI)
+	if f.minSize != nil && size.Cmp(*f.minSize) < 0 {
+		return fmt.Sprintf("size %s is less than %s", size, f.MinSize)
+	}
+	if f.maxSize != nil && size.Cmp(*f.maxSize) > 0 {
+		return fmt.Sprintf("size %s is greater than %s", size, f.MaxSize)
+	}
+	if len(f.KernelNames) > 0 {
+		name := filepath.Base(d.KernelName)
+		if name == "." {
+			name = filepath.Base(d.RealPath)
+		}
+		if !matchAny(f.KernelNames, name) {
+			return fmt.Sprintf("kernel name %s doesn't match %v", name, f.KernelNames)
+		}
+	}
+	if len(f.ByID) > 0 && !matchAny(f.ByID, devLinks(d, devDiskByID)...) {
+		return fmt.Sprintf("no link in %s matches %v", devDiskByID, f.ByID)
+	}
+	if len(f.ByPath) > 0 && !matchAny(f.ByPath, devLinks(d, devDiskByPath)...) {
+		return fmt.Sprintf("no link in %s matches %v", devDiskByPath, f.ByPath)
+	}
+	return ""
+}
+
+func (s *DeviceSelector) complete() error {
+	if err := s.DeviceFilter.complete(); err != nil {
+		return err
+	}
+	for _, f := range s.Exclude {
+		if err := f.complete(); err != nil {
+			return errors.Wrap(err, "invalid exclude")
+		}
+	}
+	return nil
+}
+
+// mismatch returns why the device isn't selected, or empty if it's selected.
+func (s *DeviceSelector) mismatch(d *sys.LocalDevice) string {
+	if s == nil {
+		return ""
+	}
+	if reason := s.DeviceFilter.mismatch(d); reason != "" {
+		return reason
+	}
+	for i, f := range s.Exclude {
+		if f.mismatch(d) == "" {
+			return fmt.Sprintf("excluded by exclude[%d]", i)
+		}
+	}
+	return ""
+}
+
+// IneligibleReason returns why the device isn't selected by `use_all_disks`,
+// or empty if it's selected.
+func IneligibleReason(d *sys.LocalDevice, selector *DeviceSelector) string {
+	switch {
+	case d.Type != sys.DiskType:
+		return fmt.Sprintf("%s device", d.Type)
+	case sys.IsRBDDevice(d.RealPath):
+		return "rbd device"
+	case d.IsRoot:
+		return "root disk"
+	case d.Size == 0:
+		return "zero size"
+	case d.MountPoint != "":
+		return fmt.Sprintf("mounted on %s", d.MountPoint)
+	case d.Bus == sys.DiskBusUsb && !selector.allowsUSB():
+		return "usb disk"
+	case len(d.Partitions) > 0:
+		return fmt.Sprintf("has %d partitions", len(d.Partitions))
+	case d.HasChildren:
+		return "has children"
+	case d.Filesystem != "":
+		return fmt.Sprintf("has %s filesystem", d.Filesystem)
+	case len(d.Parents) > 0:
+		return fmt.Sprintf("has parents %s", strings.Join(d.Parents, ","))
+	case !d.Empty:
+		return "not empty"
+	}
+	if reason := selector.mismatch(d); reason != "" {
+		return "not selected: " + reason
+	}
+	return ""
+}
+
+// allowsUSB returns whether the usb devices are selected explicitly.
+func (s *DeviceSelector) allowsUSB() bool {
+	return s != nil && containsString(s.Bus, sys.DiskBusUsb)
+}
+
+// devLinks returns the names of the device links in the directory.
+func devLinks(d *sys.LocalDevice, dir string) []string {
+	var names []string
+	for _, link := range strings.Fields(d.DevLinks) {
+		if strings.HasPrefix(link, dir) {
+			names = append(names, strings.TrimPrefix(link, dir))
+		}
+	}
+	return names
+}
+
+func matchAny(patterns []string, names ...string) bool {
+	for _, p := range patterns {
+		for _, name := range names {
+			if ok, _ := filepath.Match(p, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	exectest "github.com/microyahoo/fio-benchmark/pkg/util/exec/test"
+)
+
+func TestSelectorSuite(t *testing.T) {
+	suite.Run(t, new(selectorTestSuite))
+}
+
+type selectorTestSuite struct {
+	suite.Suite
+}
+
+// mockDiscoverExecutor mocks two nvme devices, two sas hdds behind different
+// HBAs and a usb disk.
+func mockDiscoverExecutor() *exectest.MockExecutor {
+	udev := map[string]string{
+		"/dev/nvme0n1": `DEVLINKS=/dev/disk/by-id/nvme-SAMSUNG_MZQL23T8HCLS-00A07_S64HNE0R100001 /dev/disk/by-path/pci-0000:5e:00.0-nvme-1
+ID_BUS=nvme
+ID_MODEL=SAMSUNG MZQL23T8HCLS-00A07
+ID_SERIAL=S64HNE0R100001
+ID_WWN=eui.36344830526000010025384500000001`,
+		"/dev/nvme1n1": `DEVLINKS=/dev/disk/by-id/nvme-INTEL_SSDPE2KX040T8_PHLJ0001 /dev/disk/by-path/pci-0000:5f:00.0-nvme-1
+ID_BUS=nvme
+ID_MODEL=INTEL SSDPE2KX040T8
+ID_SERIAL=PHLJ0001`,
+		"/dev/sda": `DEVLINKS=/dev/disk/by-id/scsi-35000c500a1b2c3d4 /dev/disk/by-path/pci-0000:3b:00.0-sas-phy0-lun-0
+ID_BUS=scsi
+ID_VENDOR=SEAGATE
+ID_MODEL=ST16000NM002G
+ID_SERIAL=ZL2000A1
+ID_WWN=0x5000c500a1b2c3d4`,
+		"/dev/sdb": `DEVLINKS=/dev/disk/by-id/scsi-35000c500a1b2c3d5 /dev/disk/by-path/pci-0000:d8:00.0-sas-phy0-lun-0
+ID_BUS=scsi
+ID_VENDOR=SEAGATE
+ID_MODEL=ST16000NM002G
+ID_SERIAL=ZL2000A2
+ID_WWN=0x5000c500a1b2c3d5`,
+		"/dev/sdc": `DEVLINKS=/dev/disk/by-id/usb-Kingston_DataTraveler
+ID_BUS=usb
+ID_SERIAL=Kingston_DataTraveler`,
+	}
+	return &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(command string, args ...string) (string, error) {
+			device := args[len(args)-1]
+			switch {
+			case command == "udevadm":
+				return udev[device], nil
+			case command == "lsblk" && args[0] == "--all":
+				return `SIZE="3840755982336" ROTA="0" RO="0" TYPE="disk" PKNAME="" NAME="/dev/nvme0n1" KNAME="/dev/nvme0n1" UUID="" WWN="" MOUNTPOINT=""
+SIZE="4000787030016" ROTA="0" RO="0" TYPE="disk" PKNAME="" NAME="/dev/nvme1n1" KNAME="/dev/nvme1n1" UUID="" WWN="" MOUNTPOINT=""
+SIZE="16000900661248" ROTA="1" RO="0" TYPE="disk" PKNAME="" NAME="/dev/sda" KNAME="/dev/sda" UUID="" WWN="" MOUNTPOINT=""
+SIZE="16000900661248" ROTA="1" RO="0" TYPE="disk" PKNAME="" NAME="/dev/sdb" KNAME="/dev/sdb" UUID="" WWN="" MOUNTPOINT=""
+SIZE="32010928128" ROTA="1" RO="0" TYPE="disk" PKNAME="" NAME="/dev/sdc" KNAME="/dev/sdc" UUID="" WWN="" MOUNTPOINT=""`, nil
+			case command == "lsblk" && args[0] == "--noheadings":
+				return device, nil
+			case command == "lsblk":
+				return `NAME="` + args[0] + `" SIZE="1" TYPE="disk" PKNAME=""`, nil
+			}
+			return "", nil
+		},
+	}
+}
+
+func (s *selectorTestSuite) selected(cfg string) []string {
+	cfgFile := filepath.Join(s.T().TempDir(), "conf.yaml")
+	s.NoError(os.WriteFile(cfgFile, []byte(`
+fio_settings:
+  numjobs: [1]
+  bs: [4K]
+  iodepth: [1]
+  rw: [randread]
+use_all_disks: true
+`+cfg), 0644))
+	settings, err := ParseSettings(cfgFile)
+	s.NoError(err)
+	queue, err := NewWorkQueue(settings, mockDiscoverExecutor())
+	s.NoError(err)
+	keys := queue.Keys()
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *selectorTestSuite) TestSelect() {
+	s.Equal([]string{"/dev/nvme0n1", "/dev/nvme1n1", "/dev/sda", "/dev/sdb"}, s.selected(""))
+	s.Equal([]string{"/dev/nvme0n1", "/dev/nvme1n1"}, s.selected(`
+device_selector:
+  rotational: false
+`))
+	s.Equal([]string{"/dev/sdc"}, s.selected(`
+device_selector:
+  bus: [usb]
+`))
+	s.Equal([]string{"/dev/nvme0n1"}, s.selected(`
+device_selector:
+  model: ^SAMSUNG
+`))
+	s.Equal([]string{"/dev/sda", "/dev/sdb"}, s.selected(`
+device_selector:
+  vendor: (?i)seagate
+  min_size: 10Ti
+`))
+	s.Equal([]string{"/dev/nvme0n1"}, s.selected(`
+device_selector:
+  max_size: 3.9T
+`))
+	s.Equal([]string{"/dev/nvme1n1", "/dev/sdb"}, s.selected(`
+device_selector:
+  exclude:
+  - serials: [S64HNE0R100001, ZL2000A1]
+`))
+	s.Equal([]string{"/dev/sdb"}, s.selected(`
+device_selector:
+  wwns: [0x5000c500a1b2c3d5]
+`))
+	s.Equal([]string{"/dev/nvme0n1", "/dev/nvme1n1"}, s.selected(`
+device_selector:
+  kernel_names: [nvme*n1]
+`))
+	s.Equal([]string{"/dev/nvme0n1"}, s.selected(`
+device_selector:
+  by_id: [nvme-SAMSUNG*]
+`))
+	s.Equal([]string{"/dev/sda"}, s.selected(`
+device_selector:
+  by_path: [pci-0000:3b:00.0-sas-*]
+`))
+	s.Equal([]string{"/dev/nvme1n1", "/dev/sda", "/dev/sdb"}, s.selected(`
+device_selector:
+  exclude:
+  - model: SAMSUNG
+  - bus: [usb]
+`))
+}
+
+func (s *selectorTestSuite) TestInvalid() {
+	for _, cfg := range []string{
+		"device_selector:\n  model: '['\n",
+		"device_selector:\n  min_size: 1X\n",
+		"device_selector:\n  min_size: 2Ti\n  max_size: 1Ti\n",
+		"device_selector:\n  kernel_names: ['[']\n",
+		"device_selector:\n  exclude:\n  - by_id: ['[']\n",
+	} {
+		cfgFile := filepath.Join(s.T().TempDir(), "conf.yaml")
+		s.NoError(os.WriteFile(cfgFile, []byte("fio_settings: {}\nuse_all_disks: true\n"+cfg), 0644))
+		_, err := ParseSettings(cfgFile)
+		s.Error(err, cfg)
+		s.True(strings.HasPrefix(err.Error(), "invalid device_selector"), err.Error())
+	}
+
+	cfgFile := filepath.Join(s.T().TempDir(), "conf.yaml")
+	s.NoError(os.WriteFile(cfgFile, []byte("fio_settings:\n  filename: [/dev/sdb]\ndevice_selector:\n  rotational: true\n"), 0644))
+	_, err := ParseSettings(cfgFile)
+	s.Error(err)
+}
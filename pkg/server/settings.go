@@ -2,15 +2,65 @@ package server
 
 import (
 	"io/ioutil"
+	"strings"
 
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+)
+
+const (
+	// MaxPercentiles is the max length of fio percentile_list
+	MaxPercentiles = 20
+	// DefaultMaxCV is the default max coefficient of variation in percent of the repeated results
+	DefaultMaxCV = 10
 )
 
 type TestSettings struct {
 	FioSettings *FioSettings `yaml:"fio_settings"`
 	UseAllDisks bool         `yaml:"use_all_disks"` // except root disk
 	Workers     int32        `yaml:"workers"`
+
+	// Hosts are the fio servers started by fio --server, eg. 10.0.0.1 or
+	// 10.0.0.1,8765, each work item is run by all of them at once
+	Hosts []string `yaml:"hosts"`
+
+	// DeviceSelector selects the devices of use_all_disks, eg. only the nvme devices
+	DeviceSelector *DeviceSelector `yaml:"device_selector"`
+
+	// SLO searches the max sustainable IOPS of each device under the latency
+	// target instead of running all the combinations of fio_settings
+	SLO *SLOSettings `yaml:"slo"`
+
+	Repeat  int32   `yaml:"repeat"`  // number of trials of each work item, 1 by default
+	Shuffle bool    `yaml:"shuffle"` // shuffle the trials of each device
+	MaxCV   float64 `yaml:"max_cv"`  // percent, the repeated results whose coefficient of variation is above it are flagged
+
+	// AllowDestroy are the block devices in use which are allowed to be overwritten by write workloads
+	AllowDestroy []*AllowDestroy `yaml:"allow_destroy"`
+
+	// Precondition preconditions each non-rotational device before its work items are run
+	Precondition *client.PreconditionSettings `yaml:"precondition"`
+
+	// Saturation skips the higher concurrency work items once the knee is detected
+	Saturation *SaturationSettings `yaml:"saturation"`
+
+	// Tuning writes the block queue attributes of the devices before their work
+	// items are run and restores them afterwards
+	Tuning *TuningSettings `yaml:"tuning"`
+
+	// Expectations are the rules which the results of the selected jobs should
+	// pass, eg. read_iops >= 400000
+	Expectations []*Expectation `yaml:"expectations"`
+
+	// Label is attached to the results of the run, eg. kernel-6.1, so that the
+	// runs can be charted together by the label series
+	Label string `yaml:"label"`
+
+	// Chart lays out the line charts, eg. iodepth on the x-axis for the queue
+	// depth scaling study
+	Chart *client.ChartSpec `yaml:"chart"`
 }
 
 type FioSettings struct {
@@ -23,6 +73,9 @@ type FioSettings struct {
 	IODepth   []int32  `yaml:"iodepth"`  // 1, 2, 4, 8, 16, 32, 64, 128
 	RW        []string `yaml:"rw"`       // read, write, randread, randwrite, rw, randrw
 	FileName  []string `yaml:"filename"` // device name or file name, which can be ignore if specify `use_all_disk`
+
+	Percentiles []float64 `yaml:"percentiles"`  // completion latency percentiles to report, eg. 50, 99, 99.9, 99.99
+	LogAvgMsec  uint64    `yaml:"log_avg_msec"` // ms, logs the bandwidth, IOPS and latency over time if positive, eg. 1000
 }
 
 func ParseSettings(cfgFile string) (*TestSettings, error) {
@@ -30,19 +83,122 @@ func ParseSettings(cfgFile string) (*TestSettings, error) {
 	if err != nil {
 		return nil, err
 	}
+	return LoadSettings(out)
+}
+
+// LoadSettings parses the settings from the yaml or json document and validates them.
+func LoadSettings(data []byte) (*TestSettings, error) {
 	settings := TestSettings{}
-	err = yaml.Unmarshal(out, &settings)
+	err := yaml.Unmarshal(data, &settings)
 	if err != nil {
 		return nil, err
 	}
-	if !settings.UseAllDisks && len(settings.FioSettings.FileName) == 0 {
-		return nil, errors.Errorf("filename or userAllDisks should be specified")
-	}
 	if settings.FioSettings == nil {
 		return nil, errors.Errorf("fio parameters should be specified")
 	}
+	if !settings.UseAllDisks && len(settings.FioSettings.FileName) == 0 {
+		return nil, errors.Errorf("filename or userAllDisks should be specified")
+	}
 	if settings.Workers <= 0 {
 		settings.Workers = 1
 	}
+	if err = ValidatePercentiles(settings.FioSettings.Percentiles); err != nil {
+		return nil, err
+	}
+	if settings.Repeat < 0 {
+		return nil, errors.Errorf("invalid repeat %d", settings.Repeat)
+	}
+	if settings.Repeat == 0 {
+		settings.Repeat = 1
+	}
+	if settings.MaxCV <= 0 {
+		settings.MaxCV = DefaultMaxCV
+	}
+	if settings.Repeat > 1 && (settings.Saturation != nil || settings.SLO != nil) {
+		return nil, errors.New("repeat is not supported by saturation or slo")
+	}
+	if settings.DeviceSelector != nil {
+		if !settings.UseAllDisks {
+			return nil, errors.New("device_selector should be specified with use_all_disks")
+		}
+		if err = settings.DeviceSelector.complete(); err != nil {
+			return nil, errors.Wrap(err, "invalid device_selector")
+		}
+	}
+	for _, a := range settings.AllowDestroy {
+		if err = a.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if settings.Precondition != nil {
+		if settings.Precondition.IOEngine == "" {
+			settings.Precondition.IOEngine = settings.FioSettings.IOEngine
+		}
+		if err = settings.Precondition.Complete(); err != nil {
+			return nil, err
+		}
+	}
+	if settings.Saturation != nil {
+		if err = settings.Saturation.complete(); err != nil {
+			return nil, err
+		}
+	}
+	if settings.SLO != nil {
+		if err = settings.SLO.complete(settings.FioSettings); err != nil {
+			return nil, err
+		}
+	}
+	if len(settings.Hosts) > 0 {
+		if err = settings.validateHosts(); err != nil {
+			return nil, err
+		}
+	}
+	if settings.Tuning != nil {
+		if err = settings.Tuning.complete(); err != nil {
+			return nil, errors.Wrap(err, "invalid tuning")
+		}
+		if settings.SLO != nil && settings.Tuning.sweep() {
+			return nil, errors.New("sweeping tuning values is not supported by slo")
+		}
+	}
+	for _, e := range settings.Expectations {
+		if err = e.validate(); err != nil {
+			return nil, err
+		}
+	}
 	return &settings, nil
 }
+
+// validateHosts validates the hosts, the settings which only work on the local
+// devices are not supported by the distributed runs.
+func (s *TestSettings) validateHosts() error {
+	for _, host := range s.Hosts {
+		if strings.TrimSpace(host) == "" || strings.ContainsAny(host, " \t") {
+			return errors.Errorf("invalid host %q", host)
+		}
+	}
+	switch {
+	case s.UseAllDisks:
+		return errors.New("use_all_disks is not supported by hosts, filename should be specified")
+	case s.Precondition != nil:
+		return errors.New("precondition is not supported by hosts")
+	case s.Tuning != nil:
+		return errors.New("tuning is not supported by hosts")
+	case s.FioSettings.LogAvgMsec > 0:
+		return errors.New("log_avg_msec is not supported by hosts")
+	}
+	return nil
+}
+
+// ValidatePercentiles validates the percentiles which are passed to fio by --percentile_list.
+func ValidatePercentiles(percentiles []float64) error {
+	if len(percentiles) > MaxPercentiles {
+		return errors.Errorf("at most %d percentiles can be specified", MaxPercentiles)
+	}
+	for _, p := range percentiles {
+		if p <= 0 || p > 100 {
+			return errors.Errorf("invalid percentile %v, which should be in (0, 100]", p)
+		}
+	}
+	return nil
+}
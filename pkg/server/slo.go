@@ -0,0 +1,391 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+	"github.com/microyahoo/fio-benchmark/pkg/util/exec"
+)
+
+const (
+	// SLOMethodBisect bisects the iodepth with repeated fio runs for each numjobs
+	SLOMethodBisect = "bisect"
+	// SLOMethodLatencyTarget lets fio find the iodepth by latency_target and latency_window
+	SLOMethodLatencyTarget = "latency_target"
+
+	defaultSLOPercentile    = 99
+	defaultSLOMaxIODepth    = 256
+	defaultSLOLatencyWindow = 5
+)
+
+// SLOSettings searches the max sustainable IOPS of each device whose completion
+// latency percentile stays within the target, eg. p99 read latency <= 2ms.
+type SLOSettings struct {
+	RW            string  `yaml:"rw"`             // randread, which is the first rw of fio_settings by default
+	BlockSize     string  `yaml:"bs"`             // 4K, which is the first bs of fio_settings by default
+	Direction     string  `yaml:"direction"`      // read, write or trim, which is derived from rw by default
+	Percentile    float64 `yaml:"percentile"`     // 99 by default
+	TargetUs      float64 `yaml:"target_us"`      // latency target in microseconds
+	Method        string  `yaml:"method"`         // bisect or latency_target, bisect by default
+	NumJobs       []int32 `yaml:"numjobs"`        // numjobs to search, which is numjobs of fio_settings by default
+	MaxIODepth    int32   `yaml:"max_iodepth"`    // 256 by default
+	LatencyWindow uint64  `yaml:"latency_window"` // seconds, only used by latency_target, 5 by default
+}
+
+// complete fills the defaults of the SLO settings from fio settings and validates them.
+func (s *SLOSettings) complete(fs *FioSettings) error {
+	if s.RW == "" && len(fs.RW) > 0 {
+		s.RW = fs.RW[0]
+	}
+	if s.BlockSize == "" && len(fs.BlockSize) > 0 {
+		s.BlockSize = fs.BlockSize[0]
+	}
+	if s.RW == "" || s.BlockSize == "" {
+		return errors.New("rw and bs of slo should be specified")
+	}
+	if s.Direction == "" {
+		switch s.RW {
+		case "read", "randread":
+			s.Direction = "read"
+		case "write", "randwrite":
+			s.Direction = "write"
+		case "trim", "randtrim":
+			s.Direction = "trim"
+		default:
+			return errors.Errorf("direction of slo should be specified for rw %s", s.RW)
+		}
+	}
+	switch s.Direction {
+	case "read", "write", "trim":
+	default:
+		return errors.Errorf("invalid slo direction %s, which should be read, write or trim", s.Direction)
+	}
+	if s.Percentile == 0 {
+		s.Percentile = defaultSLOPercentile
+	}
+	if err := ValidatePercentiles([]float64{s.Percentile}); err != nil {
+		return err
+	}
+	if s.TargetUs <= 0 {
+		return errors.New("target_us of slo should be positive")
+	}
+	switch s.Method {
+	case "":
+		s.Method = SLOMethodBisect
+	case SLOMethodBisect, SLOMethodLatencyTarget:
+	default:
+		return errors.Errorf("invalid slo method %s, which should be %s or %s", s.Method, SLOMethodBisect, SLOMethodLatencyTarget)
+	}
+	if len(s.NumJobs) == 0 {
+		s.NumJobs = append(s.NumJobs, fs.NumJobs...)
+	}
+	if len(s.NumJobs) == 0 {
+		s.NumJobs = []int32{1}
+	}
+	sort.Slice(s.NumJobs, func(i, j int) bool { return s.NumJobs[i] < s.NumJobs[j] })
+	if s.MaxIODepth <= 0 {
+		s.MaxIODepth = defaultSLOMaxIODepth
+	}
+	if s.LatencyWindow == 0 {
+		s.LatencyWindow = defaultSLOLatencyWindow
+	}
+	return nil
+}
+
+// String returns the SLO in human readable format, eg. read-p99<=2000us
+func (s *SLOSettings) String() string {
+	return fmt.Sprintf("%s-p%s<=%sus", s.Direction, strconv.FormatFloat(s.Percentile, 'f', -1, 64),
+		strconv.FormatFloat(s.TargetUs, 'f', -1, 64))
+}
+
+// SLOReport is the highest IOPS and bandwidth of a device which stays within the SLO.
+type SLOReport struct {
+	FileName  string  `json:"filename"`
+	RW        string  `json:"rw"`
+	BlockSize string  `json:"bs"`
+	SLO       string  `json:"slo"`
+	Method    string  `json:"method"`
+	NumJobs   int32   `json:"numjobs"`
+	IODepth   int32   `json:"iodepth"`
+	IOPS      float64 `json:"iops"`
+	BW        float64 `json:"bw"`         // KiB/s
+	LatencyUs float64 `json:"latency_us"` // latency of the SLO percentile
+	Trials    int     `json:"trials"`
+	Met       bool    `json:"met"`
+}
+
+// SLOSearch is a job which searches numjobs and iodepth of a device for the
+// max sustainable IOPS under the SLO, the fio runs of a device are run one by one.
+type SLOSearch struct {
+	Item     *WorkItem
+	Settings *SLOSettings
+	Report   *SLOReport
+}
+
+// NewSLOSearch creates a SLO search for the device of the work item, the
+// options besides numjobs, iodepth, rw and bs are taken from the item.
+func NewSLOSearch(item *WorkItem, settings *SLOSettings) *SLOSearch {
+	template := *item
+	template.RW = settings.RW
+	template.BlockSize = settings.BlockSize
+	template.Percentiles = requirePercentile(item.Percentiles, settings.Percentile)
+	return &SLOSearch{
+		Item:     &template,
+		Settings: settings,
+	}
+}
+
+// sloTrial is a fio run of the search.
+type sloTrial struct {
+	numJobs   int32
+	iodepth   int32
+	result    *client.FioResult
+	iops      float64
+	bw        float64
+	latencyUs float64
+	met       bool
+}
+
+func (s *SLOSearch) Do(ctx context.Context, executor exec.Executor, dryrun bool, handler ItemHandler) ([]*client.FioResult, error) {
+	s.Report = &SLOReport{
+		FileName:  s.Item.FileName,
+		RW:        s.Settings.RW,
+		BlockSize: s.Settings.BlockSize,
+		SLO:       s.Settings.String(),
+		Method:    s.Settings.Method,
+	}
+	var (
+		results []*client.FioResult
+		err     error
+	)
+	if s.Settings.Method == SLOMethodLatencyTarget {
+		results, err = s.searchLatencyTarget(ctx, executor, dryrun, handler)
+	} else {
+		results, err = s.bisect(ctx, executor, dryrun, handler)
+	}
+	if err != nil {
+		klog.Warningf("SLO search of %s is stopped: %v", s.Item.FileName, err)
+	}
+	if err == nil && s.Report.Met && s.Settings.Method == SLOMethodLatencyTarget {
+		var result *client.FioResult
+		if result, err = s.verify(ctx, executor, dryrun, handler); result != nil {
+			results = append(results, result)
+		}
+		if err != nil {
+			klog.Warningf("SLO verification of %s is stopped: %v", s.Item.FileName, err)
+		} else if !s.Report.Met {
+			klog.Warningf("%s can't meet %s at %.2f IOPS found by latency_target", s.Item.FileName, s.Report.SLO, s.Report.IOPS)
+			return results, nil
+		}
+	}
+	if s.Report.Met {
+		klog.Infof("Max IOPS of %s under %s is %.2f with numjobs %d and iodepth %d", s.Item.FileName, s.Report.SLO,
+			s.Report.IOPS, s.Report.NumJobs, s.Report.IODepth)
+	} else if !dryrun {
+		klog.Warningf("%s can't meet %s even with numjobs %d and iodepth 1", s.Item.FileName, s.Report.SLO, s.Settings.NumJobs[0])
+	}
+	return results, err
+}
+
+// bisect bisects the iodepth for each numjobs in ascending order, it assumes the
+// latency increases with iodepth, and stops once the SLO can't be met with
+// iodepth 1 since more jobs won't help.
+func (s *SLOSearch) bisect(ctx context.Context, executor exec.Executor, dryrun bool, handler ItemHandler) ([]*client.FioResult, error) {
+	var results []*client.FioResult
+	depths := sloDepths(s.Settings.MaxIODepth)
+	for _, numJobs := range s.Settings.NumJobs {
+		best := -1
+		lo, hi := 0, len(depths)-1
+		for lo <= hi {
+			mid := (lo + hi) / 2
+			t, err := s.trial(ctx, executor, dryrun, handler, numJobs, depths[mid])
+			if err != nil || t == nil {
+				return results, err
+			}
+			results = append(results, t.result)
+			if t.met {
+				best = mid
+				lo = mid + 1
+			} else {
+				hi = mid - 1
+			}
+		}
+		if best < 0 {
+			break
+		}
+	}
+	return results, nil
+}
+
+// searchLatencyTarget runs fio with latency_target for each numjobs in ascending
+// order, fio adjusts the iodepth up to max_iodepth to keep the latency
+// percentile within the target, and reports the iodepth as latency_depth.
+func (s *SLOSearch) searchLatencyTarget(ctx context.Context, executor exec.Executor, dryrun bool, handler ItemHandler) ([]*client.FioResult, error) {
+	var results []*client.FioResult
+	options := []string{
+		fmt.Sprintf("latency_target=%s", strconv.FormatFloat(s.Settings.TargetUs, 'f', -1, 64)),
+		fmt.Sprintf("latency_window=%d", s.Settings.LatencyWindow*1000000),
+		fmt.Sprintf("latency_percentile=%s", strconv.FormatFloat(s.Settings.Percentile, 'f', -1, 64)),
+	}
+	for _, numJobs := range s.Settings.NumJobs {
+		t, err := s.trial(ctx, executor, dryrun, handler, numJobs, s.Settings.MaxIODepth, options...)
+		if err != nil || t == nil {
+			return results, err
+		}
+		results = append(results, t.result)
+		if !t.met {
+			break
+		}
+	}
+	return results, nil
+}
+
+// verify reruns the best trial of latency_target at the fixed rate of its IOPS
+// by rate_iops, since the latency percentile of latency_target is measured over
+// the whole run while fio is probing the iodepth. The report has the IOPS and
+// the latency of the verification, which isn't met if it exceeds the target.
+func (s *SLOSearch) verify(ctx context.Context, executor exec.Executor, dryrun bool, handler ItemHandler) (*client.FioResult, error) {
+	rate := math.Ceil(s.Report.IOPS / float64(s.Report.NumJobs)) // rate_iops is per job
+	t, err := s.run(ctx, executor, dryrun, handler, s.Report.NumJobs, s.Report.IODepth,
+		fmt.Sprintf("rate_iops=%s", strconv.FormatFloat(rate, 'f', -1, 64)))
+	if err != nil || t == nil {
+		return nil, err
+	}
+	s.Report.IOPS = t.iops
+	s.Report.BW = t.bw
+	s.Report.LatencyUs = t.latencyUs
+	s.Report.Met = t.met
+	return t.result, nil
+}
+
+// trial runs fio with numjobs and iodepth and records it into the report if
+// it's the best one which meets the SLO.
+func (s *SLOSearch) trial(ctx context.Context, executor exec.Executor, dryrun bool, handler ItemHandler, numJobs, iodepth int32, options ...string) (*sloTrial, error) {
+	t, err := s.run(ctx, executor, dryrun, handler, numJobs, iodepth, options...)
+	if err != nil || t == nil {
+		return t, err
+	}
+	if t.met && t.iops > s.Report.IOPS {
+		s.Report.NumJobs = numJobs
+		s.Report.IODepth = t.iodepth
+		s.Report.IOPS = t.iops
+		s.Report.BW = t.bw
+		s.Report.LatencyUs = t.latencyUs
+		s.Report.Met = true
+	}
+	return t, nil
+}
+
+// run runs fio with numjobs and iodepth, the handler is called with the result
+// of the trial for the searched work item. The trial is nil in dryrun mode since
+// there is no result to search with.
+func (s *SLOSearch) run(ctx context.Context, executor exec.Executor, dryrun bool, handler ItemHandler, numJobs, iodepth int32, options ...string) (*sloTrial, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	item := *s.Item
+	item.NumJobs = numJobs
+	item.IODepth = iodepth
+	item.FioOptions = append(append([]string{}, s.Item.FioOptions...), options...)
+	result, err := item.Run(ctx, executor, dryrun)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		klog.Infof("Only the first fio run of the SLO search of %s is printed in dryrun mode", item.FileName)
+		return nil, nil
+	}
+	s.Report.Trials++
+	if handler != nil {
+		handler(s.Item, result)
+	}
+	if len(result.Jobs) == 0 {
+		return nil, errors.Errorf("no job in the result of %s", &item)
+	}
+	job := result.SummaryJobs()[0] // cluster-wide job of the distributed result
+	t := &sloTrial{numJobs: numJobs, iodepth: iodepth, result: result}
+	if job.LatencyDepth > 0 {
+		t.iodepth = job.LatencyDepth
+	}
+	var r *client.IOResult
+	switch s.Settings.Direction {
+	case "read":
+		r = job.ReadResult
+	case "write":
+		r = job.WriteResult
+	default:
+		r = job.TrimResult
+	}
+	if r != nil {
+		t.iops, t.bw = r.IOPSMean, r.BWMean
+		t.latencyUs = r.Percentile(s.Settings.Percentile) / 1000
+	}
+	t.met = t.latencyUs > 0 && t.latencyUs <= s.Settings.TargetUs
+	klog.Infof("SLO trial of %s with numjobs %d and iodepth %d: iops %.2f, p%v latency %.2fus, met: %t",
+		item.FileName, numJobs, t.iodepth, t.iops, s.Settings.Percentile, t.latencyUs, t.met)
+	return t, nil
+}
+
+// sloDepths returns the iodepths to bisect, which are powers of two up to max.
+func sloDepths(max int32) []int32 {
+	var depths []int32
+	for d := int32(1); d < max; d *= 2 {
+		depths = append(depths, d)
+	}
+	return append(depths, max)
+}
+
+// withPercentile returns the percentiles including p.
+func withPercentile(percentiles []float64, p float64) []float64 {
+	for _, v := range percentiles {
+		if v == p {
+			return percentiles
+		}
+	}
+	ps := append(append([]float64{}, percentiles...), p)
+	sort.Float64s(ps)
+	return ps
+}
+
+// requirePercentile returns the percentiles passed to fio including p, which
+// start from the default percentiles if they are empty, so that the default
+// ones are still reported.
+func requirePercentile(percentiles []float64, p float64) []float64 {
+	if len(percentiles) == 0 {
+		percentiles = client.DefaultPercentiles
+	}
+	return withPercentile(percentiles, p)
+}
+
+// RenderSLOReports renders the SLO reports in the format of table, markdown, csv or html.
+func RenderSLOReports(reports []*SLOReport, w io.Writer, format string) {
+	t := table.NewWriter()
+	t.SetOutputMirror(w)
+	t.AppendHeader(table.Row{"filename", "rw", "blocksize", "slo", "method", "numjobs", "iodepth",
+		"iops-mean", "bw-mean(KiB/s)", "latency(us)", "trials", "met"})
+	for _, r := range reports {
+		t.AppendRow(table.Row{r.FileName, r.RW, r.BlockSize, r.SLO, r.Method, r.NumJobs, r.IODepth,
+			r.IOPS, r.BW, r.LatencyUs, r.Trials, r.Met})
+	}
+	t.SortBy([]table.SortBy{{Name: "filename", Mode: table.Asc}})
+	switch strings.ToLower(format) {
+	case "md", "markdown":
+		t.RenderMarkdown()
+	case "csv":
+		t.RenderCSV()
+	case "html":
+		t.RenderHTML()
+	default:
+		t.Render()
+	}
+}
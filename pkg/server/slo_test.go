@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	exectest "github.com/microyahoo/fio-benchmark/pkg/util/exec/test"
+)
+
+func TestSLOSuite(t *testing.T) {
+	suite.Run(t, new(sloTestSuite))
+}
+
+type sloTestSuite struct {
+	suite.Suite
+}
+
+func fioArg(args []string, name string) string {
+	for i, arg := range args {
+		if arg == name && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(arg, name+"=") {
+			return strings.TrimPrefix(arg, name+"=")
+		}
+	}
+	return ""
+}
+
+// mockSLOExecutor mocks a device whose p99 read latency is 100us per
+// outstanding io and whose iops is saturated at 64 outstanding ios.
+func mockSLOExecutor(trials *[]string) *exectest.MockExecutor {
+	var lock sync.Mutex
+	return &exectest.MockExecutor{
+		MockExecuteCommandWithContext: func(ctx context.Context, command string, args ...string) (string, error) {
+			numJobs, _ := strconv.Atoi(fioArg(args, "--numjobs"))
+			iodepth, _ := strconv.Atoi(fioArg(args, "--iodepth"))
+			if fioArg(args, "--latency_target") != "" {
+				// fio finds the depth whose latency is within the target
+				iodepth = 2000 / 100 / numJobs
+			}
+			lock.Lock()
+			*trials = append(*trials, fmt.Sprintf("%d-%d", numJobs, iodepth))
+			lock.Unlock()
+			outstanding := numJobs * iodepth
+			iops := float64(outstanding) * 10000
+			if outstanding > 64 {
+				iops = 640000
+			}
+			if rate, _ := strconv.ParseFloat(fioArg(args, "--rate_iops"), 64); rate > 0 && iops > rate*float64(numJobs) {
+				iops = rate * float64(numJobs)
+			}
+			return fmt.Sprintf(`{"jobs": [{"jobname": "slo", "latency_depth": %d,
+				"job options": {"filename": %q, "numjobs": "%d", "iodepth": "%d"},
+				"read": {"iops_mean": %f, "bw_mean": %f, "clat_ns": {"percentile": {"99.000000": %d}}},
+				"write": {}, "trim": {}}]}`,
+				iodepth, fioArg(args, "--filename"), numJobs, iodepth, iops, iops*4, outstanding*100000), nil
+		},
+	}
+}
+
+func (s *sloTestSuite) TestComplete() {
+	fs := &FioSettings{RW: []string{"randwrite"}, BlockSize: []string{"4K"}, NumJobs: []int32{4, 1}}
+	slo := &SLOSettings{TargetUs: 2000}
+	s.NoError(slo.complete(fs))
+	s.Equal("randwrite", slo.RW)
+	s.Equal("write", slo.Direction)
+	s.Equal(SLOMethodBisect, slo.Method)
+	s.Equal([]int32{1, 4}, slo.NumJobs)
+	s.EqualValues(256, slo.MaxIODepth)
+	s.Equal("write-p99<=2000us", slo.String())
+
+	s.Error((&SLOSettings{RW: "randrw", BlockSize: "4K", TargetUs: 2000}).complete(fs))
+	s.Error((&SLOSettings{TargetUs: 2000, Method: "foo"}).complete(fs))
+	s.Error((&SLOSettings{}).complete(fs))
+
+	s.Equal([]int32{1, 2, 4, 8, 16, 32, 64, 100}, sloDepths(100))
+	s.Equal([]float64{50, 99, 99.9}, withPercentile([]float64{50, 99.9}, 99))
+}
+
+func (s *sloTestSuite) TestBisect() {
+	var trials []string
+	slo := &SLOSettings{RW: "randread", BlockSize: "4K", TargetUs: 2000, NumJobs: []int32{1, 2, 32}, MaxIODepth: 32}
+	s.NoError(slo.complete(&FioSettings{}))
+	search := NewSLOSearch(&WorkItem{FileName: "/dev/vdb", Runtime: 10}, slo)
+	results, err := search.Do(context.Background(), mockSLOExecutor(&trials), false, nil)
+	s.NoError(err)
+	s.Len(results, len(trials))
+	// depths 1 2 4 8 16 32, the latency of 32 jobs is above the target even with iodepth 1
+	s.Equal([]string{"1-4", "1-16", "1-32", "2-4", "2-16", "2-8", "32-4", "32-1"}, trials)
+	s.Equal(&SLOReport{
+		FileName:  "/dev/vdb",
+		RW:        "randread",
+		BlockSize: "4K",
+		SLO:       "read-p99<=2000us",
+		Method:    SLOMethodBisect,
+		NumJobs:   1,
+		IODepth:   16,
+		IOPS:      160000,
+		BW:        640000,
+		LatencyUs: 1600,
+		Trials:    8,
+		Met:       true,
+	}, search.Report)
+}
+
+func (s *sloTestSuite) TestLatencyTarget() {
+	var trials []string
+	slo := &SLOSettings{RW: "randread", BlockSize: "4K", TargetUs: 2000, NumJobs: []int32{1, 2, 32}, Method: SLOMethodLatencyTarget}
+	s.NoError(slo.complete(&FioSettings{}))
+	search := NewSLOSearch(&WorkItem{FileName: "/dev/vdb", Runtime: 10}, slo)
+	results, err := search.Do(context.Background(), mockSLOExecutor(&trials), false, nil)
+	s.NoError(err)
+	// the best trial is verified at its iops
+	s.Equal([]string{"1-20", "2-10", "32-0", "1-20"}, trials)
+	s.Len(results, 4)
+	s.Equal(4, search.Report.Trials)
+	s.True(search.Report.Met)
+	s.EqualValues(20, search.Report.IODepth)
+	s.EqualValues(200000, search.Report.IOPS)
+	s.EqualValues(2000, search.Report.LatencyUs)
+
+	// the latency of the verification exceeds the target
+	trials = nil
+	executor := mockSLOExecutor(&trials)
+	execute := executor.MockExecuteCommandWithContext
+	var rates []string
+	executor.MockExecuteCommandWithContext = func(ctx context.Context, command string, args ...string) (string, error) {
+		output, err := execute(ctx, command, args...)
+		if rate := fioArg(args, "--rate_iops"); rate != "" {
+			rates = append(rates, rate)
+			output = strings.Replace(output, `"99.000000": 2000000`, `"99.000000": 3000000`, 1)
+		}
+		return output, err
+	}
+	search = NewSLOSearch(&WorkItem{FileName: "/dev/vdb", Runtime: 10}, slo)
+	_, err = search.Do(context.Background(), executor, false, nil)
+	s.NoError(err)
+	s.Equal([]string{"200000"}, rates)
+	s.False(search.Report.Met)
+	s.EqualValues(3000, search.Report.LatencyUs)
+}
+
+func (s *sloTestSuite) TestRun() {
+	cfgFile := filepath.Join(s.T().TempDir(), "conf.yaml")
+	s.NoError(os.WriteFile(cfgFile, []byte(`
+fio_settings:
+  numjobs: [1, 2]
+  bs: [4K]
+  iodepth: [1]
+  rw: [randread]
+  runtime: 10
+  filename: [/dev/vdb, /dev/vdc]
+slo:
+  target_us: 2000
+  max_iodepth: 64
+workers: 2
+`), 0644))
+	outputFile := filepath.Join(s.T().TempDir(), "output.csv")
+	var trials []string
+	server, err := NewFioServer(WithChartFile(filepath.Join(s.T().TempDir(), "chart.html")), WithCfgFile(cfgFile), WithOutputFile(outputFile), WithRenderFormat("csv"))
+	s.NoError(err)
+	executor := mockSLOExecutor(&trials)
+	executor.MockExecuteCommandWithOutput = func(command string, arg ...string) (string, error) {
+		return "fio-3.27", nil
+	}
+	server.Executor = executor
+	s.NoError(server.Run(make(chan struct{})))
+	s.Len(server.sloReports, 2)
+	output, err := os.ReadFile(outputFile)
+	s.NoError(err)
+	s.Contains(string(output), "latency-read-p99(us)")
+	s.Contains(string(output), "/dev/vdb,randread,4K,read-p99<=2000us,bisect,1,16,160000,640000,1600,")
+
+	server, err = NewFioServer(WithChartFile(filepath.Join(s.T().TempDir(), "chart.html")), WithCfgFile(cfgFile), WithRunDir(s.T().TempDir()))
+	s.NoError(err)
+	_, err = server.prepare()
+	s.Error(err)
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+	"github.com/microyahoo/fio-benchmark/pkg/util/exec"
+	"github.com/microyahoo/fio-benchmark/pkg/util/sys"
+)
+
+const schedulerAttribute = "scheduler"
+
+var queueAttributePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// TuningSettings are the block queue attributes which are written to sysfs
+// before the work items of a device are run, eg. scheduler, nr_requests and
+// read_ahead_kb. The work items are run with each combination of the values,
+// so several values of an attribute are swept like bs and iodepth.
+type TuningSettings struct {
+	Queue map[string][]string `json:"queue" yaml:"queue"` // applied to all the devices
+
+	// Devices are keyed by the device path or name, eg. /dev/nvme0n1 or nvme0n1,
+	// whose attributes override the same attributes of queue
+	Devices map[string]map[string][]string `json:"devices" yaml:"devices"`
+}
+
+// complete validates the attribute names and values of the tuning settings.
+func (t *TuningSettings) complete() error {
+	validate := func(attributes map[string][]string) error {
+		for name, values := range attributes {
+			if !queueAttributePattern.MatchString(name) {
+				return errors.Errorf("invalid queue attribute %q", name)
+			}
+			if len(values) == 0 {
+				return errors.Errorf("no value is specified for queue attribute %s", name)
+			}
+			for _, value := range values {
+				if value == "" || strings.ContainsAny(value, ",\n") {
+					return errors.Errorf("invalid value %q of queue attribute %s", value, name)
+				}
+			}
+		}
+		return nil
+	}
+	if err := validate(t.Queue); err != nil {
+		return err
+	}
+	for device, attributes := range t.Devices {
+		if err := validate(attributes); err != nil {
+			return errors.Wrapf(err, "device %s", device)
+		}
+	}
+	return nil
+}
+
+// sweep returns true if any attribute has more than one value.
+func (t *TuningSettings) sweep() bool {
+	for _, values := range t.Queue {
+		if len(values) > 1 {
+			return true
+		}
+	}
+	for _, attributes := range t.Devices {
+		for _, values := range attributes {
+			if len(values) > 1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// attributes returns the queue attributes of the device, the attributes of
+// the device override the global ones.
+func (t *TuningSettings) attributes(device string) map[string][]string {
+	attributes := make(map[string][]string)
+	for name, values := range t.Queue {
+		attributes[name] = values
+	}
+	for key, overrides := range t.Devices {
+		if key != device && filepath.Base(key) != filepath.Base(device) {
+			continue
+		}
+		for name, values := range overrides {
+			attributes[name] = values
+		}
+	}
+	return attributes
+}
+
+// Profiles returns all the combinations of the queue attribute values of the
+// device, each of them is in the format of name=value, eg. [scheduler=none nr_requests=64].
+func (t *TuningSettings) Profiles(device string) [][]string {
+	attributes := t.attributes(device)
+	var names []string
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sortAttributes(names)
+	var profiles [][]string
+	for _, name := range names {
+		var next [][]string
+		for _, value := range attributes[name] {
+			setting := name + "=" + value
+			if len(profiles) == 0 {
+				next = append(next, []string{setting})
+				continue
+			}
+			for _, profile := range profiles {
+				next = append(next, append(append([]string{}, profile...), setting))
+			}
+		}
+		profiles = next
+	}
+	return profiles
+}
+
+// sortAttributes sorts the attribute names, the scheduler is always the first
+// one since switching it resets the other attributes such as nr_requests.
+func sortAttributes(names []string) {
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == schedulerAttribute) != (names[j] == schedulerAttribute) {
+			return names[i] == schedulerAttribute
+		}
+		return names[i] < names[j]
+	})
+}
+
+// Tune runs the work items of each key with every tuning profile of the key,
+// all the work items of a profile are run before the next profile.
+func (q *WorkQueue) Tune(t *TuningSettings) {
+	for key, items := range q.Queue {
+		profiles := t.Profiles(key)
+		if len(profiles) == 0 {
+			continue
+		}
+		var tuned []*WorkItem
+		for _, profile := range profiles {
+			for _, item := range items {
+				i := *item
+				i.Tuning = profile
+				tuned = append(tuned, &i)
+			}
+		}
+		q.Queue[key] = tuned
+	}
+}
+
+// applyTuning writes the queue attributes of the tuning profile to the device,
+// the attributes which already have the value are not written again.
+func applyTuning(device string, profile []string, dryrun bool) error {
+	for _, setting := range profile {
+		name, value, _ := strings.Cut(setting, "=")
+		if dryrun {
+			klog.Infof("Would set %s of %s to %s", name, device, value)
+			continue
+		}
+		current, err := sys.GetQueueAttribute(device, name)
+		if err != nil {
+			return err
+		}
+		if current == value {
+			continue
+		}
+		klog.Infof("Set %s of %s to %s, which was %s", name, device, value, current)
+		if err = sys.SetQueueAttribute(device, name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TunedJob restores the queue attributes of the device which are tuned by its
+// work items once the job is finished, failed or interrupted.
+type TunedJob struct {
+	Job
+	FileName   string
+	Attributes []string
+}
+
+func (j *TunedJob) Do(ctx context.Context, executor exec.Executor, dryrun bool, handler ItemHandler) ([]*client.FioResult, error) {
+	if dryrun {
+		return j.Job.Do(ctx, executor, dryrun, handler)
+	}
+	originals := make([]string, 0, len(j.Attributes))
+	for _, name := range j.Attributes {
+		value, err := sys.GetQueueAttribute(j.FileName, name)
+		if err != nil {
+			klog.Warningf("Skip the work items of %s since the queue attributes can't be restored: %v", j.FileName, err)
+			return nil, err
+		}
+		originals = append(originals, name+"="+value)
+	}
+	defer func() {
+		klog.Infof("Restoring the queue attributes of %s", j.FileName)
+		if err := applyTuning(j.FileName, originals, false); err != nil {
+			klog.Errorf("Failed to restore the queue attributes of %s to %v: %v", j.FileName, originals, err)
+		}
+	}()
+	return j.Job.Do(ctx, executor, dryrun, handler)
+}
+
+// withTuning wraps the job of the device to restore the queue attributes which
+// are tuned by the work items.
+func withTuning(job Job, items []*WorkItem) Job {
+	seen := make(map[string]bool)
+	var names []string
+	for _, item := range items {
+		for _, setting := range item.Tuning {
+			name, _, _ := strings.Cut(setting, "=")
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return job
+	}
+	sortAttributes(names)
+	return &TunedJob{Job: job, FileName: items[0].FileName, Attributes: names}
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+	exectest "github.com/microyahoo/fio-benchmark/pkg/util/exec/test"
+	"github.com/microyahoo/fio-benchmark/pkg/util/sys"
+)
+
+func TestTuningSuite(t *testing.T) {
+	suite.Run(t, new(tuningTestSuite))
+}
+
+type tuningTestSuite struct {
+	suite.Suite
+	sysfs string
+}
+
+func (s *tuningTestSuite) SetupTest() {
+	s.sysfs = s.T().TempDir()
+	oldSysfs := sys.SysClassBlock
+	sys.SysClassBlock = s.sysfs
+	restoreDevices := mockBlockDevices("/dev/vdb")
+	s.T().Cleanup(func() {
+		sys.SysClassBlock = oldSysfs
+		restoreDevices()
+	})
+	s.NoError(os.MkdirAll(filepath.Join(s.sysfs, "vdb", "queue"), 0755))
+	s.writeAttribute("scheduler", "[none] mq-deadline kyber\n")
+	s.writeAttribute("nr_requests", "256\n")
+}
+
+func (s *tuningTestSuite) writeAttribute(name, value string) {
+	s.NoError(os.WriteFile(filepath.Join(s.sysfs, "vdb", "queue", name), []byte(value), 0644))
+}
+
+func (s *tuningTestSuite) attribute(name string) string {
+	value, err := sys.GetQueueAttribute("/dev/vdb", name)
+	s.NoError(err)
+	return value
+}
+
+func (s *tuningTestSuite) writeConfig(content string) string {
+	cfgFile := filepath.Join(s.T().TempDir(), "conf.yaml")
+	s.NoError(os.WriteFile(cfgFile, []byte(content), 0644))
+	return cfgFile
+}
+
+func (s *tuningTestSuite) TestProfiles() {
+	t := &TuningSettings{
+		Queue: map[string][]string{
+			"nr_requests": {"64", "256"},
+			"scheduler":   {"none", "mq-deadline"},
+		},
+		Devices: map[string]map[string][]string{
+			"nvme0n1": {"nr_requests": {"1023"}, "read_ahead_kb": {"0"}},
+		},
+	}
+	s.Equal([][]string{
+		{"scheduler=none", "nr_requests=64"},
+		{"scheduler=mq-deadline", "nr_requests=64"},
+		{"scheduler=none", "nr_requests=256"},
+		{"scheduler=mq-deadline", "nr_requests=256"},
+	}, t.Profiles("/dev/sdb"))
+	s.Equal([][]string{
+		{"scheduler=none", "nr_requests=1023", "read_ahead_kb=0"},
+		{"scheduler=mq-deadline", "nr_requests=1023", "read_ahead_kb=0"},
+	}, t.Profiles("/dev/nvme0n1"))
+	s.Nil((&TuningSettings{}).Profiles("/dev/sdb"))
+
+	queue := &WorkQueue{Queue: map[string][]*WorkItem{
+		"/dev/sdb": {
+			{FileName: "/dev/sdb", RW: "randread", BlockSize: "4K", IODepth: 1, NumJobs: 1},
+			{FileName: "/dev/sdb", RW: "randread", BlockSize: "4K", IODepth: 8, NumJobs: 1},
+		},
+	}}
+	queue.Tune(&TuningSettings{Queue: map[string][]string{"scheduler": {"none", "kyber"}}})
+	var names []string
+	for _, item := range queue.Queue["/dev/sdb"] {
+		names = append(names, item.String())
+	}
+	s.Equal([]string{
+		"sdb-randread-4K-1-1-scheduler=none",
+		"sdb-randread-4K-8-1-scheduler=none",
+		"sdb-randread-4K-1-1-scheduler=kyber",
+		"sdb-randread-4K-8-1-scheduler=kyber",
+	}, names)
+}
+
+func (s *tuningTestSuite) TestParseSettings() {
+	settings, err := ParseSettings(s.writeConfig(`
+fio_settings:
+  numjobs: [1]
+  bs: [4K]
+  iodepth: [1]
+  rw: [randread]
+  filename: [/dev/vdb]
+tuning:
+  queue:
+    scheduler: [none, mq-deadline]
+    nr_requests: [64, 256]
+  devices:
+    vdb:
+      read_ahead_kb: [0]
+`))
+	s.NoError(err)
+	s.Equal([]string{"64", "256"}, settings.Tuning.Queue["nr_requests"])
+	s.Len(settings.Tuning.Profiles("/dev/vdb"), 4)
+
+	for _, tuning := range []string{
+		"queue: {../scheduler: [none]}",
+		"queue: {scheduler: []}",
+		"devices: {vdb: {nr_requests: [\"\"]}}",
+	} {
+		_, err = ParseSettings(s.writeConfig(fmt.Sprintf(`
+fio_settings:
+  filename: [/dev/vdb]
+tuning: {%s}
+`, tuning)))
+		s.ErrorContains(err, "invalid tuning", tuning)
+	}
+
+	_, err = ParseSettings(s.writeConfig(`
+fio_settings:
+  numjobs: [1]
+  bs: [4K]
+  iodepth: [1]
+  rw: [randread]
+  filename: [/dev/vdb]
+slo:
+  percentile: 99
+  target_us: 1000
+tuning:
+  queue:
+    scheduler: [none, mq-deadline]
+`))
+	s.ErrorContains(err, "not supported by slo")
+}
+
+// tuningExecutor records the queue attributes of /dev/vdb when fio is run, the
+// server is closed after the first fio run if interrupt is true.
+func (s *tuningTestSuite) tuningExecutor(server *FioServer, interrupt bool, seen *[]string) *exectest.MockExecutor {
+	return &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(command string, args ...string) (string, error) {
+			if command == "lsblk" {
+				return `SIZE="53687091200" ROTA="0" RO="0" TYPE="disk" PKNAME="" NAME="/dev/vdb" KNAME="/dev/vdb" UUID=""`, nil
+			}
+			return "fio-3.27", nil
+		},
+		MockExecuteCommandWithContext: func(ctx context.Context, command string, args ...string) (string, error) {
+			*seen = append(*seen, s.attribute("scheduler")+"/"+s.attribute("nr_requests"))
+			if interrupt {
+				server.Close()
+				return "", ctx.Err()
+			}
+			return fmt.Sprintf(`{"jobs": [{"jobname": "test", "job options": {"filename": %q, "rw": "randread", "bs": "4K",
+				"iodepth": %q, "numjobs": "1"}, "read": {}, "write": {}, "trim": {}}]}`,
+				fioArg(args, "--filename"), fioArg(args, "--iodepth")), nil
+		},
+	}
+}
+
+func (s *tuningTestSuite) newServer(interrupt bool, seen *[]string) *FioServer {
+	cfgFile := s.writeConfig(`
+fio_settings:
+  numjobs: [1]
+  bs: [4K]
+  iodepth: [1, 8]
+  rw: [randread]
+  runtime: 10
+  filename: [/dev/vdb]
+tuning:
+  queue:
+    scheduler: [mq-deadline, kyber]
+    nr_requests: [64]
+`)
+	server, err := NewFioServer(WithChartFile(filepath.Join(s.T().TempDir(), "chart.html")), WithCfgFile(cfgFile),
+		WithOutputFile(filepath.Join(s.T().TempDir(), "output.txt")))
+	s.NoError(err)
+	server.Executor = s.tuningExecutor(server, interrupt, seen)
+	return server
+}
+
+func (s *tuningTestSuite) TestRun() {
+	var seen []string
+	server := s.newServer(false, &seen)
+	s.NoError(server.Run(make(chan struct{})))
+	s.Equal([]string{"mq-deadline/64", "mq-deadline/64", "kyber/64", "kyber/64"}, seen)
+	s.Equal("none", s.attribute("scheduler"))
+	s.Equal("256", s.attribute("nr_requests"))
+
+	s.Len(server.results, 4)
+	s.Equal([]string{"scheduler=mq-deadline", "nr_requests=64"}, server.results[0].Tuning)
+	s.Equal([]string{"scheduler=kyber", "nr_requests=64"}, server.results[3].Tuning)
+
+	csvFile := filepath.Join(s.T().TempDir(), "output.csv")
+	server.printResults(csvFile, "csv", nil)
+	f, err := os.Open(csvFile)
+	s.NoError(err)
+	defer f.Close()
+	parsed, err := client.ParseCSVResults(f)
+	s.NoError(err)
+	s.Len(parsed, 4)
+	for _, result := range parsed {
+		s.Len(result.Tuning, 2)
+		s.Equal("nr_requests=64", result.Tuning[1])
+	}
+}
+
+func (s *tuningTestSuite) TestRunInterrupted() {
+	var seen []string
+	server := s.newServer(true, &seen)
+	s.Error(server.Run(make(chan struct{})))
+	s.Equal([]string{"mq-deadline/64"}, seen)
+	s.Equal("none", s.attribute("scheduler"))
+	s.Equal("256", s.attribute("nr_requests"))
+	s.Empty(server.results)
+}
+
+func (s *tuningTestSuite) TestDryrun() {
+	var seen []string
+	server := s.newServer(false, &seen)
+	server.dryrun = true
+	s.NoError(server.Run(make(chan struct{})))
+	s.Empty(seen)
+	s.Equal("none", s.attribute("scheduler"))
+	s.Equal("256", s.attribute("nr_requests"))
+}
@@ -1,6 +1,17 @@
 package server
 
 import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
 	"k8s.io/klog/v2"
 
 	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
@@ -9,39 +20,187 @@ import (
 )
 
 type WorkItem struct {
-	FileName  string
-	NumJobs   int32
-	BlockSize string
-	IODepth   int32
-	RW        string
-	Runtime   uint64
-	Verify    bool
-	Direct    bool
-	IOEngine  string
+	ID        string `json:"id,omitempty" yaml:"id,omitempty"`
+	FileName  string `json:"filename" yaml:"filename"`
+	NumJobs   int32  `json:"numjobs" yaml:"numjobs"`
+	BlockSize string `json:"bs" yaml:"bs"`
+	IODepth   int32  `json:"iodepth" yaml:"iodepth"`
+	RW        string `json:"rw" yaml:"rw"`
+	Runtime   uint64 `json:"runtime" yaml:"runtime"`
+	Verify    bool   `json:"verify" yaml:"verify"`
+	Direct    bool   `json:"direct" yaml:"direct"`
+	IOEngine  string `json:"ioengine" yaml:"ioengine"`
+	Trial     int32  `json:"trial,omitempty" yaml:"trial,omitempty"` // starts from 1 if the work item is repeated
+
+	Percentiles []float64 `json:"percentiles,omitempty" yaml:"percentiles,omitempty"`
+
+	// LogAvgMsec logs the bandwidth, IOPS and latency averaged over every
+	// LogAvgMsec milliseconds into the time series of the result if positive
+	LogAvgMsec uint64 `json:"log_avg_msec,omitempty" yaml:"log_avg_msec,omitempty"`
+
+	// FioOptions are the extra fio options in the format of key=value
+	FioOptions []string `json:"fio_options,omitempty" yaml:"fio_options,omitempty"`
+
+	// Tuning are the block queue attributes written before the work item is run
+	// in the format of name=value, eg. scheduler=none
+	Tuning []string `json:"tuning,omitempty" yaml:"tuning,omitempty"`
+
+	// Hosts are the fio servers which run the work item at once by fio --client,
+	// eg. 10.0.0.1 or 10.0.0.1,8765, the work item is run locally if it's empty
+	Hosts []string `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+
+	// Job is the job section for the work item parsed from fio job file
+	Job *client.JobSection `json:"job,omitempty" yaml:"job,omitempty"`
 }
 
-type WorkItems []*WorkItem
+// fioArgs returns the extra fio arguments of the work item.
+func (wi *WorkItem) fioArgs() []string {
+	var args []string
+	if len(wi.Percentiles) > 0 {
+		args = append(args, "--percentile_list", client.PercentileList(wi.Percentiles))
+	}
+	for _, option := range wi.FioOptions {
+		args = append(args, "--"+option)
+	}
+	return args
+}
 
-func (wis WorkItems) Do(executor exec.Executor, dryrun bool) ([]*client.FioResult, error) {
-	var results []*client.FioResult
-	for _, wi := range wis {
+// clientArgs returns the fio arguments of the work item which are sent to the
+// fio servers.
+func (wi *WorkItem) clientArgs() []string {
+	if wi.Job != nil {
+		return client.FioJobArgs(wi.Job, wi.fioArgs()...)
+	}
+	return client.FioTestArgs(wi.FileName, wi.NumJobs, wi.BlockSize, wi.IODepth, wi.RW, wi.Runtime, wi.IOEngine, wi.Verify, wi.Direct, wi.fioArgs()...)
+}
+
+// Run tunes the device, drops the caches and runs fio for the work item, which
+// is run by the fio servers of the hosts if specified, the result is nil in
+// dryrun mode. The item observer carried by the context is notified once the
+// work item starts and stops running.
+func (wi *WorkItem) Run(ctx context.Context, executor exec.Executor, dryrun bool) (*client.FioResult, error) {
+	observer := itemObserverFrom(ctx)
+	if observer == nil {
+		return wi.run(ctx, executor, dryrun)
+	}
+	observer.itemStarted(wi)
+	result, err := wi.run(ctx, executor, dryrun)
+	if ctx.Err() != nil {
+		observer.itemStopped(wi, nil) // the interrupted work item isn't failed
+	} else {
+		observer.itemStopped(wi, err)
+	}
+	return result, err
+}
+
+func (wi *WorkItem) run(ctx context.Context, executor exec.Executor, dryrun bool) (*client.FioResult, error) {
+	if len(wi.Tuning) > 0 {
+		if err := applyTuning(wi.FileName, wi.Tuning, dryrun); err != nil {
+			return nil, err
+		}
+	}
+	if len(wi.Hosts) == 0 {
 		if e := client.DropCaches(executor); e != nil {
 			klog.Warningf("Failed to drop caches: %s", e)
 		}
-		result, err := client.FioTest(executor, wi.FileName, wi.NumJobs, wi.BlockSize, wi.IODepth, wi.RW, wi.Runtime, wi.IOEngine, wi.Verify, wi.Direct, dryrun)
+	}
+	var (
+		result    *client.FioResult
+		err       error
+		logPrefix string
+	)
+	args := wi.fioArgs()
+	if wi.LogAvgMsec > 0 && len(wi.Hosts) == 0 {
+		dir, err := os.MkdirTemp("", "fio-benchmark-logs-")
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create the directory of the fio logs")
+		}
+		defer os.RemoveAll(dir)
+		logPrefix = filepath.Join(dir, "fio")
+		args = append(args, client.TimeSeriesArgs(logPrefix, wi.LogAvgMsec)...)
+	}
+	if len(wi.Hosts) > 0 {
+		result, err = client.FioClientTest(ctx, executor, wi.Hosts, wi.clientArgs(), dryrun)
+	} else if wi.Job != nil {
+		result, err = client.FioJobTest(ctx, executor, wi.Job, dryrun, args...)
+	} else {
+		result, err = client.FioTest(ctx, executor, wi.FileName, wi.NumJobs, wi.BlockSize, wi.IODepth, wi.RW, wi.Runtime, wi.IOEngine, wi.Verify, wi.Direct, dryrun, args...)
+	}
+	if result != nil {
+		result.Tuning = wi.Tuning
+		if logPrefix != "" {
+			if result.TimeSeries, err = client.ParseTimeSeries(logPrefix, wi.LogAvgMsec); err != nil {
+				klog.Warningf("Failed to parse the fio logs of %s: %v", wi, err)
+				err = nil
+			}
+		}
+	}
+	return result, err
+}
+
+func (wi *WorkItem) String() string {
+	if wi.Job != nil {
+		return wi.Job.Name
+	}
+	name := fmt.Sprintf("%s-%s-%s-%d-%d", filepath.Base(wi.FileName), wi.RW, wi.BlockSize, wi.IODepth, wi.NumJobs)
+	if len(wi.Tuning) > 0 {
+		name = fmt.Sprintf("%s-%s", name, strings.Join(wi.Tuning, "-"))
+	}
+	if wi.Trial > 0 {
+		name = fmt.Sprintf("%s-t%d", name, wi.Trial)
+	}
+	return name
+}
+
+type WorkItems []*WorkItem
+
+// ItemHandler is called with the result once a work item is finished successfully,
+// or with nil result if the work item is skipped.
+type ItemHandler func(item *WorkItem, result *client.FioResult)
+
+func (wis WorkItems) Do(ctx context.Context, executor exec.Executor, dryrun bool, handler ItemHandler) ([]*client.FioResult, error) {
+	var results []*client.FioResult
+	for i, wi := range wis {
+		if ctx.Err() != nil {
+			klog.Infof("Skip the remaining %d work items of %s since benchmark is canceled", len(wis)-i, wi.FileName)
+			return results, ctx.Err()
+		}
+		result, err := wi.Run(ctx, executor, dryrun)
 		if err != nil {
 			klog.Warningf("Failed to do fio test: %v", err)
 			continue
 		}
 		if result != nil {
 			results = append(results, result)
+			if handler != nil {
+				handler(wi, result)
+			}
 		}
 	}
 	return results, nil
 }
 
 type WorkQueue struct {
-	Queue map[string][]*WorkItem // filename -> items
+	Queue map[string][]*WorkItem `json:"queue"` // filename -> items
+}
+
+// Keys returns the sorted keys of the queue.
+func (q *WorkQueue) Keys() []string {
+	keys := make([]string, 0, len(q.Queue))
+	for key := range q.Queue {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Len returns the number of work items in the queue.
+func (q *WorkQueue) Len() int {
+	var n int
+	for _, items := range q.Queue {
+		n += len(items)
+	}
+	return n
 }
 
 func NewWorkQueue(s *TestSettings, executor exec.Executor) (*WorkQueue, error) {
@@ -63,6 +222,7 @@ func NewWorkQueue(s *TestSettings, executor exec.Executor) (*WorkQueue, error) {
 							Verify:    fs.Verify,
 							Direct:    fs.Direct,
 							IOEngine:  fs.IOEngine,
+							Hosts:     s.Hosts,
 						}
 						items = append(items, item)
 					}
@@ -84,11 +244,10 @@ func NewWorkQueue(s *TestSettings, executor exec.Executor) (*WorkQueue, error) {
 		return nil, err
 	}
 	for _, d := range devices {
-		if d.Type != sys.DiskType || d.Bus == sys.DiskBusUsb || d.IsRoot {
-			continue
-		}
-		if !d.Empty || d.HasChildren {
-			klog.Infof("Skip non-empty device %s", d.RealPath)
+		if reason := IneligibleReason(d, s.DeviceSelector); reason != "" {
+			if d.Type == sys.DiskType {
+				klog.Infof("Skip device %s: %s", d.RealPath, reason)
+			}
 			continue
 		}
 		klog.Infof("Found a new device: %s", d.RealPath)
@@ -117,3 +276,78 @@ func NewWorkQueue(s *TestSettings, executor exec.Executor) (*WorkQueue, error) {
 	}
 	return &WorkQueue{queue}, nil
 }
+
+// Repeat repeats the work items of each key n times, all the work items are run
+// once before any of them is run again. The trials of each key are shuffled if
+// rnd is not nil.
+func (q *WorkQueue) Repeat(n int32, rnd *rand.Rand) {
+	for key, items := range q.Queue {
+		var trials []*WorkItem
+		for i := int32(1); i <= n; i++ {
+			for _, item := range items {
+				trial := *item
+				trial.Trial = i
+				trials = append(trials, &trial)
+			}
+		}
+		if rnd != nil {
+			rnd.Shuffle(len(trials), func(i, j int) { trials[i], trials[j] = trials[j], trials[i] })
+		}
+		q.Queue[key] = trials
+	}
+}
+
+// NewJobFileQueues creates a work queue for each stonewall group of the
+// fio job file, the queues should be run one after another.
+func NewJobFileQueues(jobFile string) ([]*WorkQueue, error) {
+	f, err := client.ParseJobFile(jobFile)
+	if err != nil {
+		return nil, err
+	}
+	var queues []*WorkQueue
+	for _, group := range f.Groups() {
+		queue := make(map[string][]*WorkItem)
+		for _, job := range group {
+			name := job.Name
+			for i := 1; ; i++ {
+				if _, ok := queue[name]; !ok {
+					break
+				}
+				name = fmt.Sprintf("%s-%d", job.Name, i)
+			}
+			queue[name] = []*WorkItem{newJobFileItem(job)}
+		}
+		queues = append(queues, &WorkQueue{queue})
+	}
+	return queues, nil
+}
+
+func newJobFileItem(job *client.JobSection) *WorkItem {
+	item := &WorkItem{Job: job}
+	item.FileName, _ = job.Option("filename")
+	if dir, ok := job.Option("directory"); ok && !filepath.IsAbs(item.FileName) {
+		item.FileName = filepath.Join(dir, item.FileName)
+	}
+	item.BlockSize, _ = job.Option("bs")
+	item.RW, _ = job.Option("rw")
+	item.IOEngine, _ = job.Option("ioengine")
+	if v, ok := job.Option("numjobs"); ok {
+		n, _ := strconv.ParseInt(v, 10, 32)
+		item.NumJobs = int32(n)
+	}
+	if v, ok := job.Option("iodepth"); ok {
+		n, _ := strconv.ParseInt(v, 10, 32)
+		item.IODepth = int32(n)
+	}
+	if v, ok := job.Option("runtime"); ok {
+		d, _ := client.ParseFioDuration(v)
+		item.Runtime = uint64(d / time.Second)
+	}
+	if v, ok := job.Option("direct"); ok {
+		item.Direct = v == "1"
+	}
+	if v, ok := job.Option("verify"); ok {
+		item.Verify = v != "0"
+	}
+	return item
+}
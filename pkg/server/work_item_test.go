@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	exectest "github.com/microyahoo/fio-benchmark/pkg/util/exec/test"
+)
+
+func TestWorkItemSuite(t *testing.T) {
+	suite.Run(t, new(workItemTestSuite))
+}
+
+type workItemTestSuite struct {
+	suite.Suite
+}
+
+func (s *workItemTestSuite) TestTimeSeries() {
+	dataFile := filepath.Join(s.T().TempDir(), "fio.db")
+	cfgFile := filepath.Join(s.T().TempDir(), "conf.yaml")
+	s.NoError(os.WriteFile(cfgFile, []byte(fmt.Sprintf(`
+fio_settings:
+  numjobs: [2]
+  bs: [4K]
+  iodepth: [1]
+  rw: [randwrite]
+  runtime: 10
+  filename: [%s]
+  log_avg_msec: 500
+`, dataFile)), 0644))
+	var logPrefix string
+	output := filepath.Join(s.T().TempDir(), "output.txt")
+	server, err := NewFioServer(WithCfgFile(cfgFile), WithOutputFile(output),
+		WithChartFile(filepath.Join(s.T().TempDir(), "chart.html")))
+	s.Require().NoError(err)
+	server.Executor = &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(command string, args ...string) (string, error) {
+			return "fio-3.27", nil
+		},
+		MockExecuteCommandWithContext: func(ctx context.Context, command string, args ...string) (string, error) {
+			s.Equal("500", fioArg(args, "--log_avg_msec"))
+			logPrefix = fioArg(args, "--write_bw_log")
+			s.Equal(logPrefix, fioArg(args, "--write_iops_log"))
+			s.Equal(logPrefix, fioArg(args, "--write_lat_log"))
+			for i := 1; i <= 2; i++ {
+				s.NoError(os.WriteFile(fmt.Sprintf("%s_iops.%d.log", logPrefix, i), []byte("500, 50, 1, 4096, 0\n1000, 10, 1, 4096, 0\n"), 0644))
+			}
+			return `{"jobs": [{"jobname": "randwrite", "job options": {"rw": "randwrite"}, "read": {}, "write": {"iops_mean": 60}, "trim": {}}]}`, nil
+		},
+	}
+	s.NoError(server.Run(make(chan struct{})))
+	s.Require().Len(server.results, 1)
+	series := server.results[0].TimeSeries
+	s.Require().Len(series, 1)
+	s.Equal("write", series[0].Direction)
+	s.Equal([]float64{100, 20}, series[0].IOPS)
+	s.Equal(50.0, series[0].Stability.IOPSBelow)
+
+	// the logs are removed once they are parsed
+	_, err = os.Stat(filepath.Dir(logPrefix))
+	s.True(os.IsNotExist(err))
+	data, err := os.ReadFile(output)
+	s.NoError(err)
+	s.True(strings.Contains(string(data), "IOPS-BELOW-90%-MEAN(%)"), string(data))
+
+	_, err = LoadSettings([]byte("fio_settings: {filename: [/dev/vdb], log_avg_msec: 1000}\nhosts: [10.0.0.1]\n"))
+	s.EqualError(err, "log_avg_msec is not supported by hosts")
+}
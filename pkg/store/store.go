@@ -0,0 +1,368 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+	"github.com/microyahoo/fio-benchmark/pkg/util/sys"
+)
+
+const (
+	recordExt  = ".json"
+	summaryDir = "summaries" // summaries of the records named by their ids
+)
+
+// ErrNotFound is returned if there is no record with the id.
+var ErrNotFound = errors.New("record not found")
+
+// Record is a finished run saved in the store.
+type Record struct {
+	ID          string                     `json:"id"`
+	CreatedAt   time.Time                  `json:"created_at"`
+	ConfigFile  string                     `json:"config_file,omitempty"` // path of the config file or the job file
+	Config      string                     `json:"config,omitempty"`      // content of the config file or the job file
+	Interrupted bool                       `json:"interrupted,omitempty"`
+	Host        *sys.HostInfo              `json:"host,omitempty"`
+	Devices     map[string]*client.Device  `json:"devices,omitempty"` // keyed by the filename
+	Percentiles []float64                  `json:"percentiles,omitempty"`
+	Results     []*client.FioResult        `json:"results"`
+	Aggregated  []*client.AggregatedResult `json:"aggregated,omitempty"`
+}
+
+// Summary is the small index of a record, which the records are listed and
+// filtered by without loading the full results.
+type Summary struct {
+	ID          string       `json:"id"`
+	CreatedAt   time.Time    `json:"created_at"`
+	ConfigFile  string       `json:"config_file,omitempty"`
+	Interrupted bool         `json:"interrupted,omitempty"`
+	Hostname    string       `json:"hostname,omitempty"`
+	Results     int          `json:"results"`
+	Keys        []*ResultKey `json:"keys,omitempty"` // distinct keys of the jobs of the results
+}
+
+// ResultKey is what a job of the results is filtered by.
+type ResultKey struct {
+	FileName  string `json:"filename,omitempty"`
+	Model     string `json:"model,omitempty"`
+	RW        string `json:"rw,omitempty"`
+	BlockSize string `json:"bs,omitempty"`
+}
+
+func resultKey(result *client.FioResult, job *client.FioJob) *ResultKey {
+	key := &ResultKey{}
+	if result.Device != nil {
+		key.Model = result.Device.Model
+	}
+	if job.JobOptions != nil {
+		key.FileName = job.JobOptions.FileName
+		key.RW = job.JobOptions.RW
+		key.BlockSize = job.JobOptions.BlockSize
+	}
+	return key
+}
+
+// NewID returns a unique id which is sorted by the time, eg. 20260102-150405-1a2b3c4d.
+func NewID(t time.Time) string {
+	return t.Format("20060102-150405") + "-" + uuid.NewString()[:8]
+}
+
+// Store saves the records as json files in a local directory, one file per
+// record named by its id.
+type Store struct {
+	dir string
+}
+
+// DefaultDir returns the default directory of the store, which is
+// $XDG_DATA_HOME/fio-benchmark or ~/.local/share/fio-benchmark.
+func DefaultDir() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "fio-benchmark")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "share", "fio-benchmark")
+}
+
+// Open opens the store in the directory, which is created if it doesn't exist.
+func Open(dir string) (*Store, error) {
+	if dir == "" {
+		return nil, errors.New("store directory is not specified")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "failed to open store %s", dir)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Dir returns the directory of the store.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Save saves the record, the id and the creation time are set if they are empty.
+func (s *Store) Save(record *Record) error {
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+	if record.ID == "" {
+		record.ID = NewID(record.CreatedAt)
+	}
+	if err := writeJSON(s.path(record.ID), record); err != nil {
+		return err
+	}
+	return s.saveSummary(record.Summary())
+}
+
+func (s *Store) saveSummary(summary *Summary) error {
+	if err := os.MkdirAll(filepath.Join(s.dir, summaryDir), 0755); err != nil {
+		return err
+	}
+	return writeJSON(s.summaryPath(summary.ID), summary)
+}
+
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Get loads the record with the id.
+func (s *Store) Get(id string) (*Record, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return nil, errors.Wrapf(ErrNotFound, "invalid id %q", id)
+	}
+	data, err := os.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, errors.Wrapf(ErrNotFound, "id %s", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var record Record
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse record %s", id)
+	}
+	return &record, nil
+}
+
+// List returns the summaries of the records matched by the filter in the order
+// of creation, all the records are listed if the filter is nil. The records
+// which can't be loaded are skipped.
+func (s *Store) List(filter *Filter) ([]*Summary, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var summaries []*Summary
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, recordExt) {
+			continue
+		}
+		id := strings.TrimSuffix(name, recordExt)
+		summary, err := s.summary(id)
+		if err != nil {
+			klog.Warningf("Skip record %s: %v", id, err)
+			continue
+		}
+		if filter.Match(summary) {
+			summaries = append(summaries, summary)
+		}
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return summaries[i].CreatedAt.Before(summaries[j].CreatedAt)
+	})
+	return summaries, nil
+}
+
+// summary loads the summary of the record, which is built from the record and
+// saved if it's missing, eg. the record was saved by the previous versions.
+func (s *Store) summary(id string) (*Summary, error) {
+	if data, err := os.ReadFile(s.summaryPath(id)); err == nil {
+		var summary Summary
+		if err = json.Unmarshal(data, &summary); err == nil && summary.ID == id {
+			return &summary, nil
+		}
+	}
+	record, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	summary := record.Summary()
+	if err = s.saveSummary(summary); err != nil {
+		klog.Warningf("Failed to save the summary of record %s: %v", id, err)
+	}
+	return summary, nil
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+recordExt)
+}
+
+func (s *Store) summaryPath(id string) string {
+	return filepath.Join(s.dir, summaryDir, id+recordExt)
+}
+
+// Filter matches the records and their results, the empty fields match all.
+type Filter struct {
+	Device    string // filename or its base name, eg. /dev/nvme0n1 or nvme0n1
+	Model     string // case-insensitive substring of the device model
+	RW        string
+	BlockSize string
+	Since     time.Time
+	Until     time.Time
+}
+
+// Match returns true if the record is created in the time range and any job of
+// its results is matched.
+func (f *Filter) Match(summary *Summary) bool {
+	if f == nil {
+		return true
+	}
+	if !f.Since.IsZero() && summary.CreatedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && summary.CreatedAt.After(f.Until) {
+		return false
+	}
+	for _, key := range summary.Keys {
+		if f.matchKey(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Results returns the results matched by the filter.
+func (f *Filter) Results(results []*client.FioResult) []*client.FioResult {
+	var matched []*client.FioResult
+	for _, result := range results {
+		if f.MatchResult(result) {
+			matched = append(matched, result)
+		}
+	}
+	return matched
+}
+
+// MatchResult returns true if any job of the result is matched.
+func (f *Filter) MatchResult(result *client.FioResult) bool {
+	if f == nil {
+		return true
+	}
+	for _, job := range result.Jobs {
+		if f.matchKey(resultKey(result, job)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Filter) matchKey(key *ResultKey) bool {
+	if f.Model != "" && !strings.Contains(strings.ToLower(key.Model), strings.ToLower(f.Model)) {
+		return false
+	}
+	if f.Device != "" && key.FileName != f.Device && filepath.Base(key.FileName) != f.Device {
+		return false
+	}
+	if f.RW != "" && key.RW != f.RW {
+		return false
+	}
+	if f.BlockSize != "" && !strings.EqualFold(key.BlockSize, f.BlockSize) {
+		return false
+	}
+	return true
+}
+
+// Summary returns the summary of the record.
+func (r *Record) Summary() *Summary {
+	summary := &Summary{
+		ID:          r.ID,
+		CreatedAt:   r.CreatedAt,
+		ConfigFile:  r.ConfigFile,
+		Interrupted: r.Interrupted,
+		Results:     len(r.Results),
+	}
+	if r.Host != nil {
+		summary.Hostname = r.Host.Hostname
+	}
+	seen := make(map[ResultKey]bool)
+	for _, result := range r.Results {
+		for _, job := range result.Jobs {
+			key := resultKey(result, job)
+			if !seen[*key] {
+				seen[*key] = true
+				summary.Keys = append(summary.Keys, key)
+			}
+		}
+	}
+	return summary
+}
+
+// Values returns the sorted distinct filenames, device models, rw and bs of the results.
+func (s *Summary) Values() (filenames, models, rws, bss []string) {
+	add := func(values []string, value string) []string {
+		if value == "" {
+			return values
+		}
+		for _, v := range values {
+			if v == value {
+				return values
+			}
+		}
+		return append(values, value)
+	}
+	for _, key := range s.Keys {
+		filenames = add(filenames, key.FileName)
+		models = add(models, key.Model)
+		rws = add(rws, key.RW)
+		bss = add(bss, key.BlockSize)
+	}
+	for _, values := range [][]string{filenames, models, rws, bss} {
+		sort.Strings(values)
+	}
+	return
+}
+
+// Filtered returns a copy of the record with only the results matched by the filter.
+func (r *Record) Filtered(filter *Filter) *Record {
+	record := *r
+	record.Results = filter.Results(r.Results)
+	record.Aggregated = nil
+	for _, a := range r.Aggregated {
+		if filter.MatchResult(a.MeanResult()) {
+			record.Aggregated = append(record.Aggregated, a)
+		}
+	}
+	return &record
+}
+
+// ChartResults returns the results to render the charts, which are the means of
+// the aggregated results if the work items were repeated.
+func (r *Record) ChartResults() []*client.FioResult {
+	if len(r.Aggregated) == 0 {
+		return r.Results
+	}
+	results := make([]*client.FioResult, 0, len(r.Aggregated))
+	for _, a := range r.Aggregated {
+		results = append(results, a.MeanResult())
+	}
+	return results
+}
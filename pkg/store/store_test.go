@@ -0,0 +1,130 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/microyahoo/fio-benchmark/pkg/daemon/client"
+	"github.com/microyahoo/fio-benchmark/pkg/util/sys"
+)
+
+func TestStoreSuite(t *testing.T) {
+	suite.Run(t, new(storeTestSuite))
+}
+
+type storeTestSuite struct {
+	suite.Suite
+}
+
+func newResult(filename, model, rw, bs string) *client.FioResult {
+	return &client.FioResult{
+		Device: &client.Device{Model: model},
+		Jobs: []*client.FioJob{{
+			JobName:    rw,
+			JobOptions: &client.JobOptions{FileName: filename, RW: rw, BlockSize: bs},
+		}},
+	}
+}
+
+func (s *storeTestSuite) TestSaveAndList() {
+	store, err := Open(filepath.Join(s.T().TempDir(), "store"))
+	s.Require().NoError(err)
+	day := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	nvme := &Record{
+		CreatedAt: day,
+		Host:      &sys.HostInfo{Hostname: "node1"},
+		Results: []*client.FioResult{
+			newResult("/dev/nvme0n1", "Samsung SSD 980", "randread", "4K"),
+			newResult("/dev/nvme0n1", "Samsung SSD 980", "randwrite", "4K"),
+		},
+	}
+	s.NoError(store.Save(nvme))
+	s.Regexp(`^20260102-150405-[0-9a-f]{8}$`, nvme.ID)
+	hdd := &Record{
+		CreatedAt: day.AddDate(0, 0, 1),
+		Results:   []*client.FioResult{newResult("/dev/sdb", "ST4000NM", "read", "4M")},
+	}
+	s.NoError(store.Save(hdd))
+	s.NoError(os.WriteFile(filepath.Join(store.Dir(), "README"), nil, 0644))
+
+	record, err := store.Get(nvme.ID)
+	s.NoError(err)
+	s.Equal("node1", record.Host.Hostname)
+	s.Len(record.Results, 2)
+	_, err = store.Get("unknown")
+	s.ErrorIs(err, ErrNotFound)
+	_, err = store.Get("../store")
+	s.ErrorIs(err, ErrNotFound)
+
+	ids := func(filter *Filter) []string {
+		summaries, err := store.List(filter)
+		s.NoError(err)
+		var ids []string
+		for _, r := range summaries {
+			ids = append(ids, r.ID)
+		}
+		return ids
+	}
+	s.Equal([]string{nvme.ID, hdd.ID}, ids(nil))
+	s.Equal([]string{nvme.ID}, ids(&Filter{Device: "nvme0n1"}))
+	s.Equal([]string{hdd.ID}, ids(&Filter{Device: "/dev/sdb"}))
+	s.Equal([]string{nvme.ID}, ids(&Filter{Model: "samsung", RW: "randwrite", BlockSize: "4k"}))
+	s.Empty(ids(&Filter{Model: "samsung", RW: "read"}))
+	s.Equal([]string{hdd.ID}, ids(&Filter{Since: day.Add(time.Hour)}))
+	s.Equal([]string{nvme.ID}, ids(&Filter{Until: day.Add(time.Hour)}))
+
+	filtered := record.Filtered(&Filter{RW: "randwrite"})
+	s.Len(filtered.Results, 1)
+	s.Len(record.Results, 2)
+	summary := record.Summary()
+	s.Equal(2, summary.Results)
+	s.Equal("node1", summary.Hostname)
+	filenames, models, rws, bss := summary.Values()
+	s.Equal([]string{"/dev/nvme0n1"}, filenames)
+	s.Equal([]string{"Samsung SSD 980"}, models)
+	s.Equal([]string{"randread", "randwrite"}, rws)
+	s.Equal([]string{"4K"}, bss)
+}
+
+func (s *storeTestSuite) TestListSummaries() {
+	store, err := Open(filepath.Join(s.T().TempDir(), "store"))
+	s.Require().NoError(err)
+	day := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	nvme := &Record{CreatedAt: day, Results: []*client.FioResult{newResult("/dev/nvme0n1", "Samsung SSD 980", "randread", "4K")}}
+	s.NoError(store.Save(nvme))
+	hdd := &Record{CreatedAt: day.AddDate(0, 0, 1), Results: []*client.FioResult{newResult("/dev/sdb", "ST4000NM", "read", "4M")}}
+	s.NoError(store.Save(hdd))
+
+	// the records are filtered by their summaries without loading the results
+	s.NoError(os.WriteFile(store.path(nvme.ID), []byte("{"), 0644))
+	summaries, err := store.List(&Filter{Model: "samsung"})
+	s.NoError(err)
+	s.Require().Len(summaries, 1)
+	s.Equal(nvme.ID, summaries[0].ID)
+	_, err = store.Get(nvme.ID)
+	s.Error(err)
+
+	// the summary missing is built from the record, and the bad record is skipped
+	s.NoError(os.Remove(store.summaryPath(nvme.ID)))
+	s.NoError(os.Remove(store.summaryPath(hdd.ID)))
+	summaries, err = store.List(nil)
+	s.NoError(err)
+	s.Require().Len(summaries, 1)
+	s.Equal(hdd.ID, summaries[0].ID)
+	s.FileExists(store.summaryPath(hdd.ID))
+}
+
+func (s *storeTestSuite) TestChartResults() {
+	trial := newResult("/dev/vdb", "", "randread", "4K")
+	record := &Record{Results: []*client.FioResult{trial, trial}}
+	s.Equal(record.Results, record.ChartResults())
+	record.Aggregated = client.AggregateResults(record.Results, 0)
+	s.Len(record.Aggregated, 1)
+	results := record.ChartResults()
+	s.Len(results, 1)
+	s.Equal("/dev/vdb", results[0].Jobs[0].JobOptions.FileName)
+}
@@ -3,6 +3,7 @@ package exec
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -10,6 +11,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/pkg/errors"
@@ -25,8 +27,13 @@ type Executor interface {
 	ExecuteCommandWithOutput(command string, arg ...string) (string, error)
 	ExecuteCommandWithCombinedOutput(command string, arg ...string) (string, error)
 	ExecuteCommandWithTimeout(timeout time.Duration, command string, arg ...string) (string, error)
+	ExecuteCommandWithContext(ctx context.Context, command string, arg ...string) (string, error)
 }
 
+// InterruptGracePeriod is the period to wait for the process to exit after the
+// interrupt signal was sent, the process will be killed after that.
+var InterruptGracePeriod = 10 * time.Second
+
 // CommandExecutor is the type of the Executor
 type CommandExecutor struct{}
 
@@ -103,6 +110,58 @@ func (*CommandExecutor) ExecuteCommandWithTimeout(timeout time.Duration, command
 	}
 }
 
+// ExecuteCommandWithContext starts a process and wait for its completion with output.
+// If the context is done before the process returns, an interrupt signal is sent to
+// the process group, and it will be killed if it doesn't return within InterruptGracePeriod.
+func (*CommandExecutor) ExecuteCommandWithContext(ctx context.Context, command string, arg ...string) (string, error) {
+	logCommand(command, arg...)
+	cmd := exec.Command(command, arg...)
+	// run in a separate process group, so that the forked processes can be signaled
+	// together and the interrupt from terminal won't be delivered to it directly
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			if ee, ok := err.(*exec.ExitError); ok {
+				ee.Stderr = stderr.Bytes()
+			}
+			return strings.TrimSpace(stdout.String()), err
+		}
+		return strings.TrimSpace(stdout.String()), nil
+	case <-ctx.Done():
+	}
+
+	pgid := -cmd.Process.Pid
+	klog.Infof("context is done, sending interrupt signal to the process %s", command)
+	if err := syscall.Kill(pgid, syscall.SIGINT); err != nil {
+		klog.Errorf("Failed to send interrupt signal to process %s: %v", command, err)
+	}
+	select {
+	case <-done:
+	case <-time.After(InterruptGracePeriod):
+		klog.Infof("timeout waiting for process %s to return after interrupt signal was sent. Sending kill signal to the process", command)
+		if err := syscall.Kill(pgid, syscall.SIGKILL); err != nil {
+			klog.Errorf("Failed to kill process %s: %v", command, err)
+		}
+		<-done
+	}
+	return strings.TrimSpace(stdout.String()), errors.Wrapf(ctx.Err(), "command %s is canceled", command)
+}
+
 // ExecuteCommandWithOutput executes a command with output
 func (*CommandExecutor) ExecuteCommandWithOutput(command string, arg ...string) (string, error) {
 	logCommand(command, arg...)
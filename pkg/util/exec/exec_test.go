@@ -1,8 +1,10 @@
 package exec
 
 import (
+	"context"
 	"os/exec"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
@@ -95,3 +97,45 @@ func TestExtractExitCode(t *testing.T) {
 		})
 	}
 }
+
+func TestExecuteCommandWithContext(t *testing.T) {
+	executor := &CommandExecutor{}
+
+	output, err := executor.ExecuteCommandWithContext(context.Background(), "echo", "hello")
+	if err != nil || output != "hello" {
+		t.Fatalf("ExecuteCommandWithContext() = %q, %v, want hello", output, err)
+	}
+
+	_, err = executor.ExecuteCommandWithContext(context.Background(), "sh", "-c", "echo oops >&2; exit 3")
+	if code, _ := ExtractExitCode(err); code != 3 {
+		t.Fatalf("ExecuteCommandWithContext() exit code = %d, want 3", code)
+	}
+	if got := assertErrorType(err); got != "oops\n" {
+		t.Fatalf("ExecuteCommandWithContext() stderr = %q, want oops", got)
+	}
+
+	gracePeriod := InterruptGracePeriod
+	defer func() { InterruptGracePeriod = gracePeriod }()
+	InterruptGracePeriod = 200 * time.Millisecond
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"interrupted", []string{"-c", "sleep 10"}},
+		{"killed", []string{"-c", "trap '' INT; sleep 10"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			_, err := executor.ExecuteCommandWithContext(ctx, "sh", tt.args...)
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("ExecuteCommandWithContext() error = %v, want %v", err, context.DeadlineExceeded)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("ExecuteCommandWithContext() took %s", elapsed)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package test
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -17,6 +18,7 @@ type MockExecutor struct {
 	MockExecuteCommandWithOutput         func(command string, arg ...string) (string, error)
 	MockExecuteCommandWithCombinedOutput func(command string, arg ...string) (string, error)
 	MockExecuteCommandWithTimeout        func(timeout time.Duration, command string, arg ...string) (string, error)
+	MockExecuteCommandWithContext        func(ctx context.Context, command string, arg ...string) (string, error)
 }
 
 // ExecuteCommand mocks ExecuteCommand
@@ -56,6 +58,16 @@ func (e *MockExecutor) ExecuteCommandWithTimeout(timeout time.Duration, command
 	return "", nil
 }
 
+// ExecuteCommandWithContext mocks ExecuteCommandWithContext, it falls back to
+// MockExecuteCommandWithOutput if MockExecuteCommandWithContext is not set
+func (e *MockExecutor) ExecuteCommandWithContext(ctx context.Context, command string, arg ...string) (string, error) {
+	if e.MockExecuteCommandWithContext != nil {
+		return e.MockExecuteCommandWithContext(ctx, command, arg...)
+	}
+
+	return e.ExecuteCommandWithOutput(command, arg...)
+}
+
 // ExecuteCommandWithCombinedOutput mocks ExecuteCommandWithCombinedOutput
 func (e *MockExecutor) ExecuteCommandWithCombinedOutput(command string, arg ...string) (string, error) {
 	if e.MockExecuteCommandWithCombinedOutput != nil {
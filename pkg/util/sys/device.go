@@ -104,6 +104,8 @@ type LocalDevice struct {
 	Vendor string `json:"vendor"`
 	// Model is the device model
 	Model string `json:"model"`
+	// Firmware is the firmware revision of the device
+	Firmware string `json:"firmware,omitempty"`
 	// PathID is the path id of the device
 	PathID string `json:"path_id"`
 	// WWN is the world wide name of the device
@@ -45,11 +45,25 @@ func GetDeviceEmpty(device *LocalDevice) bool {
 }
 
 func ignoreDevice(d string) bool {
+	return IsRBDDevice(d)
+}
+
+// IsRBDDevice returns whether the device is a ceph rbd device
+func IsRBDDevice(d string) bool {
 	return isRBD.MatchString(d)
 }
 
 // DiscoverDevices returns all the details of devices available on the local node
 func DiscoverDevices(executor exec.Executor) (map[string]*LocalDevice, error) {
+	return discoverDevices(executor, false)
+}
+
+// DiscoverAllDevices returns all the details of devices including the ignored ones, eg. rbd devices
+func DiscoverAllDevices(executor exec.Executor) (map[string]*LocalDevice, error) {
+	return discoverDevices(executor, true)
+}
+
+func discoverDevices(executor exec.Executor, all bool) (map[string]*LocalDevice, error) {
 	output, err := executor.ExecuteCommandWithOutput("lsblk", "--all", "--bytes", "--pairs",
 		"--paths", "--output", "SIZE,ROTA,RO,TYPE,PKNAME,NAME,KNAME,UUID,WWN,MOUNTPOINT")
 	if err != nil {
@@ -81,7 +95,7 @@ func DiscoverDevices(executor exec.Executor) (map[string]*LocalDevice, error) {
 
 	for name, d := range deviceProps {
 		// Ignore RBD device
-		if ignoreDevice(name) {
+		if !all && ignoreDevice(name) {
 			// skip device
 			klog.Warningf("skipping rbd device %q", name)
 			continue
@@ -236,6 +250,9 @@ func PopulateDeviceUdevInfo(executor exec.Executor, device string, disk *LocalDe
 	if val, ok := udevInfo["ID_MODEL"]; ok {
 		disk.Model = val
 	}
+	if val, ok := udevInfo["ID_REVISION"]; ok {
+		disk.Firmware = val
+	}
 	if val, ok := udevInfo["ID_WWN_WITH_EXTENSION"]; ok {
 		disk.WWNVendorExtension = val
 	}
@@ -247,3 +264,111 @@ func PopulateDeviceUdevInfo(executor exec.Executor, device string, disk *LocalDe
 	}
 	return disk, nil
 }
+
+// SysClassBlock is the sysfs directory of the block devices
+var SysClassBlock = "/sys/class/block"
+
+// GetDeviceHolders returns the holders of the device from sysfs, eg. the dm
+// devices of LVM or dm-crypt which are built on it.
+func GetDeviceHolders(device string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(SysClassBlock, filepath.Base(device), "holders"))
+	if err != nil {
+		return nil, err
+	}
+	var holders []string
+	for _, e := range entries {
+		holders = append(holders, e.Name())
+	}
+	return holders, nil
+}
+
+// DeviceUsage is how a block device is being used.
+type DeviceUsage struct {
+	Device      *LocalDevice
+	MountPoints []string // mount points of the device and its children
+	Holders     []string
+	Children    []string // the partitions, LVM and dm devices built on the device
+}
+
+// GetDeviceUsage returns the details of the device and how it's being used.
+func GetDeviceUsage(executor exec.Executor, device string) (*DeviceUsage, error) {
+	output, err := executor.ExecuteCommandWithOutput("lsblk", device, "--bytes", "--pairs",
+		"--paths", "--output", "SIZE,ROTA,RO,TYPE,PKNAME,NAME,KNAME,UUID,WWN,MOUNTPOINT")
+	if err != nil {
+		return nil, perrors.Wrapf(err, "failed to execute lsblk for %s", device)
+	}
+	var (
+		names []string
+		props = make(map[string][]map[string]string)
+	)
+	for _, line := range strings.Split(output, "\n") {
+		p := parseKeyValuePairString(line)
+		name := p["NAME"]
+		if name == "" {
+			continue
+		}
+		if _, ok := props[name]; !ok {
+			names = append(names, name)
+		}
+		props[name] = append(props[name], p)
+	}
+	if len(names) == 0 {
+		return nil, perrors.Errorf("device %s is not found by lsblk", device)
+	}
+	// the device itself is the first one, followed by its children
+	disk, err := PopulateDeviceInfo(props[names[0]])
+	if err != nil {
+		return nil, err
+	}
+	if disk, err = PopulateDeviceUdevInfo(executor, disk.RealPath, disk); err != nil {
+		klog.Warningf("failed to get udev info for device %q. %v", disk.RealPath, err)
+	}
+	disk.Partitions, _, err = GetDevicePartitions(executor, disk.RealPath)
+	if err != nil {
+		return nil, err
+	}
+	usage := &DeviceUsage{Device: disk, Children: names[1:]}
+	disk.HasChildren = len(usage.Children) > 0
+	disk.Empty = GetDeviceEmpty(disk)
+	for _, name := range names {
+		for _, p := range props[name] {
+			if p["MOUNTPOINT"] != "" {
+				usage.MountPoints = append(usage.MountPoints, p["MOUNTPOINT"])
+			}
+		}
+	}
+	kernelName := disk.KernelName
+	if kernelName == "" {
+		kernelName = disk.RealPath
+	}
+	usage.Holders, err = GetDeviceHolders(kernelName)
+	if err != nil && !os.IsNotExist(err) {
+		klog.Warningf("failed to get holders of device %q. %v", kernelName, err)
+	}
+	return usage, nil
+}
+
+// Reasons returns the reasons why the device is in use, which is empty if the
+// device can be overwritten safely.
+func (u *DeviceUsage) Reasons() []string {
+	var reasons []string
+	if len(u.MountPoints) > 0 {
+		reasons = append(reasons, fmt.Sprintf("mounted on %s", strings.Join(u.MountPoints, ",")))
+	}
+	if len(u.Holders) > 0 {
+		reasons = append(reasons, fmt.Sprintf("held by %s", strings.Join(u.Holders, ",")))
+	}
+	if len(u.Children) > 0 {
+		reasons = append(reasons, fmt.Sprintf("has children %s", strings.Join(u.Children, ",")))
+	}
+	if u.Device.Type == LVMType {
+		reasons = append(reasons, "is a logical volume")
+	}
+	if u.Device.Filesystem != "" {
+		reasons = append(reasons, fmt.Sprintf("has %s signature", u.Device.Filesystem))
+	}
+	if len(u.Device.Partitions) > 0 {
+		reasons = append(reasons, fmt.Sprintf("has %d partitions", len(u.Device.Partitions)))
+	}
+	return reasons
+}
@@ -2,6 +2,9 @@ package sys_test
 
 import (
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
@@ -593,4 +596,56 @@ USEC_INITIALIZED=2851184`
 		},
 	}
 	s.Equal(expectedInfos, deviceInfos)
+
+	allInfos, err := sys.DiscoverAllDevices(executor)
+	s.NoError(err)
+	s.Len(allInfos, len(deviceInfos)+2)
+	s.Contains(allInfos, "/dev/rbd0")
+	s.Contains(allInfos, "rbd1")
+}
+
+func (s *diskSuite) TestGetDeviceUsage() {
+	sysfs := s.T().TempDir()
+	defer func(old string) { sys.SysClassBlock = old }(sys.SysClassBlock)
+	sys.SysClassBlock = sysfs
+	s.NoError(os.MkdirAll(filepath.Join(sysfs, "vdb", "holders", "dm-5"), 0755))
+	s.NoError(os.MkdirAll(filepath.Join(sysfs, "vdc", "holders"), 0755))
+
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(command string, arg ...string) (string, error) {
+			switch {
+			case command == "udevadm" && arg[2] == "/dev/vdb":
+				return "ID_FS_TYPE=LVM2_member\nID_SERIAL=8560782279146-1", nil
+			case command == "udevadm":
+				return "ID_SERIAL=8560782279146-2\nID_WWN=0x5000c500a1b2c3d4", nil
+			case command == "lsblk" && arg[len(arg)-1] == "NAME,SIZE,TYPE,PKNAME":
+				return fmt.Sprintf(`NAME="%s" SIZE="53687091200" TYPE="disk" PKNAME=""`, arg[0]), nil
+			case command == "lsblk" && arg[0] == "/dev/vdb":
+				return `SIZE="53687091200" ROTA="1" RO="0" TYPE="disk" PKNAME="" NAME="/dev/vdb" KNAME="/dev/vdb" UUID="klSb8f" WWN="" MOUNTPOINT=""
+SIZE="53682896896" ROTA="1" RO="0" TYPE="lvm" PKNAME="/dev/vdb" NAME="/dev/mapper/ceph--osd--block" KNAME="/dev/dm-5" UUID="" WWN="" MOUNTPOINT="/var/lib/ceph"`, nil
+			case command == "lsblk":
+				return `SIZE="53687091200" ROTA="0" RO="0" TYPE="disk" PKNAME="" NAME="/dev/vdc" KNAME="/dev/vdc" UUID="" WWN="0x5000c500a1b2c3d4" MOUNTPOINT=""`, nil
+			}
+			return "", errors.New("unexpected command")
+		},
+	}
+	usage, err := sys.GetDeviceUsage(executor, "/dev/vdb")
+	s.NoError(err)
+	s.Equal("8560782279146-1", usage.Device.Serial)
+	s.Equal([]string{"/var/lib/ceph"}, usage.MountPoints)
+	s.Equal([]string{"dm-5"}, usage.Holders)
+	s.Equal([]string{"/dev/mapper/ceph--osd--block"}, usage.Children)
+	s.Equal([]string{
+		"mounted on /var/lib/ceph",
+		"held by dm-5",
+		"has children /dev/mapper/ceph--osd--block",
+		"has LVM2_member signature",
+	}, usage.Reasons())
+
+	usage, err = sys.GetDeviceUsage(executor, "/dev/vdc")
+	s.NoError(err)
+	s.Equal("0x5000c500a1b2c3d4", usage.Device.WWN)
+	s.False(usage.Device.Rotational)
+	s.True(usage.Device.Empty)
+	s.Empty(usage.Reasons())
 }
@@ -0,0 +1,159 @@
+package sys
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ProcFS is the mount point of procfs
+var ProcFS = "/proc"
+
+// QueueInfo is the block queue settings of the device from sysfs
+type QueueInfo struct {
+	Scheduler         string `json:"scheduler,omitempty"`
+	NrRequests        int64  `json:"nr_requests,omitempty"`
+	ReadAheadKB       int64  `json:"read_ahead_kb,omitempty"`
+	MaxSectorsKB      int64  `json:"max_sectors_kb,omitempty"`
+	WriteCache        string `json:"write_cache,omitempty"` // write back or write through
+	LogicalBlockSize  int64  `json:"logical_block_size,omitempty"`
+	PhysicalBlockSize int64  `json:"physical_block_size,omitempty"`
+}
+
+// HostInfo is the facts of the host which may affect the benchmark results
+type HostInfo struct {
+	Hostname      string `json:"hostname"`
+	KernelVersion string `json:"kernel_version"`
+	CPUModel      string `json:"cpu_model"`
+	CPUCores      int    `json:"cpu_cores"`
+	MemoryBytes   uint64 `json:"memory_bytes"`
+}
+
+// GetQueueInfo reads the block queue settings of the device from sysfs, eg.
+// /sys/class/block/nvme0n1/queue/scheduler, the missing settings are ignored.
+func GetQueueInfo(device string) (*QueueInfo, error) {
+	dir := queueDir(device)
+	if _, err := os.Stat(dir); err != nil {
+		return nil, errors.Wrapf(err, "failed to get queue settings of %s", device)
+	}
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(data))
+	}
+	readInt := func(name string) int64 {
+		v, _ := strconv.ParseInt(read(name), 10, 64)
+		return v
+	}
+	return &QueueInfo{
+		Scheduler:         parseScheduler(read("scheduler")),
+		NrRequests:        readInt("nr_requests"),
+		ReadAheadKB:       readInt("read_ahead_kb"),
+		MaxSectorsKB:      readInt("max_sectors_kb"),
+		WriteCache:        read("write_cache"),
+		LogicalBlockSize:  readInt("logical_block_size"),
+		PhysicalBlockSize: readInt("physical_block_size"),
+	}, nil
+}
+
+// GetQueueAttribute reads the block queue attribute of the device from sysfs,
+// the active one is returned for the scheduler, eg. mq-deadline.
+func GetQueueAttribute(device, name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(queueDir(device), name))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read %s of %s", name, device)
+	}
+	value := strings.TrimSpace(string(data))
+	if name == "scheduler" {
+		value = parseScheduler(value)
+	}
+	return value, nil
+}
+
+// SetQueueAttribute writes the block queue attribute of the device to sysfs.
+func SetQueueAttribute(device, name, value string) error {
+	if err := os.WriteFile(filepath.Join(queueDir(device), name), []byte(value), 0644); err != nil {
+		return errors.Wrapf(err, "failed to set %s of %s to %s", name, device, value)
+	}
+	return nil
+}
+
+// queueDir returns the sysfs directory of the block queue of the device, eg.
+// /sys/class/block/nvme0n1/queue
+func queueDir(device string) string {
+	if real, err := filepath.EvalSymlinks(device); err == nil {
+		device = real
+	}
+	return filepath.Join(SysClassBlock, filepath.Base(device), "queue")
+}
+
+// parseScheduler returns the active scheduler, eg. mq-deadline of "[mq-deadline] kyber bfq none"
+func parseScheduler(schedulers string) string {
+	for _, s := range strings.Fields(schedulers) {
+		if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+			return strings.Trim(s, "[]")
+		}
+	}
+	return schedulers
+}
+
+// GetHostInfo returns the kernel version, cpu model, cores and memory of the host from procfs
+func GetHostInfo() (*HostInfo, error) {
+	host := &HostInfo{CPUCores: runtime.NumCPU()}
+	host.Hostname, _ = os.Hostname()
+	release, err := os.ReadFile(filepath.Join(ProcFS, "sys", "kernel", "osrelease"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get kernel version")
+	}
+	host.KernelVersion = strings.TrimSpace(string(release))
+	if err = scanProcFile("cpuinfo", func(key, value string) bool {
+		if key == "model name" {
+			host.CPUModel = value
+			return false
+		}
+		return true
+	}); err != nil {
+		return nil, err
+	}
+	if err = scanProcFile("meminfo", func(key, value string) bool {
+		if key == "MemTotal" {
+			// MemTotal:       263724312 kB
+			if kb, err := strconv.ParseUint(strings.TrimSuffix(value, " kB"), 10, 64); err == nil {
+				host.MemoryBytes = kb * 1024
+			}
+			return false
+		}
+		return true
+	}); err != nil {
+		return nil, err
+	}
+	return host, nil
+}
+
+// scanProcFile scans the "key: value" lines of the proc file until fn returns false
+func scanProcFile(name string, fn func(key, value string) bool) error {
+	f, err := os.Open(filepath.Join(ProcFS, name))
+	if err != nil {
+		return fmt.Errorf("failed to open %s. %v", name, err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		if !fn(strings.TrimSpace(key), strings.TrimSpace(value)) {
+			break
+		}
+	}
+	return scanner.Err()
+}
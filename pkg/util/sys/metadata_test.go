@@ -0,0 +1,111 @@
+package sys_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/microyahoo/fio-benchmark/pkg/util/sys"
+)
+
+func TestMetadataSuite(t *testing.T) {
+	suite.Run(t, new(metadataSuite))
+}
+
+type metadataSuite struct {
+	suite.Suite
+}
+
+func writeFiles(s *suite.Suite, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		s.NoError(os.MkdirAll(filepath.Dir(path), 0755))
+		s.NoError(os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func (s *metadataSuite) TestGetQueueInfo() {
+	sysfs := s.T().TempDir()
+	defer func(old string) { sys.SysClassBlock = old }(sys.SysClassBlock)
+	sys.SysClassBlock = sysfs
+	writeFiles(&s.Suite, filepath.Join(sysfs, "sdb", "queue"), map[string]string{
+		"scheduler":           "none [mq-deadline] kyber bfq\n",
+		"nr_requests":         "256\n",
+		"read_ahead_kb":       "4096\n",
+		"max_sectors_kb":      "1280\n",
+		"write_cache":         "write back\n",
+		"logical_block_size":  "512\n",
+		"physical_block_size": "4096\n",
+	})
+	queue, err := sys.GetQueueInfo("/dev/sdb")
+	s.NoError(err)
+	s.Equal(&sys.QueueInfo{
+		Scheduler:         "mq-deadline",
+		NrRequests:        256,
+		ReadAheadKB:       4096,
+		MaxSectorsKB:      1280,
+		WriteCache:        "write back",
+		LogicalBlockSize:  512,
+		PhysicalBlockSize: 4096,
+	}, queue)
+
+	writeFiles(&s.Suite, filepath.Join(sysfs, "nvme0n1", "queue"), map[string]string{"scheduler": "[none] mq-deadline\n"})
+	queue, err = sys.GetQueueInfo("nvme0n1")
+	s.NoError(err)
+	s.Equal(&sys.QueueInfo{Scheduler: "none"}, queue)
+
+	_, err = sys.GetQueueInfo("/dev/sdc")
+	s.Error(err)
+}
+
+func (s *metadataSuite) TestQueueAttribute() {
+	sysfs := s.T().TempDir()
+	defer func(old string) { sys.SysClassBlock = old }(sys.SysClassBlock)
+	sys.SysClassBlock = sysfs
+	writeFiles(&s.Suite, filepath.Join(sysfs, "sdb", "queue"), map[string]string{
+		"scheduler":   "none [mq-deadline] kyber bfq\n",
+		"nr_requests": "256\n",
+	})
+	value, err := sys.GetQueueAttribute("/dev/sdb", "scheduler")
+	s.NoError(err)
+	s.Equal("mq-deadline", value)
+	value, err = sys.GetQueueAttribute("/dev/sdb", "nr_requests")
+	s.NoError(err)
+	s.Equal("256", value)
+	_, err = sys.GetQueueAttribute("/dev/sdb", "read_ahead_kb")
+	s.Error(err)
+
+	s.NoError(sys.SetQueueAttribute("/dev/sdb", "nr_requests", "64"))
+	value, err = sys.GetQueueAttribute("/dev/sdb", "nr_requests")
+	s.NoError(err)
+	s.Equal("64", value)
+	s.Error(sys.SetQueueAttribute("/dev/sdc", "nr_requests", "64"))
+}
+
+func (s *metadataSuite) TestGetHostInfo() {
+	procfs := s.T().TempDir()
+	defer func(old string) { sys.ProcFS = old }(sys.ProcFS)
+	sys.ProcFS = procfs
+	_, err := sys.GetHostInfo()
+	s.Error(err)
+
+	writeFiles(&s.Suite, procfs, map[string]string{
+		"sys/kernel/osrelease": "5.15.0-91-generic\n",
+		"cpuinfo": `processor	: 0
+vendor_id	: GenuineIntel
+model name	: Intel(R) Xeon(R) Gold 6330 CPU @ 2.00GHz
+`,
+		"meminfo": `MemTotal:       263724470 kB
+MemFree:        250000000 kB
+`,
+	})
+	host, err := sys.GetHostInfo()
+	s.NoError(err)
+	s.Equal("5.15.0-91-generic", host.KernelVersion)
+	s.Equal("Intel(R) Xeon(R) Gold 6330 CPU @ 2.00GHz", host.CPUModel)
+	s.EqualValues(263724470*1024, host.MemoryBytes)
+	s.Positive(host.CPUCores)
+	s.NotEmpty(host.Hostname)
+}